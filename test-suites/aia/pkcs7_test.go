@@ -0,0 +1,49 @@
+package aia
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/Netflix/bettertls/test-suites/certutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildCertsOnlyPkcs7(t *testing.T) {
+	var certs []*x509.Certificate
+	for _, name := range []string{"ICA1", "ICA2"} {
+		cert, _, err := certutil.GenerateSelfSignedCert(name)
+		require.NoError(t, err)
+		certs = append(certs, cert)
+	}
+
+	der, err := buildCertsOnlyPkcs7(certs)
+	require.NoError(t, err)
+
+	var outer contentInfo
+	rest, err := asn1.Unmarshal(der, &outer)
+	require.NoError(t, err)
+	assert.Empty(t, rest)
+	assert.True(t, outer.ContentType.Equal(oidSignedData))
+	assert.Equal(t, asn1.ClassContextSpecific, outer.Content.Class)
+	assert.Equal(t, 0, outer.Content.Tag)
+
+	var sd signedData
+	rest, err = asn1.Unmarshal(outer.Content.Bytes, &sd)
+	require.NoError(t, err)
+	assert.Empty(t, rest)
+	assert.Equal(t, 1, sd.Version)
+	assert.True(t, sd.ContentInfo.ContentType.Equal(oidData))
+	assert.Empty(t, sd.DigestAlgorithms.Bytes)
+	assert.Empty(t, sd.SignerInfos.Bytes)
+	assert.Equal(t, asn1.ClassContextSpecific, sd.Certificates.Class)
+
+	// The certificates are concatenated in order inside the [0] IMPLICIT SET
+	parsed, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	require.NoError(t, err)
+	require.Len(t, parsed, 2)
+	for i, cert := range certs {
+		assert.Equal(t, cert.Raw, parsed[i].Raw)
+	}
+}
@@ -0,0 +1,179 @@
+package aia
+
+import (
+	"fmt"
+
+	"github.com/Netflix/bettertls/test-suites/pathbuilding"
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+)
+
+const (
+	SANITY_CHECK_TEST_CASE uint = iota
+	AIA_FETCHING_FEATURE_TEST_CASE
+	AIA_PKCS7_FEATURE_TEST_CASE
+)
+
+const (
+	FEATURE_AIA_FETCHING test_case.Feature = iota
+	FEATURE_AIA_PKCS7
+)
+
+// A linear chain with two intermediates, so that a client has to follow caIssuers URLs more than once.
+var TWO_ICA_LINEAR = pathbuilding.NewGraph("TWO_ICA_LINEAR", []pathbuilding.Edge{
+	{Source: "ICA2", Destination: "EE"},
+	{Source: "ICA1", Destination: "ICA2"},
+	{Source: "Trust Anchor", Destination: "ICA1"},
+})
+
+var ENCODINGS = []Encoding{ENCODING_DER, ENCODING_PEM, ENCODING_PKCS7}
+
+type TestCaseProvider struct {
+	testCases []test_case.TestCase
+}
+
+func NewTestCaseProvider() *TestCaseProvider {
+	linear := func(comment string) *pathbuilding.ExplicitTestCase {
+		return &pathbuilding.ExplicitTestCase{
+			TrustGraph: pathbuilding.LINEAR_TRUST_GRAPH,
+			SrcNode:    "Trust Anchor",
+			DstNode:    "EE",
+			Comment:    comment,
+		}
+	}
+	linearIca := []pathbuilding.Edge{{Source: "Trust Anchor", Destination: "ICA"}}
+
+	testCases := make([]test_case.TestCase, 3)
+	testCases[SANITY_CHECK_TEST_CASE] = &AiaTestCase{
+		ExplicitTestCase: linear("The full chain is presented, so caIssuers URLs never need to be followed."),
+		Encoding:         ENCODING_DER,
+	}
+	testCases[AIA_FETCHING_FEATURE_TEST_CASE] = &AiaTestCase{
+		ExplicitTestCase: linear("The ICA is only available as DER from the leaf's caIssuers URL."),
+		OmittedEdges:     linearIca,
+		Encoding:         ENCODING_DER,
+	}
+	testCases[AIA_PKCS7_FEATURE_TEST_CASE] = &AiaTestCase{
+		ExplicitTestCase: linear("The ICA is only available in a PKCS#7 bundle from the leaf's caIssuers URL."),
+		OmittedEdges:     linearIca,
+		Encoding:         ENCODING_PKCS7,
+	}
+	testCases = append(testCases, &AiaTestCase{
+		ExplicitTestCase: linear("The ICA is only available as PEM from the leaf's caIssuers URL."),
+		OmittedEdges:     linearIca,
+		Encoding:         ENCODING_PEM,
+	})
+
+	for _, encoding := range ENCODINGS {
+		testCases = append(testCases, &AiaTestCase{
+			ExplicitTestCase: &pathbuilding.ExplicitTestCase{
+				TrustGraph: TWO_ICA_LINEAR,
+				SrcNode:    "Trust Anchor",
+				DstNode:    "EE",
+				Comment:    fmt.Sprintf("Both ICAs are omitted, so caIssuers URLs (%s) must be followed recursively.", encoding),
+			},
+			OmittedEdges: []pathbuilding.Edge{{Source: "ICA1", Destination: "ICA2"}, {Source: "Trust Anchor", Destination: "ICA1"}},
+			Encoding:     encoding,
+		})
+		testCases = append(testCases, &AiaTestCase{
+			ExplicitTestCase: &pathbuilding.ExplicitTestCase{
+				TrustGraph: TWO_ICA_LINEAR,
+				SrcNode:    "Trust Anchor",
+				DstNode:    "EE",
+				Comment:    fmt.Sprintf("Only the top ICA is omitted and must be fetched (%s) using the caIssuers URL of the presented ICA.", encoding),
+			},
+			OmittedEdges: []pathbuilding.Edge{{Source: "Trust Anchor", Destination: "ICA1"}},
+			Encoding:     encoding,
+		})
+		for _, root := range []string{"Root1", "Root2"} {
+			testCases = append(testCases, &AiaTestCase{
+				ExplicitTestCase: &pathbuilding.ExplicitTestCase{
+					TrustGraph: pathbuilding.TWO_ROOTS,
+					SrcNode:    root,
+					DstNode:    "EE",
+					Comment:    fmt.Sprintf("Both certificates for the ICA are omitted and only the one signed by %s is trusted. The client must consider every caIssuers URL (%s).", root, encoding),
+				},
+				OmittedEdges: []pathbuilding.Edge{{Source: "Root1", Destination: "ICA"}, {Source: "Root2", Destination: "ICA"}},
+				Encoding:     encoding,
+			})
+		}
+		testCases = append(testCases, &AiaTestCase{
+			ExplicitTestCase: &pathbuilding.ExplicitTestCase{
+				TrustGraph:    pathbuilding.LINEAR_TRUST_GRAPH,
+				SrcNode:       "Trust Anchor",
+				DstNode:       "EE",
+				InvalidEdges:  linearIca,
+				InvalidReason: pathbuilding.INVALID_REASON_EXPIRED,
+				ExpectFailure: true,
+				Comment:       fmt.Sprintf("The ICA fetched from the caIssuers URL (%s) is expired.", encoding),
+			},
+			OmittedEdges: linearIca,
+			Encoding:     encoding,
+		})
+	}
+
+	for _, fault := range []Fault{FAULT_NO_URL, FAULT_NOT_FOUND, FAULT_GARBAGE, FAULT_WRONG_KEY} {
+		testCases = append(testCases, &AiaTestCase{
+			ExplicitTestCase: linear(fmt.Sprintf("The ICA is omitted and the caIssuers URLs are broken (%s).", fault)),
+			OmittedEdges:     linearIca,
+			Encoding:         ENCODING_DER,
+			Fault:            fault,
+		})
+	}
+	for _, encoding := range []Encoding{ENCODING_DER, ENCODING_PKCS7} {
+		testCases = append(testCases, &AiaTestCase{
+			ExplicitTestCase: &pathbuilding.ExplicitTestCase{
+				TrustGraph: TWO_ICA_LINEAR,
+				SrcNode:    "Trust Anchor",
+				DstNode:    "EE",
+				Comment:    fmt.Sprintf("Both ICAs are omitted and the caIssuers URL (%s) of ICA2 points back at ICA2 itself. The client must not loop forever.", encoding),
+			},
+			OmittedEdges: []pathbuilding.Edge{{Source: "ICA1", Destination: "ICA2"}, {Source: "Trust Anchor", Destination: "ICA1"}},
+			Encoding:     encoding,
+			Fault:        FAULT_LOOP,
+		})
+	}
+
+	return &TestCaseProvider{
+		testCases: testCases,
+	}
+}
+
+func (p *TestCaseProvider) Name() string {
+	return "aia"
+}
+
+func (p *TestCaseProvider) GetTestCaseCount() (uint, error) {
+	return uint(len(p.testCases)), nil
+}
+
+func (p *TestCaseProvider) GetTestCase(index uint) (test_case.TestCase, error) {
+	return p.testCases[index], nil
+}
+
+func (p *TestCaseProvider) GetSanityCheckTestCase() (uint, error) {
+	return SANITY_CHECK_TEST_CASE, nil
+}
+
+func (p *TestCaseProvider) GetFeatures() []test_case.Feature {
+	return []test_case.Feature{FEATURE_AIA_FETCHING, FEATURE_AIA_PKCS7}
+}
+
+func (p *TestCaseProvider) DescribeFeature(feature test_case.Feature) string {
+	switch feature {
+	case FEATURE_AIA_FETCHING:
+		return "AIA_FETCHING"
+	case FEATURE_AIA_PKCS7:
+		return "AIA_PKCS7"
+	}
+	panic(fmt.Errorf("unsupported feature: %d", feature))
+}
+
+func (p *TestCaseProvider) GetTestCasesForFeature(feature test_case.Feature) ([]uint, error) {
+	switch feature {
+	case FEATURE_AIA_FETCHING:
+		return []uint{AIA_FETCHING_FEATURE_TEST_CASE}, nil
+	case FEATURE_AIA_PKCS7:
+		return []uint{AIA_PKCS7_FEATURE_TEST_CASE}, nil
+	}
+	return nil, fmt.Errorf("invalid feature: %v", feature)
+}
@@ -0,0 +1,316 @@
+package aia
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/Netflix/bettertls/test-suites/certutil"
+	"github.com/Netflix/bettertls/test-suites/pathbuilding"
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+)
+
+// An Encoding is the format of the documents served from caIssuers URLs.
+type Encoding int
+
+const (
+	// A single DER certificate per URL, as required by RFC 5280 section 4.2.2.1
+	ENCODING_DER Encoding = iota
+	// A single PEM certificate per URL. Not allowed by RFC 5280, but commonly seen in the wild.
+	ENCODING_PEM
+	// A single certs-only PKCS#7 bundle holding every certificate for the issuer, as allowed by RFC 5280
+	ENCODING_PKCS7
+)
+
+func (e Encoding) String() string {
+	switch e {
+	case ENCODING_DER:
+		return "DER"
+	case ENCODING_PEM:
+		return "PEM"
+	case ENCODING_PKCS7:
+		return "PKCS7"
+	}
+	panic(fmt.Errorf("Unhandled value in Encoding.String(): %v", int(e)))
+}
+func (e Encoding) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.String())
+}
+
+func (e Encoding) contentType() string {
+	switch e {
+	case ENCODING_DER:
+		return "application/pkix-cert"
+	case ENCODING_PEM:
+		return "application/x-pem-file"
+	case ENCODING_PKCS7:
+		return "application/pkcs7-mime"
+	}
+	panic(fmt.Errorf("Unhandled value in Encoding.contentType(): %v", int(e)))
+}
+
+func (e Encoding) extension() string {
+	switch e {
+	case ENCODING_DER:
+		return "der"
+	case ENCODING_PEM:
+		return "pem"
+	case ENCODING_PKCS7:
+		return "p7c"
+	}
+	panic(fmt.Errorf("Unhandled value in Encoding.extension(): %v", int(e)))
+}
+
+// A Fault is a way in which the caIssuers URLs of a test case are broken.
+type Fault int
+
+const (
+	FAULT_NONE Fault = iota
+	// Certificates carry no AIA extension at all
+	FAULT_NO_URL
+	// caIssuers URLs point at resources that do not exist
+	FAULT_NOT_FOUND
+	// caIssuers URLs serve random bytes
+	FAULT_GARBAGE
+	// caIssuers URLs in CA certificates point back at the certificate itself rather than at its issuer
+	FAULT_LOOP
+	// caIssuers URLs serve certificates with the right subject but a different key
+	FAULT_WRONG_KEY
+)
+
+func (f Fault) String() string {
+	switch f {
+	case FAULT_NONE:
+		return "NONE"
+	case FAULT_NO_URL:
+		return "NO_URL"
+	case FAULT_NOT_FOUND:
+		return "NOT_FOUND"
+	case FAULT_GARBAGE:
+		return "GARBAGE"
+	case FAULT_LOOP:
+		return "LOOP"
+	case FAULT_WRONG_KEY:
+		return "WRONG_KEY"
+	}
+	panic(fmt.Errorf("Unhandled value in Fault.String(): %v", int(f)))
+}
+func (f Fault) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.String())
+}
+
+type AiaTestCase struct {
+	ExplicitTestCase *pathbuilding.ExplicitTestCase
+	// Certificates that the server leaves out of the chain it presents, so that the client can only find them by
+	// following caIssuers URLs
+	OmittedEdges []pathbuilding.Edge
+	Encoding     Encoding
+	Fault        Fault
+}
+
+func (c *AiaTestCase) GetHostname() string {
+	return "localhost"
+}
+
+func (c *AiaTestCase) ExpectedResult() test_case.ExpectedResult {
+	if c.Fault != FAULT_NONE && len(c.OmittedEdges) > 0 {
+		return test_case.EXPECTED_RESULT_FAIL
+	}
+	etc := c.ExplicitTestCase
+	path := etc.TrustGraph.Reachable(etc.InvalidEdges, etc.SrcNode, etc.DstNode)
+	if len(path) == 0 {
+		return test_case.EXPECTED_RESULT_FAIL
+	}
+	if c.Encoding == ENCODING_PEM && len(c.OmittedEdges) > 0 {
+		return test_case.EXPECTED_RESULT_SOFT_PASS
+	}
+	return test_case.EXPECTED_RESULT_PASS
+}
+
+func (c *AiaTestCase) RequiredFeatures() []test_case.Feature {
+	requiredFeatures := make([]test_case.Feature, 0, 2)
+	if len(c.OmittedEdges) > 0 {
+		requiredFeatures = append(requiredFeatures, FEATURE_AIA_FETCHING)
+		if c.Encoding == ENCODING_PKCS7 {
+			requiredFeatures = append(requiredFeatures, FEATURE_AIA_PKCS7)
+		}
+	}
+	return requiredFeatures
+}
+
+func (c *AiaTestCase) GetCertificates(rootCert *x509.Certificate, rootKey crypto.Signer) (*tls.Certificate, error) {
+	artifacts, err := c.GetArtifacts(&test_case.Environment{
+		RootCert:   rootCert,
+		RootKey:    rootKey,
+		AiaBaseUrl: test_case.DEFAULT_AIA_BASE_URL,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return artifacts.Certificate, nil
+}
+
+func nodeSlug(node string) string {
+	return strings.ToLower(strings.ReplaceAll(node, " ", "_"))
+}
+
+// resourcePath gets the path (relative to the AIA base URL) of the resource holding the certificate(s) for the given
+// subject. For PKCS#7 there is a single bundle per subject, otherwise there is one resource per certificate.
+func (c *AiaTestCase) resourcePath(token string, edge pathbuilding.Edge) string {
+	if c.Encoding == ENCODING_PKCS7 {
+		return fmt.Sprintf("%s/%s.%s", token, nodeSlug(edge.Destination), c.Encoding.extension())
+	}
+	return fmt.Sprintf("%s/%s-%s.%s", token, nodeSlug(edge.Source), nodeSlug(edge.Destination), c.Encoding.extension())
+}
+
+// caIssuersUrls gets the URLs to embed in a certificate issued by the given node.
+func (c *AiaTestCase) caIssuersUrls(env *test_case.Environment, token string, issuer string) []string {
+	urls := make([]string, 0)
+	seen := pathbuilding.NewStringSet()
+	for _, edge := range c.ExplicitTestCase.TrustGraph.GetAllEdges() {
+		if edge.Destination != issuer {
+			continue
+		}
+		path := c.resourcePath(token, edge)
+		if c.Fault == FAULT_NOT_FOUND {
+			path = "missing/" + path
+		}
+		if seen.Contains(path) {
+			continue
+		}
+		seen.Add(path)
+		urls = append(urls, env.AiaBaseUrl+path)
+	}
+	return urls
+}
+
+func (c *AiaTestCase) GetArtifacts(env *test_case.Environment) (*test_case.Artifacts, error) {
+	etc := c.ExplicitTestCase
+	// A fresh token per generation makes sure clients can't satisfy a test from a cache populated by an earlier one.
+	token := certutil.RandomString()
+
+	generated, err := pathbuilding.GenerateCertsWithOptions(env.RootCert, env.RootKey, c.GetHostname(), &pathbuilding.TestCaseImpl{
+		ExplicitTestCase: etc,
+		InvalidReason:    etc.InvalidReason,
+	}, &pathbuilding.GenerateOptions{
+		EditTemplate: func(edge pathbuilding.Edge, template *x509.Certificate) {
+			if c.Fault == FAULT_NO_URL {
+				return
+			}
+			issuer := edge.Source
+			if c.Fault == FAULT_LOOP && edge.Destination != etc.DstNode {
+				issuer = edge.Destination
+			}
+			template.IssuingCertificateURL = c.caIssuersUrls(env, token, issuer)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Gather the certificates to host, grouped by resource
+	resourceCerts := make(map[string][]*x509.Certificate)
+	resourcePaths := make([]string, 0)
+	for _, edge := range etc.TrustGraph.GetAllEdges() {
+		if edge.Destination == etc.DstNode {
+			continue
+		}
+		cert := generated.EdgeCerts[edge]
+		if c.Fault == FAULT_WRONG_KEY {
+			cert, err = generateWrongKeyCert(cert, generated.NodeCerts[edge.Source], generated.NodeKeys[edge.Source])
+			if err != nil {
+				return nil, err
+			}
+		}
+		path := c.resourcePath(token, edge)
+		if _, ok := resourceCerts[path]; !ok {
+			resourcePaths = append(resourcePaths, path)
+		}
+		resourceCerts[path] = append(resourceCerts[path], cert)
+	}
+
+	aiaResources := make(map[string]*test_case.AiaResource)
+	for _, path := range resourcePaths {
+		var body []byte
+		if c.Fault == FAULT_GARBAGE {
+			body = make([]byte, 512)
+			_, err = rand.Read(body)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			body, err = c.encode(resourceCerts[path])
+			if err != nil {
+				return nil, err
+			}
+		}
+		aiaResources[path] = &test_case.AiaResource{
+			ContentType: c.Encoding.contentType(),
+			Body:        body,
+		}
+	}
+
+	// Drop the omitted certificates from the presented chain
+	presented := make([][]byte, 0, len(generated.Chain.Certificate))
+	for _, certBytes := range generated.Chain.Certificate {
+		omitted := false
+		for _, edge := range c.OmittedEdges {
+			if string(generated.EdgeCerts[edge].Raw) == string(certBytes) {
+				omitted = true
+				break
+			}
+		}
+		if !omitted {
+			presented = append(presented, certBytes)
+		}
+	}
+
+	return &test_case.Artifacts{
+		Certificate: &tls.Certificate{
+			Certificate: presented,
+			PrivateKey:  generated.Chain.PrivateKey,
+		},
+		AiaResources: aiaResources,
+	}, nil
+}
+
+func (c *AiaTestCase) encode(certs []*x509.Certificate) ([]byte, error) {
+	switch c.Encoding {
+	case ENCODING_DER:
+		return certs[0].Raw, nil
+	case ENCODING_PEM:
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certs[0].Raw}), nil
+	case ENCODING_PKCS7:
+		return buildCertsOnlyPkcs7(certs)
+	}
+	return nil, fmt.Errorf("unhandled encoding: %v", c.Encoding)
+}
+
+// generateWrongKeyCert creates a certificate with the same subject, issuer and validity as the given certificate, but
+// for an unrelated key.
+func generateWrongKeyCert(cert *x509.Certificate, issuerCert *x509.Certificate, issuerKey crypto.Signer) (*x509.Certificate, error) {
+	_, wrongKey, err := certutil.GenerateSelfSignedCert(cert.Subject.CommonName)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          certutil.RandomSerial(),
+		Subject:               cert.Subject,
+		NotBefore:             cert.NotBefore,
+		NotAfter:              cert.NotAfter,
+		KeyUsage:              cert.KeyUsage,
+		BasicConstraintsValid: cert.BasicConstraintsValid,
+		IsCA:                  cert.IsCA,
+		IssuingCertificateURL: cert.IssuingCertificateURL,
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, issuerCert, wrongKey.Public(), issuerKey)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(certBytes)
+}
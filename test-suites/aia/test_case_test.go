@@ -0,0 +1,53 @@
+package aia
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/Netflix/bettertls/test-suites/certutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncode(t *testing.T) {
+	var certs []*x509.Certificate
+	for _, name := range []string{"ICA1", "ICA2"} {
+		cert, _, err := certutil.GenerateSelfSignedCert(name)
+		require.NoError(t, err)
+		certs = append(certs, cert)
+	}
+
+	// DER and PEM hold only the first certificate
+	der, err := (&AiaTestCase{Encoding: ENCODING_DER}).encode(certs)
+	require.NoError(t, err)
+	assert.Equal(t, certs[0].Raw, der)
+
+	encoded, err := (&AiaTestCase{Encoding: ENCODING_PEM}).encode(certs)
+	require.NoError(t, err)
+	block, rest := pem.Decode(encoded)
+	require.NotNil(t, block)
+	assert.Empty(t, rest)
+	assert.Equal(t, "CERTIFICATE", block.Type)
+	assert.Equal(t, certs[0].Raw, block.Bytes)
+
+	p7c, err := (&AiaTestCase{Encoding: ENCODING_PKCS7}).encode(certs)
+	require.NoError(t, err)
+	expected, err := buildCertsOnlyPkcs7(certs)
+	require.NoError(t, err)
+	assert.Equal(t, expected, p7c)
+
+	_, err = (&AiaTestCase{Encoding: Encoding(99)}).encode(certs)
+	assert.Error(t, err)
+}
+
+func TestEncodingResources(t *testing.T) {
+	for encoding, expected := range map[Encoding][2]string{
+		ENCODING_DER:   {"application/pkix-cert", "der"},
+		ENCODING_PEM:   {"application/x-pem-file", "pem"},
+		ENCODING_PKCS7: {"application/pkcs7-mime", "p7c"},
+	} {
+		assert.Equal(t, expected[0], encoding.contentType(), encoding.String())
+		assert.Equal(t, expected[1], encoding.extension(), encoding.String())
+	}
+}
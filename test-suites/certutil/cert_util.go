@@ -53,18 +53,23 @@ func RandomString() string {
 }
 
 func GenerateSelfSignedCert(commonName string) (*x509.Certificate, crypto.Signer, error) {
+	return GenerateSelfSignedCertWithSubject(pkix.Name{
+		CommonName:   commonName,
+		Organization: []string{SUBJECT_ORGANIZATION},
+		SerialNumber: RandomString(),
+	})
+}
+
+// GenerateSelfSignedCertWithSubject generates a new CA key and self-signed certificate for the given subject.
+func GenerateSelfSignedCertWithSubject(subject pkix.Name) (*x509.Certificate, crypto.Signer, error) {
 	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	template := &x509.Certificate{
-		SerialNumber: RandomSerial(),
-		Subject: pkix.Name{
-			CommonName:   commonName,
-			Organization: []string{SUBJECT_ORGANIZATION},
-			SerialNumber: RandomString(),
-		},
+		SerialNumber:          RandomSerial(),
+		Subject:               subject,
 		NotBefore:             GetNotBefore(),
 		NotAfter:              GetNotAfter(false),
 		KeyUsage:              x509.KeyUsageCertSign,
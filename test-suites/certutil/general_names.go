@@ -0,0 +1,201 @@
+package certutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net"
+)
+
+// The GeneralName forms (RFC 5280 section 4.2.1.6), which are the context-specific tags of their encodings
+const (
+	NAME_TYPE_EMAIL          = 1
+	NAME_TYPE_DNS            = 2
+	NAME_TYPE_DIRECTORY_NAME = 4
+	NAME_TYPE_URI            = 6
+	NAME_TYPE_IP             = 7
+)
+
+var oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+var oidExtensionNameConstraints = asn1.ObjectIdentifier{2, 5, 29, 30}
+
+// A GeneralName is a name of one of the NAME_TYPE_ forms (or any other tag). Its value is encoded as-is, so it may hold
+// names that x509.CreateCertificate refuses to encode, such as raw UTF-8 or control characters in a DNS name.
+type GeneralName struct {
+	Type  int
+	Value []byte
+	// Whether the value is explicitly tagged, as a directoryName is
+	explicit bool
+}
+
+// DnsName returns a DNS name GeneralName, without any validation of the name.
+func DnsName(name string) GeneralName {
+	return GeneralName{Type: NAME_TYPE_DNS, Value: []byte(name)}
+}
+
+// UriName returns a uniformResourceIdentifier GeneralName, without any validation of the URI. In a name constraint,
+// it's the host or domain the constraint applies to.
+func UriName(uri string) GeneralName {
+	return GeneralName{Type: NAME_TYPE_URI, Value: []byte(uri)}
+}
+
+// DirectoryName returns a directoryName GeneralName holding the given distinguished name.
+func DirectoryName(name pkix.Name) (GeneralName, error) {
+	value, err := asn1.Marshal(name.ToRDNSequence())
+	if err != nil {
+		return GeneralName{}, err
+	}
+	return GeneralName{Type: NAME_TYPE_DIRECTORY_NAME, Value: value, explicit: true}, nil
+}
+
+// IpRange returns an iPAddress GeneralName for a name constraint: the address followed by the mask, 8 bytes long for
+// an IPv4 range and 32 for an IPv6 range.
+func IpRange(ipRange *net.IPNet) GeneralName {
+	ip := ipRange.IP
+	if ip4 := ip.To4(); ip4 != nil && len(ipRange.Mask) == net.IPv4len {
+		ip = ip4
+	}
+	return GeneralName{Type: NAME_TYPE_IP, Value: append(append([]byte{}, ip...), ipRange.Mask...)}
+}
+
+func (n GeneralName) rawValue() asn1.RawValue {
+	return asn1.RawValue{Tag: n.Type, Class: asn1.ClassContextSpecific, IsCompound: n.explicit, Bytes: n.Value}
+}
+
+// BuildSanExtension builds a subject alternative name extension holding the given names.
+func BuildSanExtension(critical bool, names []GeneralName) (pkix.Extension, error) {
+	ext := pkix.Extension{
+		Id:       oidExtensionSubjectAltName,
+		Critical: critical,
+	}
+
+	var rawValues []asn1.RawValue
+	for _, name := range names {
+		rawValues = append(rawValues, name.rawValue())
+	}
+
+	var err error
+	ext.Value, err = asn1.Marshal(rawValues)
+	return ext, err
+}
+
+type generalSubtree struct {
+	Base asn1.RawValue
+}
+
+func marshalGeneralSubtrees(tag int, names []GeneralName) (asn1.RawValue, error) {
+	var subtrees []byte
+	for _, name := range names {
+		subtree, err := asn1.Marshal(generalSubtree{Base: name.rawValue()})
+		if err != nil {
+			return asn1.RawValue{}, err
+		}
+		subtrees = append(subtrees, subtree...)
+	}
+	return asn1.RawValue{Tag: tag, Class: asn1.ClassContextSpecific, IsCompound: true, Bytes: subtrees}, nil
+}
+
+// BuildNameConstraintsExtension builds a name constraints extension from the given permitted and excluded subtrees.
+// Either list is left out of the extension if it's empty, so with both empty the extension is an empty sequence.
+func BuildNameConstraintsExtension(critical bool, permitted []GeneralName, excluded []GeneralName) (pkix.Extension, error) {
+	ext := pkix.Extension{
+		Id:       oidExtensionNameConstraints,
+		Critical: critical,
+	}
+
+	var constraints []asn1.RawValue
+	if len(permitted) > 0 {
+		subtrees, err := marshalGeneralSubtrees(0, permitted)
+		if err != nil {
+			return ext, err
+		}
+		constraints = append(constraints, subtrees)
+	}
+	if len(excluded) > 0 {
+		subtrees, err := marshalGeneralSubtrees(1, excluded)
+		if err != nil {
+			return ext, err
+		}
+		constraints = append(constraints, subtrees)
+	}
+
+	var err error
+	ext.Value, err = asn1.Marshal(constraints)
+	return ext, err
+}
+
+// MoveNameConstraintsToExtension replaces the name constraints set in the template's fields with an equivalent
+// extension, which additionally holds the given subtrees. This is needed for name forms that x509.CreateCertificate
+// can't encode, such as directoryName.
+func MoveNameConstraintsToExtension(template *x509.Certificate, extraPermitted []GeneralName, extraExcluded []GeneralName) error {
+	var permitted, excluded []GeneralName
+	for _, domain := range template.PermittedDNSDomains {
+		permitted = append(permitted, DnsName(domain))
+	}
+	for _, ipRange := range template.PermittedIPRanges {
+		permitted = append(permitted, IpRange(ipRange))
+	}
+	for _, email := range template.PermittedEmailAddresses {
+		permitted = append(permitted, GeneralName{Type: NAME_TYPE_EMAIL, Value: []byte(email)})
+	}
+	for _, domain := range template.PermittedURIDomains {
+		permitted = append(permitted, UriName(domain))
+	}
+	permitted = append(permitted, extraPermitted...)
+
+	for _, domain := range template.ExcludedDNSDomains {
+		excluded = append(excluded, DnsName(domain))
+	}
+	for _, ipRange := range template.ExcludedIPRanges {
+		excluded = append(excluded, IpRange(ipRange))
+	}
+	for _, email := range template.ExcludedEmailAddresses {
+		excluded = append(excluded, GeneralName{Type: NAME_TYPE_EMAIL, Value: []byte(email)})
+	}
+	for _, domain := range template.ExcludedURIDomains {
+		excluded = append(excluded, UriName(domain))
+	}
+	excluded = append(excluded, extraExcluded...)
+
+	ext, err := BuildNameConstraintsExtension(template.PermittedDNSDomainsCritical, permitted, excluded)
+	if err != nil {
+		return err
+	}
+	template.ExtraExtensions = append(template.ExtraExtensions, ext)
+	template.PermittedDNSDomains = nil
+	template.PermittedIPRanges = nil
+	template.PermittedEmailAddresses = nil
+	template.PermittedURIDomains = nil
+	template.ExcludedDNSDomains = nil
+	template.ExcludedIPRanges = nil
+	template.ExcludedEmailAddresses = nil
+	template.ExcludedURIDomains = nil
+	return nil
+}
+
+// CreateUnparsedCaCert issues a CA certificate from the given template, with a new key. Go refuses to parse
+// certificates with some malformed extensions, so rather than parsing the result, it returns the template with the
+// certificate's encoding, key and key identifier filled in. That can be used as the parent of the certificates the CA
+// issues.
+func CreateUnparsedCaCert(template *x509.Certificate, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	ca := *template
+	ca.SubjectKeyId = make([]byte, 20)
+	_, err = rand.Read(ca.SubjectKeyId)
+	if err != nil {
+		return nil, nil, err
+	}
+	ca.PublicKey = key.Public()
+	ca.Raw, err = x509.CreateCertificate(rand.Reader, &ca, parent, key.Public(), parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &ca, key, nil
+}
@@ -0,0 +1,221 @@
+package certutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// issueWithExtensions issues a CA certificate carrying the given extensions and parses it back.
+func issueWithExtensions(t *testing.T, extensions []pkix.Extension) *x509.Certificate {
+	root, rootKey, err := GenerateSelfSignedCert("root")
+	require.NoError(t, err)
+	ca, _, err := CreateUnparsedCaCert(&x509.Certificate{
+		SerialNumber:          RandomSerial(),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             GetNotBefore(),
+		NotAfter:              GetNotAfter(false),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		ExtraExtensions:       extensions,
+	}, root, rootKey)
+	require.NoError(t, err)
+	parsed, err := x509.ParseCertificate(ca.Raw)
+	require.NoError(t, err)
+	return parsed
+}
+
+func TestBuildSanExtension(t *testing.T) {
+	ext, err := BuildSanExtension(false, []GeneralName{
+		DnsName("test.localhost"),
+		{Type: NAME_TYPE_IP, Value: []byte{127, 0, 0, 1}},
+		{Type: NAME_TYPE_EMAIL, Value: []byte("test@test.localhost")},
+		UriName("spiffe://test.localhost/x"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, oidExtensionSubjectAltName, ext.Id)
+	assert.False(t, ext.Critical)
+
+	cert := issueWithExtensions(t, []pkix.Extension{ext})
+	assert.Equal(t, []string{"test.localhost"}, cert.DNSNames)
+	require.Len(t, cert.IPAddresses, 1)
+	assert.True(t, cert.IPAddresses[0].Equal(net.IPv4(127, 0, 0, 1)))
+	assert.Equal(t, []string{"test@test.localhost"}, cert.EmailAddresses)
+	require.Len(t, cert.URIs, 1)
+	assert.Equal(t, "spiffe://test.localhost/x", cert.URIs[0].String())
+}
+
+func TestBuildSanExtensionEncodesValuesAsIs(t *testing.T) {
+	// Neither a valid IA5String nor a valid DNS name, and a tag that isn't a GeneralName form at all
+	ext, err := BuildSanExtension(true, []GeneralName{DnsName("bücher\x00.localhost"), {Type: 12, Value: []byte{1, 2}}})
+	require.NoError(t, err)
+	assert.True(t, ext.Critical)
+
+	var names []asn1.RawValue
+	rest, err := asn1.Unmarshal(ext.Value, &names)
+	require.NoError(t, err)
+	assert.Empty(t, rest)
+	require.Len(t, names, 2)
+	assert.Equal(t, asn1.ClassContextSpecific, names[0].Class)
+	assert.Equal(t, NAME_TYPE_DNS, names[0].Tag)
+	assert.False(t, names[0].IsCompound)
+	assert.Equal(t, []byte("bücher\x00.localhost"), names[0].Bytes)
+	assert.Equal(t, 12, names[1].Tag)
+	assert.Equal(t, []byte{1, 2}, names[1].Bytes)
+}
+
+func TestBuildNameConstraintsExtension(t *testing.T) {
+	_, ipRange, err := net.ParseCIDR("127.0.0.0/24")
+	require.NoError(t, err)
+	_, ipv6Range, err := net.ParseCIDR("::1/128")
+	require.NoError(t, err)
+	ext, err := BuildNameConstraintsExtension(true,
+		[]GeneralName{DnsName("localhost"), IpRange(ipRange), {Type: NAME_TYPE_EMAIL, Value: []byte(".localhost")}},
+		[]GeneralName{DnsName("bad.localhost"), IpRange(ipv6Range), UriName(".example.com")})
+	require.NoError(t, err)
+	assert.Equal(t, oidExtensionNameConstraints, ext.Id)
+
+	cert := issueWithExtensions(t, []pkix.Extension{ext})
+	assert.True(t, cert.PermittedDNSDomainsCritical)
+	assert.Equal(t, []string{"localhost"}, cert.PermittedDNSDomains)
+	require.Len(t, cert.PermittedIPRanges, 1)
+	assert.Equal(t, ipRange.String(), cert.PermittedIPRanges[0].String())
+	assert.Equal(t, []string{".localhost"}, cert.PermittedEmailAddresses)
+	assert.Equal(t, []string{"bad.localhost"}, cert.ExcludedDNSDomains)
+	require.Len(t, cert.ExcludedIPRanges, 1)
+	assert.Equal(t, ipv6Range.String(), cert.ExcludedIPRanges[0].String())
+	assert.Equal(t, []string{".example.com"}, cert.ExcludedURIDomains)
+}
+
+func TestBuildNameConstraintsExtensionLeavesOutEmptySubtrees(t *testing.T) {
+	ext, err := BuildNameConstraintsExtension(true, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x30, 0x00}, ext.Value)
+
+	ext, err = BuildNameConstraintsExtension(true, nil, []GeneralName{DnsName("localhost")})
+	require.NoError(t, err)
+	var subtrees []asn1.RawValue
+	_, err = asn1.Unmarshal(ext.Value, &subtrees)
+	require.NoError(t, err)
+	require.Len(t, subtrees, 1)
+	// Only the excludedSubtrees, [1]
+	assert.Equal(t, 1, subtrees[0].Tag)
+	assert.True(t, subtrees[0].IsCompound)
+}
+
+func TestDirectoryName(t *testing.T) {
+	name := pkix.Name{Organization: []string{SUBJECT_ORGANIZATION}, OrganizationalUnit: []string{"valid"}}
+	subtree, err := DirectoryName(name)
+	require.NoError(t, err)
+	ext, err := BuildNameConstraintsExtension(true, []GeneralName{subtree}, nil)
+	require.NoError(t, err)
+
+	// NameConstraints -> permittedSubtrees -> GeneralSubtree -> base
+	var constraints []asn1.RawValue
+	_, err = asn1.Unmarshal(ext.Value, &constraints)
+	require.NoError(t, err)
+	require.Len(t, constraints, 1)
+	var generalSubtrees []struct{ Base asn1.RawValue }
+	_, err = asn1.UnmarshalWithParams(constraints[0].FullBytes, &generalSubtrees, "tag:0")
+	require.NoError(t, err)
+	require.Len(t, generalSubtrees, 1)
+	base := generalSubtrees[0].Base
+	assert.Equal(t, asn1.ClassContextSpecific, base.Class)
+	assert.Equal(t, NAME_TYPE_DIRECTORY_NAME, base.Tag)
+	// directoryName is explicitly tagged, so it's constructed and wraps the Name
+	assert.True(t, base.IsCompound)
+	var rdns pkix.RDNSequence
+	_, err = asn1.Unmarshal(base.Bytes, &rdns)
+	require.NoError(t, err)
+	var parsed pkix.Name
+	parsed.FillFromRDNSequence(&rdns)
+	assert.Equal(t, name.Organization, parsed.Organization)
+	assert.Equal(t, name.OrganizationalUnit, parsed.OrganizationalUnit)
+}
+
+func TestIpRange(t *testing.T) {
+	_, ipRange, err := net.ParseCIDR("127.0.0.0/24")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{127, 0, 0, 0, 255, 255, 255, 0}, IpRange(ipRange).Value)
+
+	_, ipv6Range, err := net.ParseCIDR("fd00::/8")
+	require.NoError(t, err)
+	value := IpRange(ipv6Range).Value
+	assert.Len(t, value, 32)
+	assert.Equal(t, byte(0xfd), value[0])
+	assert.Equal(t, byte(0xff), value[16])
+	assert.Equal(t, byte(0), value[17])
+}
+
+func TestMoveNameConstraintsToExtension(t *testing.T) {
+	_, ipRange, err := net.ParseCIDR("127.0.0.0/24")
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		PermittedDNSDomainsCritical: true,
+		PermittedDNSDomains:         []string{"localhost"},
+		PermittedIPRanges:           []*net.IPNet{ipRange},
+		ExcludedEmailAddresses:      []string{"test@bad.localhost"},
+		ExcludedURIDomains:          []string{".example.com"},
+	}
+	directoryName, err := DirectoryName(pkix.Name{OrganizationalUnit: []string{"valid"}})
+	require.NoError(t, err)
+	require.NoError(t, MoveNameConstraintsToExtension(template, []GeneralName{directoryName}, nil))
+
+	assert.Empty(t, template.PermittedDNSDomains)
+	assert.Empty(t, template.PermittedIPRanges)
+	assert.Empty(t, template.ExcludedEmailAddresses)
+	assert.Empty(t, template.ExcludedURIDomains)
+	require.Len(t, template.ExtraExtensions, 1)
+	expected, err := BuildNameConstraintsExtension(true,
+		[]GeneralName{DnsName("localhost"), IpRange(ipRange), directoryName},
+		[]GeneralName{{Type: NAME_TYPE_EMAIL, Value: []byte("test@bad.localhost")}, UriName(".example.com")})
+	require.NoError(t, err)
+	assert.Equal(t, expected, template.ExtraExtensions[0])
+}
+
+func TestCreateUnparsedCaCert(t *testing.T) {
+	root, rootKey, err := GenerateSelfSignedCert("root")
+	require.NoError(t, err)
+	// A DNS constraint that isn't an IA5String, which Go refuses to parse
+	ncExt, err := BuildNameConstraintsExtension(true, []GeneralName{DnsName("bücher.localhost")}, nil)
+	require.NoError(t, err)
+	ca, caKey, err := CreateUnparsedCaCert(&x509.Certificate{
+		SerialNumber:          RandomSerial(),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             GetNotBefore(),
+		NotAfter:              GetNotAfter(false),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		ExtraExtensions:       []pkix.Extension{ncExt},
+	}, root, rootKey)
+	require.NoError(t, err)
+	_, err = x509.ParseCertificate(ca.Raw)
+	assert.Error(t, err)
+	assert.Len(t, ca.SubjectKeyId, 20)
+	assert.Equal(t, caKey.Public(), ca.PublicKey)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	leafBytes, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: RandomSerial(),
+		NotBefore:    GetNotBefore(),
+		NotAfter:     GetNotAfter(false),
+		DNSNames:     []string{"test.localhost"},
+	}, ca, leafKey.Public(), caKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(leafBytes)
+	require.NoError(t, err)
+	assert.Equal(t, ca.SubjectKeyId, leaf.AuthorityKeyId)
+	assert.Equal(t, "ca", leaf.Issuer.CommonName)
+	assert.NoError(t, ca.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature))
+}
@@ -29,13 +29,17 @@ type suiteExport struct {
 }
 
 type testCaseExport struct {
-	Id               uint     `json:"id"`
-	Suite            string   `json:"suite"`
-	Certificates     [][]byte `json:"certificates"`
-	Hostname         string   `json:"hostname"`
-	RequiredFeatures []string `json:"requiredFeatures"`
-	Expected         string   `json:"expected"`
-	FailureIsWarning bool     `json:"failureIsWarning"`
+	Id               uint              `json:"id"`
+	Suite            string            `json:"suite"`
+	Certificates     [][]byte          `json:"certificates"`
+	AiaResources     map[string][]byte `json:"aiaResources,omitempty"`
+	TrustAnchors     [][]byte          `json:"trustAnchors,omitempty"`
+	Intermediates    [][]byte          `json:"intermediates,omitempty"`
+	Hostname         string            `json:"hostname"`
+	UriIdentity      string            `json:"uriIdentity,omitempty"`
+	RequiredFeatures []string          `json:"requiredFeatures"`
+	Expected         string            `json:"expected"`
+	FailureIsWarning bool              `json:"failureIsWarning"`
 }
 
 func exportTests(args []string) error {
@@ -48,6 +52,8 @@ func exportTests(args []string) error {
 	flagSet.StringVar(&outputPath, "out", "", "Write to the given file instead of stdout.")
 	var rootCa string
 	flagSet.StringVar(&rootCa, "rootCa", "", "Use the given path as the root CA instead of generating an ephemeral root CA. If the file doesn't exist, a CA will generated and saved to the file.")
+	var aiaBaseUrl string
+	flagSet.StringVar(&aiaBaseUrl, "aiaBaseUrl", test_case.DEFAULT_AIA_BASE_URL, "The URL that exported aiaResources will be hosted under. Used in the caIssuers URLs of generated certificates.")
 
 	err := flagSet.Parse(args)
 	if err != nil {
@@ -83,6 +89,21 @@ func exportTests(args []string) error {
 			continue
 		}
 		provider := suites.GetProvider(suiteName)
+		sanityCheckTestCaseId, err := provider.GetSanityCheckTestCase()
+		if err != nil {
+			return err
+		}
+		sanityCheckTestCase, err := provider.GetTestCase(sanityCheckTestCaseId)
+		if err != nil {
+			return err
+		}
+		if test_case.RequiresHandshake(sanityCheckTestCase) {
+			// The exported certificates alone aren't enough to run these tests
+			if suite != "" {
+				return fmt.Errorf("suite %s requires a TLS handshake with the test server and can't be exported", suiteName)
+			}
+			continue
+		}
 
 		suiteExport := new(suiteExport)
 		suiteExport.Features = make([]string, 0)
@@ -112,12 +133,28 @@ func exportTests(args []string) error {
 			testCaseExport := new(testCaseExport)
 			testCaseExport.Id = i
 			testCaseExport.Suite = provider.Name()
-			certs, err := testCase.GetCertificates(rootCert, rootKey)
+			artifacts, err := suites.GetTestCaseArtifacts(testCase, aiaBaseUrl)
 			if err != nil {
 				return err
 			}
-			testCaseExport.Certificates = certs.Certificate
+			testCaseExport.Certificates = artifacts.Certificate.Certificate
+			// Only list the trust anchors for test cases that trust something other than the suite's trust root
+			if len(artifacts.TrustAnchors) != 1 || artifacts.TrustAnchors[0] != rootCert {
+				for _, cert := range artifacts.TrustAnchors {
+					testCaseExport.TrustAnchors = append(testCaseExport.TrustAnchors, cert.Raw)
+				}
+			}
+			for _, cert := range artifacts.Intermediates {
+				testCaseExport.Intermediates = append(testCaseExport.Intermediates, cert.Raw)
+			}
+			if len(artifacts.AiaResources) > 0 {
+				testCaseExport.AiaResources = make(map[string][]byte)
+				for path, resource := range artifacts.AiaResources {
+					testCaseExport.AiaResources[path] = resource.Body
+				}
+			}
 			testCaseExport.Hostname = testCase.GetHostname()
+			testCaseExport.UriIdentity = test_case.GetUriIdentity(testCase)
 			testCaseExport.RequiredFeatures = make([]string, 0)
 			for _, feature := range testCase.RequiredFeatures() {
 				testCaseExport.RequiredFeatures = append(testCaseExport.RequiredFeatures, provider.DescribeFeature(feature))
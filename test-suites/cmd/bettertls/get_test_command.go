@@ -11,7 +11,7 @@ import (
 func getTest(args []string) error {
 	flagSet := flag.NewFlagSet("get-test", flag.ContinueOnError)
 	var providerName string
-	flagSet.StringVar(&providerName, "suite", "", "Suite to run. One of \"pathbuilding\", \"nameconstraints\".")
+	flagSet.StringVar(&providerName, "suite", "", "Suite to run. One of \"pathbuilding\", \"nameconstraints\", \"pathcomplexity\", \"aia\", \"trustanchor\", \"idn\", \"injection\", \"spiffe\", \"namechaining\", \"possession\".")
 	var testId uint
 	flagSet.UintVar(&testId, "testId", 0, "Test id to describe.")
 
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"crypto"
+	"crypto/tls"
 	"crypto/x509"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/Netflix/bettertls/test-suites/certutil"
@@ -18,11 +22,32 @@ func runServer(args []string) error {
 	flagSet := flag.NewFlagSet("server", flag.ContinueOnError)
 	var rootCa string
 	flagSet.StringVar(&rootCa, "rootCa", "", "Use the given path as the root CA instead of generating an ephemeral root CA. If the file doesn't exist, a CA will generated and saved to the file.")
+	var outputDir string
+	flagSet.StringVar(&outputDir, "outputDir", "", "Directory to which test results uploaded to /results will be written. /results is disabled if not set.")
+	var bindAddress string
+	flagSet.StringVar(&bindAddress, "bindAddress", "", "Address to listen on, e.g. \"127.0.0.1\". Listens on all interfaces if unspecified.")
+	var http2 bool
+	flagSet.BoolVar(&http2, "http2", false, "Offer HTTP/2 (ALPN \"h2\") on the TLS port and serve the gRPC health service over it.")
+	var quic bool
+	flagSet.BoolVar(&quic, "quic", false, "Also serve HTTP/3 over QUIC on UDP port 8443.")
+	var dnsPort uint
+	flagSet.UintVar(&dnsPort, "dnsPort", 0, "Run a DNS responder on this port of the loopback address (UDP and TCP) that resolves the names in --dnsZone and --dnsNames to the server's loopback address. Disabled if 0.")
+	var dnsZone string
+	flagSet.StringVar(&dnsZone, "dnsZone", test_executor.DefaultDnsZone, "Zone whose names (and the zone itself) the DNS responder resolves.")
+	var dnsNames string
+	flagSet.StringVar(&dnsNames, "dnsNames", "", "Comma-separated names outside of --dnsZone for the DNS responder to resolve.")
+	var startTls bool
+	flagSet.BoolVar(&startTls, "starttls", false, "Also listen for SMTP (8025), IMAP (8143), POP3 (8110), LDAP (8389) and PostgreSQL (8432) clients, and upgrade their connections to TLS.")
+	var keyLogFile string
+	flagSet.StringVar(&keyLogFile, "keylog", "", "File to append TLS secrets to (in the NSS key log format, as for SSLKEYLOGFILE), so that captured traffic can be decrypted.")
 
 	err := flagSet.Parse(args)
 	if err != nil {
 		return err
 	}
+	if dnsPort > 65535 {
+		return fmt.Errorf("invalid --dnsPort: %d", dnsPort)
+	}
 
 	var rootCert *x509.Certificate
 	var rootKey crypto.Signer
@@ -43,19 +68,55 @@ func runServer(args []string) error {
 		return err
 	}
 
-	server, err := test_executor.StartServer(suites,
-		log.New(logrus.StandardLogger().WriterLevel(logrus.ErrorLevel), "", 0),
-		8080, 8443)
+	var startTlsPorts map[test_executor.StartTlsProtocol]uint16
+	if startTls {
+		startTlsPorts = make(map[test_executor.StartTlsProtocol]uint16)
+		for _, protocol := range test_executor.ALL_STARTTLS_PROTOCOLS {
+			startTlsPorts[protocol] = protocol.DefaultPort()
+		}
+	}
+
+	var dnsNameList []string
+	if dnsNames != "" {
+		dnsNameList = strings.Split(dnsNames, ",")
+	}
+
+	var tlsConfig *tls.Config
+	if keyLogFile != "" {
+		keyLog, err := os.OpenFile(keyLogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		defer keyLog.Close()
+		tlsConfig = &tls.Config{KeyLogWriter: keyLog}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	server, err := test_executor.StartServerWithOptions(ctx, suites, &test_executor.ServerOptions{
+		BindAddress:   bindAddress,
+		PlaintextPort: 8080,
+		TlsPort:       8443,
+		Http2:         http2,
+		Quic:          quic,
+		QuicPort:      8443,
+		ErrorLog:      log.New(logrus.StandardLogger().WriterLevel(logrus.ErrorLevel), "", 0),
+		ResultsDir:    outputDir,
+		StartTlsPorts: startTlsPorts,
+		Dns:           dnsPort != 0,
+		DnsPort:       uint16(dnsPort),
+		DnsZone:       dnsZone,
+		DnsNames:      dnsNameList,
+		TlsConfig:     tlsConfig,
+	})
 	if err != nil {
 		return err
 	}
 	defer server.Stop()
 
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-
 	logrus.Infof("Now serving...")
-	<-sigs
+	<-ctx.Done()
 	logrus.Infof("Clean shutdown.")
 
 	return nil
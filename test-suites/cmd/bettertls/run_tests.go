@@ -1,29 +1,17 @@
 package main
 
 import (
-	"bytes"
-	"compress/gzip"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/Netflix/bettertls/test-suites/impltests"
 	int_set "github.com/Netflix/bettertls/test-suites/int-set"
 	test_executor "github.com/Netflix/bettertls/test-suites/test-executor"
-	"github.com/golang/protobuf/proto"
 	"github.com/schollz/progressbar/v3"
+	"io"
 	"os"
 	"path/filepath"
-	"time"
 )
 
-type ImplementationTestResults struct {
-	ImplementationInfo string            `json:"implementation"`
-	VersionInfo        string            `json:"version"`
-	Date               time.Time         `json:"date"`
-	BetterTlsRevision  string            `json:"betterTlsRevision"`
-	Suites             map[string][]byte `json:"suites"`
-}
-
 func runTests(args []string) error {
 	flagSet := flag.NewFlagSet("run-tests", flag.ContinueOnError)
 	var implementation string
@@ -34,6 +22,10 @@ func runTests(args []string) error {
 	flagSet.Var(testCases, "testCase", "Run only the given test case(s) in the suite instead of all tests. Requires --suite to be specified as well. Use \"123,456-789\" syntax to include a range or set of cases.")
 	var outputDir string
 	flagSet.StringVar(&outputDir, "outputDir", ".", "Directory to which test results will be written.")
+	var keyLogFile string
+	flagSet.StringVar(&keyLogFile, "keylog", "", "File to append the test server's TLS secrets to (in the NSS key log format, as for SSLKEYLOGFILE).")
+	var captureDir string
+	flagSet.StringVar(&captureDir, "captureDir", "", "Directory to which a pcapng capture of each test whose result disagrees with the manifest will be written, under a subdirectory for the implementation. Only implementations that connect to the test server over TCP are captured.")
 
 	err := flagSet.Parse(args)
 	if err != nil {
@@ -58,6 +50,16 @@ func runTests(args []string) error {
 		runners = []impltests.ImplementationRunner{runner}
 	}
 
+	var keyLog io.Writer
+	if keyLogFile != "" {
+		f, err := os.OpenFile(keyLogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		keyLog = f
+	}
+
 	for _, runner := range runners {
 		err := runner.Initialize()
 		if err != nil {
@@ -68,6 +70,7 @@ func runTests(args []string) error {
 		ctx := &test_executor.ExecutionContext{
 			RunOnlySuite: suite,
 			RunOnlyTests: testCases,
+			KeyLogWriter: keyLog,
 			OnStartSuite: func(suite string, testCount uint) {
 				bar = progressbar.Default(int64(testCount), runner.Name()+"/"+suite)
 				progressbar.OptionSetItsString("tests")(bar)
@@ -77,50 +80,24 @@ func runTests(args []string) error {
 			},
 		}
 
+		if captureDir != "" {
+			ctx.CaptureDir = filepath.Join(captureDir, runner.Name())
+		}
+
 		version := runner.GetVersion()
 		suiteResults, err := runner.RunTests(ctx)
 		if err != nil {
 			return fmt.Errorf("error running tests: %v", err)
 		}
 
-		suiteResultsEncoded := make(map[string][]byte, len(suiteResults))
-		for suiteName, result := range suiteResults {
-			resultBytes, err := proto.Marshal(result)
-			if err != nil {
-				return fmt.Errorf("failed to proto-marshal results: %v", err)
-			}
-			buffer := bytes.NewBuffer(nil)
-			gz := gzip.NewWriter(buffer)
-			_, err = gz.Write(resultBytes)
-			if err != nil {
-				return fmt.Errorf("failed to gzip results: %v", err)
-			}
-			if err = gz.Flush(); err != nil {
-				return fmt.Errorf("failed to gzip results: %v", err)
-			}
-			if err = gz.Close(); err != nil {
-				return fmt.Errorf("failed to gzip results: %v", err)
-			}
-			suiteResultsEncoded[suiteName] = buffer.Bytes()
-		}
-
-		results := &ImplementationTestResults{
-			ImplementationInfo: runner.Name(),
-			VersionInfo:        version,
-			Date:               time.Now(),
-			BetterTlsRevision:  test_executor.GetBuildRevision(),
-			Suites:             suiteResultsEncoded,
-		}
-
-		f, err := os.OpenFile(filepath.Join(outputDir, fmt.Sprintf("%s_results.json", runner.Name())),
-			os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		results, err := test_executor.NewImplementationTestResults(runner.Name(), version, suiteResults)
 		if err != nil {
-			return fmt.Errorf("failed to open file for saving results: %v", err)
+			return err
 		}
-		err = json.NewEncoder(f).Encode(results)
-		f.Close()
+
+		_, err = results.Save(outputDir)
 		if err != nil {
-			return fmt.Errorf("failed to save results: %v", err)
+			return err
 		}
 
 		if summary, err := buildSummary(results, manifest); err == nil {
@@ -5,6 +5,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+
+	test_executor "github.com/Netflix/bettertls/test-suites/test-executor"
 )
 
 func showResults(args []string) error {
@@ -25,7 +27,7 @@ func showResults(args []string) error {
 		return fmt.Errorf("missing required parameter: --resultsFile")
 	}
 
-	var manifest *Manifest
+	var manifest *test_executor.Manifest
 	if manifestPath == "" {
 		manifest, err = buildManifest()
 		if err != nil {
@@ -37,7 +39,7 @@ func showResults(args []string) error {
 			return err
 		}
 		defer f.Close()
-		manifest = new(Manifest)
+		manifest = new(test_executor.Manifest)
 		err = json.NewDecoder(f).Decode(manifest)
 		if err != nil {
 			return err
@@ -49,7 +51,7 @@ func showResults(args []string) error {
 		return err
 	}
 	defer f.Close()
-	results := new(ImplementationTestResults)
+	results := new(test_executor.ImplementationTestResults)
 	err = json.NewDecoder(f).Decode(results)
 	if err != nil {
 		return fmt.Errorf("failed to parse results file: %v", err)
@@ -8,6 +8,7 @@ import (
 	test_executor "github.com/Netflix/bettertls/test-suites/test-executor"
 	"github.com/golang/protobuf/proto"
 	"io/ioutil"
+	"time"
 )
 
 type resultsSummary struct {
@@ -25,9 +26,11 @@ type suiteSummary struct {
 	SkippedTests       []uint `json:"skippedTests"`
 	FalsePositiveTests []uint `json:"falsePositiveTests"`
 	FalseNegativeTests []uint `json:"falseNegativeTests"`
+
+	TestDurationsMs []uint32 `json:"testDurationsMs,omitempty"`
 }
 
-func buildSummary(results *ImplementationTestResults, manifest *Manifest) (*resultsSummary, error) {
+func buildSummary(results *test_executor.ImplementationTestResults, manifest *test_executor.Manifest) (*resultsSummary, error) {
 	summary := &resultsSummary{
 		Implementation: results.ImplementationInfo,
 		Version:        results.VersionInfo,
@@ -90,6 +93,8 @@ func buildSummary(results *ImplementationTestResults, manifest *Manifest) (*resu
 			}
 		}
 
+		suiteSummary.TestDurationsMs = suiteResults.TestCaseDurationsMs
+
 		summary.SuiteSummary[suiteName] = suiteSummary
 	}
 
@@ -125,6 +130,16 @@ func printSummary(summary *resultsSummary) error {
 		if len(suiteSummary.FalseNegativeTests) > 0 {
 			fmt.Printf("    False negatives: %d\n", len(suiteSummary.FalseNegativeTests))
 		}
+		slowestTest := 0
+		for testCaseId, duration := range suiteSummary.TestDurationsMs {
+			if duration > suiteSummary.TestDurationsMs[slowestTest] {
+				slowestTest = testCaseId
+			}
+		}
+		// Skipped and uploaded test cases have no duration
+		if len(suiteSummary.TestDurationsMs) > 0 && suiteSummary.TestDurationsMs[slowestTest] > 0 {
+			fmt.Printf("    Slowest test: %d (%v)\n", slowestTest, time.Duration(suiteSummary.TestDurationsMs[slowestTest])*time.Millisecond)
+		}
 
 		fmt.Println()
 	}
@@ -0,0 +1,220 @@
+package idn
+
+import (
+	"fmt"
+
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+)
+
+const (
+	SANITY_CHECK_TEST_CASE uint = iota
+	UNICODE_HOSTNAME_FEATURE_TEST_CASE
+	NAME_CONSTRAINTS_FEATURE_TEST_CASE
+)
+
+const (
+	// The client accepts a Unicode hostname and converts it to its A-label form before matching it
+	FEATURE_UNICODE_HOSTNAME test_case.Feature = iota
+	FEATURE_NAME_CONSTRAINTS
+)
+
+type TestCaseProvider struct {
+	testCases []test_case.TestCase
+}
+
+func NewTestCaseProvider() *TestCaseProvider {
+	testCases := []test_case.TestCase{
+		SANITY_CHECK_TEST_CASE: &IdnTestCase{
+			Hostname: "localhost",
+			DnsSans:  []string{"localhost"},
+			Expected: test_case.EXPECTED_RESULT_PASS,
+		},
+		UNICODE_HOSTNAME_FEATURE_TEST_CASE: &IdnTestCase{
+			Hostname: U_LABEL_HOSTNAME,
+			DnsSans:  []string{A_LABEL_HOSTNAME},
+			Expected: test_case.EXPECTED_RESULT_PASS,
+		},
+		NAME_CONSTRAINTS_FEATURE_TEST_CASE: &IdnTestCase{
+			Hostname:          A_LABEL_HOSTNAME,
+			DnsSans:           []string{A_LABEL_HOSTNAME},
+			PermittedDnsTrees: []string{A_LABEL_HOSTNAME},
+			Expected:          test_case.EXPECTED_RESULT_PASS,
+		},
+	}
+
+	testCases = append(testCases,
+		&IdnTestCase{
+			Hostname: A_LABEL_HOSTNAME,
+			DnsSans:  []string{A_LABEL_HOSTNAME},
+			Expected: test_case.EXPECTED_RESULT_PASS,
+		},
+		// dNSName is an IA5String and must hold A-labels. A raw U-label should never match, no matter how the
+		// client spells the hostname.
+		&IdnTestCase{
+			Hostname: A_LABEL_HOSTNAME,
+			DnsSans:  []string{U_LABEL_HOSTNAME},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		&IdnTestCase{
+			Hostname: U_LABEL_HOSTNAME,
+			DnsSans:  []string{U_LABEL_HOSTNAME},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		// DNS names are compared case-insensitively, including the "xn--" prefix
+		&IdnTestCase{
+			Hostname: A_LABEL_HOSTNAME,
+			DnsSans:  []string{"XN--BCHER-KVA.localhost"},
+			Expected: test_case.EXPECTED_RESULT_PASS,
+		},
+		&IdnTestCase{
+			Hostname: "LOCALHOST",
+			DnsSans:  []string{"localhost"},
+			Expected: test_case.EXPECTED_RESULT_PASS,
+		},
+		// UTS #46 maps uppercase U-labels and the ideographic and fullwidth full stops before conversion. Clients
+		// that apply stricter IDNA2008 processing may reject these hostnames outright.
+		&IdnTestCase{
+			Hostname: "BÜCHER.localhost",
+			DnsSans:  []string{A_LABEL_HOSTNAME},
+			Expected: test_case.EXPECTED_RESULT_SOFT_PASS,
+		},
+		&IdnTestCase{
+			Hostname: "bücher。localhost",
+			DnsSans:  []string{A_LABEL_HOSTNAME},
+			Expected: test_case.EXPECTED_RESULT_SOFT_PASS,
+		},
+		&IdnTestCase{
+			Hostname: "bücher．localhost",
+			DnsSans:  []string{A_LABEL_HOSTNAME},
+			Expected: test_case.EXPECTED_RESULT_SOFT_PASS,
+		},
+		// Alternative label separators are only mapped in hostnames, never in certificates
+		&IdnTestCase{
+			Hostname: A_LABEL_HOSTNAME,
+			DnsSans:  []string{"xn--bcher-kva．localhost"},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		// IDNA2008 converts "faß" to "xn--fa-hia" while IDNA2003 converts it to "fass". Either is tolerated, but
+		// IDNA2008 is preferred.
+		&IdnTestCase{
+			Hostname: DEVIATION_U_LABEL_HOSTNAME,
+			DnsSans:  []string{DEVIATION_IDNA2008_HOSTNAME},
+			Expected: test_case.EXPECTED_RESULT_SOFT_PASS,
+		},
+		&IdnTestCase{
+			Hostname: DEVIATION_U_LABEL_HOSTNAME,
+			DnsSans:  []string{DEVIATION_IDNA2003_HOSTNAME},
+			Expected: test_case.EXPECTED_RESULT_SOFT_FAIL,
+		},
+		// Once converted, the two forms are distinct names
+		&IdnTestCase{
+			Hostname: DEVIATION_IDNA2008_HOSTNAME,
+			DnsSans:  []string{DEVIATION_IDNA2003_HOSTNAME},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		// Wildcards may not be part of an A-label (RFC 6125 section 7.2)
+		&IdnTestCase{
+			Hostname: A_LABEL_HOSTNAME,
+			DnsSans:  []string{"xn--bcher*.localhost"},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+	)
+
+	// Name constraints are matched against the A-label form of the hostname
+	testCases = append(testCases,
+		&IdnTestCase{
+			Hostname:          U_LABEL_HOSTNAME,
+			DnsSans:           []string{A_LABEL_HOSTNAME},
+			PermittedDnsTrees: []string{A_LABEL_HOSTNAME},
+			Expected:          test_case.EXPECTED_RESULT_PASS,
+		},
+		&IdnTestCase{
+			Hostname:         A_LABEL_HOSTNAME,
+			DnsSans:          []string{A_LABEL_HOSTNAME},
+			ExcludedDnsTrees: []string{A_LABEL_HOSTNAME},
+			Expected:         test_case.EXPECTED_RESULT_FAIL,
+		},
+		&IdnTestCase{
+			Hostname:         U_LABEL_HOSTNAME,
+			DnsSans:          []string{A_LABEL_HOSTNAME},
+			ExcludedDnsTrees: []string{A_LABEL_HOSTNAME},
+			Expected:         test_case.EXPECTED_RESULT_FAIL,
+		},
+		// A raw U-label in a constraint can't match any valid dNSName. Rejecting the constraint outright is also
+		// reasonable, so these are soft.
+		&IdnTestCase{
+			Hostname:          A_LABEL_HOSTNAME,
+			DnsSans:           []string{A_LABEL_HOSTNAME},
+			PermittedDnsTrees: []string{U_LABEL_HOSTNAME},
+			Expected:          test_case.EXPECTED_RESULT_SOFT_FAIL,
+		},
+		&IdnTestCase{
+			Hostname:         A_LABEL_HOSTNAME,
+			DnsSans:          []string{A_LABEL_HOSTNAME},
+			ExcludedDnsTrees: []string{U_LABEL_HOSTNAME},
+			Expected:         test_case.EXPECTED_RESULT_SOFT_PASS,
+		},
+		&IdnTestCase{
+			Hostname:          U_LABEL_HOSTNAME,
+			DnsSans:           []string{A_LABEL_HOSTNAME},
+			PermittedDnsTrees: []string{"localhost"},
+			Expected:          test_case.EXPECTED_RESULT_PASS,
+		},
+		&IdnTestCase{
+			Hostname:          A_LABEL_HOSTNAME,
+			DnsSans:           []string{A_LABEL_HOSTNAME},
+			PermittedDnsTrees: []string{"XN--BCHER-KVA.localhost"},
+			Expected:          test_case.EXPECTED_RESULT_PASS,
+		},
+		&IdnTestCase{
+			Hostname:         U_LABEL_HOSTNAME,
+			DnsSans:          []string{A_LABEL_HOSTNAME},
+			ExcludedDnsTrees: []string{"XN--BCHER-KVA.LOCALHOST"},
+			Expected:         test_case.EXPECTED_RESULT_FAIL,
+		},
+	)
+
+	return &TestCaseProvider{
+		testCases: testCases,
+	}
+}
+
+func (p *TestCaseProvider) Name() string {
+	return "idn"
+}
+
+func (p *TestCaseProvider) GetTestCaseCount() (uint, error) {
+	return uint(len(p.testCases)), nil
+}
+
+func (p *TestCaseProvider) GetTestCase(index uint) (test_case.TestCase, error) {
+	return p.testCases[index], nil
+}
+
+func (p *TestCaseProvider) GetSanityCheckTestCase() (uint, error) {
+	return SANITY_CHECK_TEST_CASE, nil
+}
+
+func (p *TestCaseProvider) GetFeatures() []test_case.Feature {
+	return []test_case.Feature{FEATURE_UNICODE_HOSTNAME, FEATURE_NAME_CONSTRAINTS}
+}
+
+func (p *TestCaseProvider) DescribeFeature(feature test_case.Feature) string {
+	switch feature {
+	case FEATURE_UNICODE_HOSTNAME:
+		return "UNICODE_HOSTNAME"
+	case FEATURE_NAME_CONSTRAINTS:
+		return "NAME_CONSTRAINTS"
+	}
+	panic(fmt.Errorf("unsupported feature: %d", feature))
+}
+
+func (p *TestCaseProvider) GetTestCasesForFeature(feature test_case.Feature) ([]uint, error) {
+	switch feature {
+	case FEATURE_UNICODE_HOSTNAME:
+		return []uint{UNICODE_HOSTNAME_FEATURE_TEST_CASE}, nil
+	case FEATURE_NAME_CONSTRAINTS:
+		return []uint{NAME_CONSTRAINTS_FEATURE_TEST_CASE}, nil
+	}
+	return nil, fmt.Errorf("invalid feature: %v", feature)
+}
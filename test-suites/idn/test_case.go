@@ -0,0 +1,127 @@
+package idn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"unicode/utf8"
+
+	"github.com/Netflix/bettertls/test-suites/certutil"
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+)
+
+// "bücher" is the usual example of a label with an IDNA A-label form
+const U_LABEL_HOSTNAME = "bücher.localhost"
+const A_LABEL_HOSTNAME = "xn--bcher-kva.localhost"
+
+// "faß" is converted to "fass" under IDNA2003 (and UTS #46 transitional processing), but kept as-is by IDNA2008
+const DEVIATION_U_LABEL_HOSTNAME = "faß.localhost"
+const DEVIATION_IDNA2008_HOSTNAME = "xn--fa-hia.localhost"
+const DEVIATION_IDNA2003_HOSTNAME = "fass.localhost"
+
+// An IdnTestCase has the client connect to Hostname, which may hold Unicode, and presents a leaf with the given
+// DNS SANs (encoded as-is, even if they aren't valid IA5Strings) issued by an ICA with the given DNS name constraints.
+type IdnTestCase struct {
+	Hostname          string
+	DnsSans           []string
+	PermittedDnsTrees []string `json:",omitempty"`
+	ExcludedDnsTrees  []string `json:",omitempty"`
+	Expected          test_case.ExpectedResult
+}
+
+func (t *IdnTestCase) ExpectedResult() test_case.ExpectedResult {
+	return t.Expected
+}
+
+func (t *IdnTestCase) GetHostname() string {
+	return t.Hostname
+}
+
+func isAscii(s string) bool {
+	return utf8.RuneCountInString(s) == len(s)
+}
+
+func (t *IdnTestCase) RequiredFeatures() []test_case.Feature {
+	var requiredFeatures []test_case.Feature
+	if !isAscii(t.Hostname) {
+		requiredFeatures = append(requiredFeatures, FEATURE_UNICODE_HOSTNAME)
+	}
+	if len(t.PermittedDnsTrees) > 0 || len(t.ExcludedDnsTrees) > 0 {
+		requiredFeatures = append(requiredFeatures, FEATURE_NAME_CONSTRAINTS)
+	}
+	return requiredFeatures
+}
+
+// dnsNames encodes DNS names without any validation, so they may hold raw UTF-8 (which x509.CreateCertificate refuses
+// to encode as an IA5String).
+func dnsNames(names []string) []certutil.GeneralName {
+	var generalNames []certutil.GeneralName
+	for _, name := range names {
+		generalNames = append(generalNames, certutil.DnsName(name))
+	}
+	return generalNames
+}
+
+func (t *IdnTestCase) GetCertificates(rootCert *x509.Certificate, rootKey crypto.Signer) (*tls.Certificate, error) {
+	var extensions []pkix.Extension
+	if len(t.PermittedDnsTrees) > 0 || len(t.ExcludedDnsTrees) > 0 {
+		ncExt, err := certutil.BuildNameConstraintsExtension(true, dnsNames(t.PermittedDnsTrees), dnsNames(t.ExcludedDnsTrees))
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, ncExt)
+	}
+	// Go refuses to parse an ICA with a raw U-label constraint
+	ica, icaKey, err := certutil.CreateUnparsedCaCert(&x509.Certificate{
+		SerialNumber: certutil.RandomSerial(),
+		Subject: pkix.Name{
+			CommonName:   "ica",
+			Organization: []string{certutil.SUBJECT_ORGANIZATION},
+			SerialNumber: certutil.RandomString(),
+		},
+		NotBefore:             certutil.GetNotBefore(),
+		NotAfter:              certutil.GetNotAfter(false),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		ExtraExtensions:       extensions,
+	}, rootCert, rootKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sanExt, err := certutil.BuildSanExtension(false, dnsNames(t.DnsSans))
+	if err != nil {
+		return nil, err
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	leafBytes, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: certutil.RandomSerial(),
+		Subject: pkix.Name{
+			Organization: []string{certutil.SUBJECT_ORGANIZATION},
+			SerialNumber: certutil.RandomString(),
+		},
+		NotBefore:             certutil.GetNotBefore(),
+		NotAfter:              certutil.GetNotAfter(false),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		ExtraExtensions:       []pkix.Extension{sanExt},
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+	}, ica, leafKey.Public(), icaKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{leafBytes, ica.Raw},
+		PrivateKey:  leafKey,
+	}, nil
+}
@@ -1,7 +1,6 @@
 package impltests
 
 import (
-	"fmt"
 	test_executor "github.com/Netflix/bettertls/test-suites/test-executor"
 )
 
@@ -27,7 +26,7 @@ func (b *BoringSslRunner) RunTests(ctx *test_executor.ExecutionContext) (map[str
 	return testExec(ctx, func(caPath string, hostname string, tlsPort uint) []string {
 		return []string{"bssl", "s_client",
 			"-root-certs", caPath,
-			"-connect", fmt.Sprintf("%s:%d", hostname, tlsPort),
+			"-connect", hostPort(hostname, tlsPort),
 		}
 	})
 }
@@ -1,15 +1,25 @@
 package impltests
 
 import (
-	"encoding/pem"
+	"bytes"
 	"fmt"
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
 	test_executor "github.com/Netflix/bettertls/test-suites/test-executor"
 	"io/ioutil"
+	"net"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// hostPort formats a hostname and port for dialing or for use in a URL, bracketing IPv6 addresses.
+func hostPort(hostname string, port uint) string {
+	return net.JoinHostPort(hostname, strconv.FormatUint(uint64(port), 10))
+}
+
 func execAndCapture(cmdParts ...string) (string, error) {
 	return execAndCaptureInDir("", cmdParts...)
 }
@@ -61,38 +71,179 @@ func testExec(ctx *test_executor.ExecutionContext, getCommand func(caPath string
 }
 
 func testExecDir(ctx *test_executor.ExecutionContext, workingDir string, getCommand func(caPath string, hostname string, tlsPort uint) []string) (map[string]*test_executor.SuiteTestResults, error) {
+	return testExecDirWithIntermediates(ctx, workingDir, func(caPath string, intermediatesPath string, hostname string, tlsPort uint) []string {
+		return getCommand(caPath, hostname, tlsPort)
+	})
+}
+
+// testExecWithIntermediates is like testExec, for implementations that can also be given untrusted intermediates
+// separately from the server's chain. intermediatesPath is empty for test cases that have none.
+func testExecWithIntermediates(ctx *test_executor.ExecutionContext, getCommand func(caPath string, intermediatesPath string, hostname string, tlsPort uint) []string) (map[string]*test_executor.SuiteTestResults, error) {
+	return testExecDirWithIntermediates(ctx, "", getCommand)
+}
+
+func testExecDirWithIntermediates(ctx *test_executor.ExecutionContext, workingDir string, getCommand func(caPath string, intermediatesPath string, hostname string, tlsPort uint) []string) (map[string]*test_executor.SuiteTestResults, error) {
+	return testExecTargets(ctx, workingDir, (*test_case.Artifacts).TrustAnchorsPem, nil, func(suites *test_executor.TestSuites, execTest func(target *test_executor.RemoteTestTarget) (bool, error)) (map[string]*test_executor.SuiteTestResults, error) {
+		return test_executor.ExecuteAllTestsRemoteTargets(ctx, suites, execTest)
+	}, getCommand)
+}
+
+// testExecWithIntermediatesInCaFile is like testExec, for implementations that can only be given a single CA file. The
+// test case's out-of-band intermediates are added to the CA file after its trust anchors, so it must only trust the
+// self-signed certificates in it.
+func testExecWithIntermediatesInCaFile(ctx *test_executor.ExecutionContext, getCommand func(caPath string, hostname string, tlsPort uint) []string) (map[string]*test_executor.SuiteTestResults, error) {
+	caPem := func(artifacts *test_case.Artifacts) []byte {
+		return append(artifacts.TrustAnchorsPem(), artifacts.IntermediatesPem()...)
+	}
+	return testExecTargets(ctx, "", caPem, nil, func(suites *test_executor.TestSuites, execTest func(target *test_executor.RemoteTestTarget) (bool, error)) (map[string]*test_executor.SuiteTestResults, error) {
+		return test_executor.ExecuteAllTestsRemoteTargets(ctx, suites, execTest)
+	}, func(caPath string, intermediatesPath string, hostname string, tlsPort uint) []string {
+		return getCommand(caPath, hostname, tlsPort)
+	})
+}
+
+// testExecStartTls is like testExec, for clients that connect with a STARTTLS protocol. port is the port of the
+// server's listener for that protocol. The command is given input on stdin, and only counts as having accepted the
+// server's certificate if its output has test_executor.STARTTLS_SUCCESS_MARKER, which the server only sends over TLS.
+func testExecStartTls(ctx *test_executor.ExecutionContext, protocol test_executor.StartTlsProtocol, input []byte, getCommand func(caPath string, hostname string, port uint) []string) (map[string]*test_executor.SuiteTestResults, error) {
+	check := &outputCheck{input: input, successMarker: test_executor.STARTTLS_SUCCESS_MARKER}
+	return testExecTargets(ctx, "", (*test_case.Artifacts).TrustAnchorsPem, check, func(suites *test_executor.TestSuites, execTest func(target *test_executor.RemoteTestTarget) (bool, error)) (map[string]*test_executor.SuiteTestResults, error) {
+		return test_executor.ExecuteAllTestsRemoteStartTlsTargets(ctx, suites, protocol, execTest)
+	}, func(caPath string, intermediatesPath string, hostname string, port uint) []string {
+		return getCommand(caPath, hostname, port)
+	})
+}
+
+// testExecQuic is like testExec, for HTTP/3 clients. port is the UDP port serving HTTP/3.
+func testExecQuic(ctx *test_executor.ExecutionContext, getCommand func(caPath string, hostname string, port uint) []string) (map[string]*test_executor.SuiteTestResults, error) {
+	return testExecTargets(ctx, "", (*test_case.Artifacts).TrustAnchorsPem, nil, func(suites *test_executor.TestSuites, execTest func(target *test_executor.RemoteTestTarget) (bool, error)) (map[string]*test_executor.SuiteTestResults, error) {
+		return test_executor.ExecuteAllTestsRemoteQuicTargets(ctx, suites, execTest)
+	}, func(caPath string, intermediatesPath string, hostname string, port uint) []string {
+		return getCommand(caPath, hostname, port)
+	})
+}
+
+// testExecProxy is like testExec, for clients that connect to the server through its CONNECT proxy rather than
+// resolving the test case's hostname. A test case only counts as accepted if the client's connection was tunneled.
+func testExecProxy(ctx *test_executor.ExecutionContext, getCommand func(caPath string, proxyUrl string, hostname string, tlsPort uint) []string) (map[string]*test_executor.SuiteTestResults, error) {
+	var proxyUrl string
+	return testExecTargets(ctx, "", (*test_case.Artifacts).TrustAnchorsPem, nil, func(suites *test_executor.TestSuites, execTest func(target *test_executor.RemoteTestTarget) (bool, error)) (map[string]*test_executor.SuiteTestResults, error) {
+		return test_executor.ExecuteAllTestsRemoteTargets(ctx, suites, func(target *test_executor.RemoteTestTarget) (bool, error) {
+			proxyUrl = target.ProxyUrl
+			accepted, err := execTest(target)
+			if err != nil || !accepted {
+				return accepted, err
+			}
+			if !proxyTunneled(target.Telemetry()) {
+				return false, fmt.Errorf("the client connected to the test server without going through the CONNECT proxy")
+			}
+			return true, nil
+		})
+	}, func(caPath string, intermediatesPath string, hostname string, tlsPort uint) []string {
+		return getCommand(caPath, proxyUrl, hostname, tlsPort)
+	})
+}
+
+// An outputCheck is for commands whose exit status alone doesn't show that they completed a TLS session with the
+// server.
+type outputCheck struct {
+	// Written to the command's stdin
+	input []byte
+	// Must be in the command's output (stdout or stderr) for it to count as having accepted the server's certificate
+	successMarker string
+}
+
+// testExecTargets runs a command for every test case that executeAllTests gives it. caPem gives the contents of the CA
+// file for a test case. If check is nil, the command accepted the server's certificate if it exits successfully.
+func testExecTargets(ctx *test_executor.ExecutionContext, workingDir string, caPem func(artifacts *test_case.Artifacts) []byte, check *outputCheck,
+	executeAllTests func(suites *test_executor.TestSuites, execTest func(target *test_executor.RemoteTestTarget) (bool, error)) (map[string]*test_executor.SuiteTestResults, error),
+	getCommand func(caPath string, intermediatesPath string, hostname string, tlsPort uint) []string) (map[string]*test_executor.SuiteTestResults, error) {
 	suites, err := test_executor.BuildTestSuites()
 	if err != nil {
 		return nil, err
 	}
 
-	tmpFile, err := ioutil.TempFile("", "")
+	caPath, err := createTempFile()
 	if err != nil {
 		return nil, err
 	}
-	_, err = tmpFile.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: suites.GetRootCert().Raw}))
-	tmpFile.Close()
+	defer os.Remove(caPath)
+	intermediatesPath, err := createTempFile()
 	if err != nil {
 		return nil, err
 	}
+	defer os.Remove(intermediatesPath)
 
-	caPath, err := filepath.Abs(tmpFile.Name())
-	if err != nil {
-		return nil, err
-	}
+	return executeAllTests(suites, func(target *test_executor.RemoteTestTarget) (bool, error) {
+		// Test cases may trust different sets of roots, so the CA bundle is rewritten for every test
+		err := ioutil.WriteFile(caPath, caPem(target.Artifacts), 0644)
+		if err != nil {
+			return false, err
+		}
+		testIntermediatesPath := ""
+		if len(target.Artifacts.Intermediates) > 0 {
+			err = ioutil.WriteFile(intermediatesPath, target.Artifacts.IntermediatesPem(), 0644)
+			if err != nil {
+				return false, err
+			}
+			testIntermediatesPath = intermediatesPath
+		}
 
-	return test_executor.ExecuteAllTestsRemote(ctx, suites, func(hostname string, port uint) (bool, error) {
-		cmdParts := getCommand(caPath, hostname, port)
+		cmdParts := getCommand(caPath, testIntermediatesPath, target.Hostname, target.Port)
 		cmd := exec.Command(cmdParts[0], cmdParts[1:]...)
 		if workingDir != "" {
 			cmd.Dir = workingDir
 		}
+		var output bytes.Buffer
+		if check != nil {
+			cmd.Stdin = bytes.NewReader(check.input)
+			cmd.Stdout = &output
+			cmd.Stderr = &output
+		}
 
 		err = cmd.Start()
 		if err != nil {
 			return false, err
 		}
 		err = cmd.Wait()
-		return err == nil, nil
+		if err != nil {
+			return false, nil
+		}
+		if check != nil && !strings.Contains(output.String(), check.successMarker) {
+			return false, nil
+		}
+		// Make sure the command actually connected to the test server, rather than e.g. to something else on the port
+		if !handshakeCompleted(target.Telemetry()) {
+			return false, fmt.Errorf("%s exited successfully without completing a TLS handshake with the test server", cmdParts[0])
+		}
+		return true, nil
 	})
 }
+
+func handshakeCompleted(telemetry []*test_executor.HandshakeTelemetry) bool {
+	for _, handshake := range telemetry {
+		if handshake.HandshakeComplete {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyTunneled reports whether a completed handshake was tunneled through the CONNECT proxy.
+func proxyTunneled(telemetry []*test_executor.HandshakeTelemetry) bool {
+	for _, handshake := range telemetry {
+		if handshake.HandshakeComplete && handshake.ProxyTarget != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func createTempFile() (string, error) {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		return "", err
+	}
+	tmpFile.Close()
+	return filepath.Abs(tmpFile.Name())
+}
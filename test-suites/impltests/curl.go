@@ -2,6 +2,8 @@ package impltests
 
 import (
 	"fmt"
+	"regexp"
+
 	test_executor "github.com/Netflix/bettertls/test-suites/test-executor"
 )
 
@@ -34,7 +36,85 @@ func (c *CurlRunner) RunTests(ctx *test_executor.ExecutionContext) (map[string]*
 	return testExec(ctx, func(caPath string, hostname string, tlsPort uint) []string {
 		return []string{
 			"curl", "-s", "-v", "--cacert", caPath,
-			fmt.Sprintf("https://%s:%d/ok", hostname, tlsPort),
+			fmt.Sprintf("https://%s/ok", hostPort(hostname, tlsPort)),
+		}
+	})
+}
+
+// CurlProxyRunner tests curl connecting through the test server's CONNECT proxy, as it would for hostnames that don't
+// resolve to the server.
+type CurlProxyRunner struct {
+	version string
+}
+
+func (c *CurlProxyRunner) Name() string {
+	return "curl_proxy"
+}
+
+func (c *CurlProxyRunner) Initialize() error {
+	var err error
+	c.version, err = execAndCapture("curl", "--version")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *CurlProxyRunner) Close() error {
+	return nil
+}
+
+func (c *CurlProxyRunner) GetVersion() string {
+	return c.version
+}
+
+func (c *CurlProxyRunner) RunTests(ctx *test_executor.ExecutionContext) (map[string]*test_executor.SuiteTestResults, error) {
+	return testExecProxy(ctx, func(caPath string, proxyUrl string, hostname string, tlsPort uint) []string {
+		return []string{
+			"curl", "-s", "-v", "--cacert", caPath, "--proxy", proxyUrl, "--noproxy", "",
+			fmt.Sprintf("https://%s/ok", hostPort(hostname, tlsPort)),
+		}
+	})
+}
+
+// CurlHttp3Runner tests curl's HTTP/3 support, which verifies certificates through its QUIC library rather than the
+// TLS backend used for HTTPS over TCP.
+type CurlHttp3Runner struct {
+	version string
+}
+
+// Matches the HTTP3 entry of the Features line of "curl --version"
+var curlHttp3Feature = regexp.MustCompile(`(?m)^Features:.* HTTP3( |$)`)
+
+func (c *CurlHttp3Runner) Name() string {
+	return "curl_http3"
+}
+
+func (c *CurlHttp3Runner) Initialize() error {
+	var err error
+	c.version, err = execAndCapture("curl", "--version")
+	if err != nil {
+		return err
+	}
+	if !curlHttp3Feature.MatchString(c.version) {
+		return fmt.Errorf("curl was built without HTTP/3 support")
+	}
+	return nil
+}
+
+func (c *CurlHttp3Runner) Close() error {
+	return nil
+}
+
+func (c *CurlHttp3Runner) GetVersion() string {
+	return c.version
+}
+
+func (c *CurlHttp3Runner) RunTests(ctx *test_executor.ExecutionContext) (map[string]*test_executor.SuiteTestResults, error) {
+	return testExecQuic(ctx, func(caPath string, hostname string, port uint) []string {
+		return []string{
+			"curl", "-s", "-v", "--http3-only", "--cacert", caPath,
+			fmt.Sprintf("https://%s/ok", hostPort(hostname, port)),
 		}
 	})
 }
@@ -1,7 +1,6 @@
 package impltests
 
 import (
-	"encoding/pem"
 	"fmt"
 	test_executor "github.com/Netflix/bettertls/test-suites/test-executor"
 	"net"
@@ -45,15 +44,16 @@ func (r *EnvoyRunner) RunTests(ctx *test_executor.ExecutionContext) (map[string]
 		return nil, err
 	}
 
-	rootCertPem := pem.EncodeToMemory(&pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: suites.GetRootCert().Raw,
-	})
-	pemString := strings.ReplaceAll(string(rootCertPem), "\n", "\\n")
-
-	return test_executor.ExecuteAllTestsRemote(ctx, suites, func(hostname string, port uint) (bool, error) {
+	return test_executor.ExecuteAllTestsRemoteUriTargets(ctx, suites, func(target *test_executor.RemoteTestTarget) (bool, error) {
+		hostname := target.Hostname
+		port := target.Port
+		pemString := strings.ReplaceAll(string(target.Artifacts.TrustAnchorsPem()), "\n", "\\n")
 		sanType := "DNS"
-		if net.ParseIP(hostname) != nil {
+		sanValue := hostname
+		if target.UriIdentity != "" {
+			sanType = "URI"
+			sanValue = target.UriIdentity
+		} else if net.ParseIP(hostname) != nil {
 			sanType = "IP_ADDRESS"
 		}
 
@@ -93,8 +93,7 @@ static_resources:
   clusters:
   - name: service_envoyproxy_io
     type: LOGICAL_DNS
-    # Comment out the following line to test on v6 networks
-    dns_lookup_family: V4_ONLY
+    dns_lookup_family: V4_PREFERRED
     load_assignment:
       cluster_name: service_envoyproxy_io
       endpoints:
@@ -116,7 +115,7 @@ static_resources:
                 exact: "%s"
             trusted_ca:
               inline_string: "%s"
-`, hostname, port, sanType, hostname, pemString)
+`, hostname, port, sanType, sanValue, pemString)
 
 		cmd := exec.Command("envoy", "--config-yaml", configYaml)
 		err = cmd.Start()
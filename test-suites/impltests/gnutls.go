@@ -1,7 +1,6 @@
 package impltests
 
 import (
-	"fmt"
 	test_executor "github.com/Netflix/bettertls/test-suites/test-executor"
 )
 
@@ -34,7 +33,7 @@ func (g *GnutlsRunner) RunTests(ctx *test_executor.ExecutionContext) (map[string
 	return testExec(ctx, func(caPath string, hostname string, tlsPort uint) []string {
 		return []string{
 			"gnutls-cli", "--x509cafile", caPath,
-			fmt.Sprintf("%s:%d", hostname, tlsPort),
+			hostPort(hostname, tlsPort),
 		}
 	})
 }
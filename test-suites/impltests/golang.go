@@ -33,18 +33,51 @@ func (g *GolangRunner) RunTests(ctx *test_executor.ExecutionContext) (map[string
 		return nil, err
 	}
 
-	truststore := x509.NewCertPool()
-	truststore.AddCert(suites.GetRootCert())
-	client := http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				RootCAs: truststore,
+	return test_executor.ExecuteAllTestsRemoteUriTargets(ctx, suites, func(target *test_executor.RemoteTestTarget) (bool, error) {
+		truststore := x509.NewCertPool()
+		for _, cert := range target.Artifacts.TrustAnchors {
+			truststore.AddCert(cert)
+		}
+		tlsConfig := &tls.Config{
+			RootCAs: truststore,
+		}
+		if len(target.Artifacts.Intermediates) > 0 || target.UriIdentity != "" {
+			// crypto/tls has no way to add intermediates or to verify a URI SAN, so verify the chain ourselves with
+			// x509.VerifyOptions
+			intermediates := x509.NewCertPool()
+			for _, cert := range target.Artifacts.Intermediates {
+				intermediates.AddCert(cert)
+			}
+			dnsName := target.Hostname
+			if target.UriIdentity != "" {
+				dnsName = ""
+			}
+			tlsConfig.InsecureSkipVerify = true
+			tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+				for _, cert := range cs.PeerCertificates[1:] {
+					intermediates.AddCert(cert)
+				}
+				_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+					DNSName:       dnsName,
+					Roots:         truststore,
+					Intermediates: intermediates,
+				})
+				if err != nil {
+					return err
+				}
+				if target.UriIdentity != "" {
+					return verifyUriIdentity(cs.PeerCertificates[0], target.UriIdentity)
+				}
+				return nil
+			}
+		}
+		client := http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: tlsConfig,
 			},
-		},
-	}
+		}
 
-	return test_executor.ExecuteAllTestsRemote(ctx, suites, func(hostname string, port uint) (bool, error) {
-		resp, err := client.Get(fmt.Sprintf("https://%s:%d/ok", hostname, port))
+		resp, err := client.Get(fmt.Sprintf("https://%s/ok", hostPort(target.Hostname, target.Port)))
 		if err != nil {
 			return false, nil
 		}
@@ -52,3 +85,12 @@ func (g *GolangRunner) RunTests(ctx *test_executor.ExecutionContext) (map[string
 		return true, nil
 	})
 }
+
+func verifyUriIdentity(cert *x509.Certificate, uriIdentity string) error {
+	for _, uri := range cert.URIs {
+		if uri.String() == uriIdentity {
+			return nil
+		}
+	}
+	return fmt.Errorf("certificate does not have URI SAN %s", uriIdentity)
+}
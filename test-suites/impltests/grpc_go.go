@@ -0,0 +1,58 @@
+package impltests
+
+import (
+	"context"
+	"crypto/x509"
+	"time"
+
+	test_executor "github.com/Netflix/bettertls/test-suites/test-executor"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// GrpcGoRunner tests grpc-go's transport credentials, which verify the server through their own tls.Config rather
+// than an http.Transport's.
+type GrpcGoRunner struct{}
+
+func (g *GrpcGoRunner) Name() string {
+	return "grpc_go"
+}
+
+func (g *GrpcGoRunner) Initialize() error {
+	return nil
+}
+
+func (g *GrpcGoRunner) Close() error {
+	return nil
+}
+
+func (g *GrpcGoRunner) GetVersion() string {
+	return grpc.Version
+}
+
+func (g *GrpcGoRunner) RunTests(ctx *test_executor.ExecutionContext) (map[string]*test_executor.SuiteTestResults, error) {
+	suites, err := test_executor.BuildTestSuites()
+	if err != nil {
+		return nil, err
+	}
+
+	return test_executor.ExecuteAllTestsRemoteGrpcTargets(ctx, suites, func(target *test_executor.RemoteTestTarget) (bool, error) {
+		truststore := x509.NewCertPool()
+		for _, cert := range target.Artifacts.TrustAnchors {
+			truststore.AddCert(cert)
+		}
+		// The server name comes from the target address
+		creds := credentials.NewClientTLSFromCert(truststore, "")
+		conn, err := grpc.Dial(hostPort(target.Hostname, target.Port), grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return false, err
+		}
+		defer conn.Close()
+
+		rpcCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, err = healthpb.NewHealthClient(conn).Check(rpcCtx, &healthpb.HealthCheckRequest{})
+		return err == nil, nil
+	})
+}
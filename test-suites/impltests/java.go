@@ -29,6 +29,7 @@ func (j *JavaRunner) Initialize() error {
 		return fmt.Errorf("failed to create a temporary directory: %v", err)
 	}
 	err = ioutil.WriteFile(filepath.Join(tmpDir, "Curl.java"), []byte(`
+import javax.net.ssl.CertPathTrustManagerParameters;
 import javax.net.ssl.HttpsURLConnection;
 import javax.net.ssl.SNIHostName;
 import javax.net.ssl.SSLContext;
@@ -45,8 +46,13 @@ import java.net.UnknownHostException;
 import java.nio.file.Files;
 import java.nio.file.Paths;
 import java.security.KeyStore;
+import java.security.cert.CertStore;
 import java.security.cert.Certificate;
 import java.security.cert.CertificateFactory;
+import java.security.cert.CollectionCertStoreParameters;
+import java.security.cert.PKIXBuilderParameters;
+import java.security.cert.X509CertSelector;
+import java.util.Collection;
 import java.util.Collections;
 
 public class Curl {
@@ -54,16 +60,31 @@ public class Curl {
         String caPath = args[0];
         String url = args[1];
 
-        Certificate rootCert;
+        Collection<? extends Certificate> rootCerts;
         try (InputStream inputStream = Files.newInputStream(Paths.get(caPath))) {
-            rootCert = CertificateFactory.getInstance("X509").generateCertificate(inputStream);
+            rootCerts = CertificateFactory.getInstance("X509").generateCertificates(inputStream);
         }
 
         KeyStore truststore = KeyStore.getInstance(KeyStore.getDefaultType());
         truststore.load(null, null);
-        truststore.setCertificateEntry("1", rootCert);
+        int i = 0;
+        for (Certificate rootCert : rootCerts) {
+            truststore.setCertificateEntry(Integer.toString(++i), rootCert);
+        }
         TrustManagerFactory tmf = TrustManagerFactory.getInstance(TrustManagerFactory.getDefaultAlgorithm());
-        tmf.init(truststore);
+        if (args.length > 2) {
+            // Make the untrusted intermediates available to the path builder
+            Collection<? extends Certificate> intermediates;
+            try (InputStream inputStream = Files.newInputStream(Paths.get(args[2]))) {
+                intermediates = CertificateFactory.getInstance("X509").generateCertificates(inputStream);
+            }
+            PKIXBuilderParameters params = new PKIXBuilderParameters(truststore, new X509CertSelector());
+            params.setRevocationEnabled(false);
+            params.addCertStore(CertStore.getInstance("Collection", new CollectionCertStoreParameters(intermediates)));
+            tmf.init(new CertPathTrustManagerParameters(params));
+        } else {
+            tmf.init(truststore);
+        }
 
         SSLContext sslContext = SSLContext.getInstance("TLS");
         sslContext.init(null, tmf.getTrustManagers(), null);
@@ -103,9 +124,13 @@ func (j *JavaRunner) GetVersion() string {
 }
 
 func (j *JavaRunner) RunTests(ctx *test_executor.ExecutionContext) (map[string]*test_executor.SuiteTestResults, error) {
-	return testExec(ctx, func(caPath string, hostname string, tlsPort uint) []string {
-		return []string{
-			"java", "-Djdk.tls.maxCertificateChainLength=50", "-cp", j.tmpDir, "Curl", caPath, fmt.Sprintf("https://%s:%d/ok", hostname, tlsPort),
+	return testExecWithIntermediates(ctx, func(caPath string, intermediatesPath string, hostname string, tlsPort uint) []string {
+		args := []string{
+			"java", "-Djdk.tls.maxCertificateChainLength=50", "-cp", j.tmpDir, "Curl", caPath, fmt.Sprintf("https://%s/ok", hostPort(hostname, tlsPort)),
+		}
+		if intermediatesPath != "" {
+			args = append(args, intermediatesPath)
 		}
+		return args
 	})
 }
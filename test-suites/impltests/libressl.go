@@ -1,7 +1,6 @@
 package impltests
 
 import (
-	"fmt"
 	test_executor "github.com/Netflix/bettertls/test-suites/test-executor"
 	"os"
 	"path/filepath"
@@ -46,7 +45,7 @@ func (l *LibresslRunner) RunTests(ctx *test_executor.ExecutionContext) (map[stri
 		return []string{"bash", "-c", strings.Join([]string{
 			l.libresslPath, "s_client",
 			"-CAfile", caPath,
-			"-connect", fmt.Sprintf("%s:%d", hostname, tlsPort),
+			"-connect", hostPort(hostname, tlsPort),
 			"-verify_return_error",
 			"|", "grep", "\"Verify return code: 0\"",
 		}, " "),
@@ -75,7 +75,7 @@ func (c *NodeRunner) RunTests(ctx *test_executor.ExecutionContext) (map[string]*
 	return testExec(ctx, func(caPath string, hostname string, tlsPort uint) []string {
 		return []string{
 			"node", filepath.Join(c.tmpDir, "foo.js"), caPath,
-			fmt.Sprintf("https://%s:%d/ok", hostname, tlsPort),
+			fmt.Sprintf("https://%s/ok", hostPort(hostname, tlsPort)),
 		}
 	})
 }
@@ -1,7 +1,6 @@
 package impltests
 
 import (
-	"fmt"
 	test_executor "github.com/Netflix/bettertls/test-suites/test-executor"
 	"net"
 )
@@ -32,10 +31,12 @@ func (o *OpensslRunner) GetVersion() string {
 }
 
 func (o *OpensslRunner) RunTests(ctx *test_executor.ExecutionContext) (map[string]*test_executor.SuiteTestResults, error) {
-	return testExec(ctx, func(caPath string, hostname string, tlsPort uint) []string {
+	// s_client has no -untrusted option, but without -partial_chain OpenSSL only trusts the self-signed certificates in
+	// its CA file, and uses the others as untrusted intermediates while building the chain
+	return testExecWithIntermediatesInCaFile(ctx, func(caPath string, hostname string, tlsPort uint) []string {
 		args := []string{"openssl", "s_client",
 			"-CAfile", caPath,
-			"-connect", fmt.Sprintf("%s:%d", hostname, tlsPort),
+			"-connect", hostPort(hostname, tlsPort),
 			"-verify_return_error"}
 
 		ipAddr := net.ParseIP(hostname)
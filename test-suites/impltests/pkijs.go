@@ -40,9 +40,13 @@ function b64StringToCert(b64string) {
     return new pkijs.Certificate({schema: asn1.result});
 }
 
-function verifyCertificate(trustRootAsB64String, certsAsArrayOfB64Strings) {
-    const certificates = certsAsArrayOfB64Strings.map(b64StringToCert).reverse();
-    const trustedCerts = [b64StringToCert(trustRootAsB64String)];
+function parseCertList(b64List) {
+    return b64List === "" ? [] : b64List.split(",").map(b64StringToCert);
+}
+
+function verifyCertificate(trustedCerts, certificates, intermediates) {
+    // Untrusted intermediates given ahead of time are just more candidates for path building
+    certificates = certificates.reverse().concat(intermediates);
 
     const certChainVerificationEngine = new pkijs.CertificateChainValidationEngine({
         checkDate: new Date(),
@@ -53,10 +57,11 @@ function verifyCertificate(trustRootAsB64String, certsAsArrayOfB64Strings) {
     return certChainVerificationEngine.verify();
 }
 
-let trustRootAsB64String = process.argv[2];
-let certsAsArrayOfB64Strings = process.argv[3].split(",");
+let trustedCerts = parseCertList(process.argv[2]);
+let certificates = parseCertList(process.argv[3]);
+let intermediates = parseCertList(process.argv[4]);
 
-let result = verifyCertificate(trustRootAsB64String, certsAsArrayOfB64Strings);
+let result = verifyCertificate(trustedCerts, certificates, intermediates);
 
 result.then(function(output) {
     if (output.result) {
@@ -113,15 +118,24 @@ func (p *PkijsRunner) RunTests(ctx *test_executor.ExecutionContext) (map[string]
 	}
 
 	scriptPath := filepath.Join(p.tmpDir, "pkijs_test.js")
-	return test_executor.ExecuteAllTestsLocal(ctx, suites, func(hostname string, certificates [][]byte) (bool, error) {
-		certsB64 := make([]string, 0, len(certificates))
-		for _, cert := range certificates {
+	return test_executor.ExecuteAllTestsLocalTargets(ctx, suites, func(target *test_executor.LocalTestTarget) (bool, error) {
+		certsB64 := make([]string, 0, len(target.Artifacts.Certificate.Certificate))
+		for _, cert := range target.Artifacts.Certificate.Certificate {
 			certsB64 = append(certsB64, base64.StdEncoding.EncodeToString(cert))
 		}
+		trustAnchorsB64 := make([]string, 0, len(target.Artifacts.TrustAnchors))
+		for _, cert := range target.Artifacts.TrustAnchors {
+			trustAnchorsB64 = append(trustAnchorsB64, base64.StdEncoding.EncodeToString(cert.Raw))
+		}
+		intermediatesB64 := make([]string, 0, len(target.Artifacts.Intermediates))
+		for _, cert := range target.Artifacts.Intermediates {
+			intermediatesB64 = append(intermediatesB64, base64.StdEncoding.EncodeToString(cert.Raw))
+		}
 
 		cmdParts := []string{"node", scriptPath,
-			base64.StdEncoding.EncodeToString(suites.GetRootCert().Raw),
-			strings.Join(certsB64, ",")}
+			strings.Join(trustAnchorsB64, ","),
+			strings.Join(certsB64, ","),
+			strings.Join(intermediatesB64, ",")}
 		cmd := exec.Command(cmdParts[0], cmdParts[1:]...)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
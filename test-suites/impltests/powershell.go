@@ -75,7 +75,12 @@ param (
   $capath
 )
 
-$caname = ((& "certutil.exe" "-f" "-enterprise" "-addstore" "Root" "$capath" | Select-String -Pattern 'Certificate ".*"').Matches[0].Value | Select-String -Pattern '".*"').Matches[0].Value.Trim('"')
+# The CA file may hold several roots, so remember all of their thumbprints in order to remove each of them afterwards
+$cas = [regex]::Matches((Get-Content -Raw "$capath"), '-----BEGIN CERTIFICATE-----([^-]*)-----END CERTIFICATE-----') | ForEach-Object {
+  New-Object System.Security.Cryptography.X509Certificates.X509Certificate2(,[Convert]::FromBase64String($_.Groups[1].Value))
+}
+
+& "certutil.exe" "-f" "-enterprise" "-addstore" "Root" "$capath"
 If (!$?) {
   Write-Host "certificate trust failed"
   exit 1
@@ -89,10 +94,12 @@ catch {
   $success = $false
 }
 
-& "certutil.exe" "-enterprise" "-delstore" "Root" "$caname"
-If (!$?) {
-  Write-Host "certificate untrust failed"
-  exit 1
+foreach ($ca in $cas) {
+  & "certutil.exe" "-enterprise" "-delstore" "Root" $ca.Thumbprint
+  If (!$?) {
+    Write-Host "certificate untrust failed"
+    exit 1
+  }
 }
 
 if ($success) {
@@ -123,7 +130,7 @@ func (c *PowerShellRunner) GetVersion() string {
 func (c *PowerShellRunner) RunTests(ctx *test_executor.ExecutionContext) (map[string]*test_executor.SuiteTestResults, error) {
 	return testExec(ctx, func(caPath string, hostname string, tlsPort uint) []string {
 		return []string{
-			"powershell", "-ExecutionPolicy", "Unrestricted", "-File", filepath.Join(c.tmpDir, "try-tls-handshake.ps1"), "-url", fmt.Sprintf("https://%s:%d/ok", hostname, tlsPort), "-capath", caPath,
+			"powershell", "-ExecutionPolicy", "Unrestricted", "-File", filepath.Join(c.tmpDir, "try-tls-handshake.ps1"), "-url", fmt.Sprintf("https://%s/ok", hostPort(hostname, tlsPort)), "-capath", caPath,
 		}
 	})
 }
@@ -61,7 +61,7 @@ func (c *PythonRequestsRunner) RunTests(ctx *test_executor.ExecutionContext) (ma
 	return testExec(ctx, func(caPath string, hostname string, tlsPort uint) []string {
 		return []string{
 			"python3", filepath.Join(c.tmpDir, "foo.py"), caPath,
-			fmt.Sprintf("https://%s:%d/ok", hostname, tlsPort),
+			fmt.Sprintf("https://%s/ok", hostPort(hostname, tlsPort)),
 		}
 	})
 }
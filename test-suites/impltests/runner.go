@@ -11,18 +11,27 @@ type ImplementationRunner interface {
 }
 
 var Runners = map[string]ImplementationRunner{
-	"boringssl":       &BoringSslRunner{},
-	"botan":           &BotanRunner{},
-	"curl":            &CurlRunner{},
-	"envoy":           &EnvoyRunner{},
-	"gnutls":          &GnutlsRunner{},
-	"golang":          &GolangRunner{},
-	"java":            &JavaRunner{},
-	"libressl":        &LibresslRunner{},
-	"node":            &NodeRunner{},
-	"openssl":         &OpensslRunner{},
-	"pkijs":           &PkijsRunner{},
-	"powershell":      &PowerShellRunner{},
-	"python_requests": &PythonRequestsRunner{},
-	"rustls":          &RustlsRunner{},
+	"boringssl":                 &BoringSslRunner{},
+	"botan":                     &BotanRunner{},
+	"curl":                      &CurlRunner{},
+	"curl_http3":                &CurlHttp3Runner{},
+	"curl_proxy":                &CurlProxyRunner{},
+	"envoy":                     &EnvoyRunner{},
+	"gnutls":                    &GnutlsRunner{},
+	"grpc_go":                   &GrpcGoRunner{},
+	"golang":                    &GolangRunner{},
+	"java":                      &JavaRunner{},
+	"libressl":                  &LibresslRunner{},
+	"node":                      &NodeRunner{},
+	"openssl":                   &OpensslRunner{},
+	"openssl_starttls_imap":     &OpensslStartTlsRunner{protocol: test_executor.STARTTLS_IMAP},
+	"openssl_starttls_ldap":     &OpensslStartTlsRunner{protocol: test_executor.STARTTLS_LDAP},
+	"openssl_starttls_pop3":     &OpensslStartTlsRunner{protocol: test_executor.STARTTLS_POP3},
+	"openssl_starttls_postgres": &OpensslStartTlsRunner{protocol: test_executor.STARTTLS_POSTGRES},
+	"openssl_starttls_smtp":     &OpensslStartTlsRunner{protocol: test_executor.STARTTLS_SMTP},
+	"pkijs":                     &PkijsRunner{},
+	"powershell":                &PowerShellRunner{},
+	"psql":                      &PsqlRunner{},
+	"python_requests":           &PythonRequestsRunner{},
+	"rustls":                    &RustlsRunner{},
 }
@@ -0,0 +1,127 @@
+package impltests
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	test_executor "github.com/Netflix/bettertls/test-suites/test-executor"
+)
+
+// OpensslStartTlsRunner runs openssl s_client against one of the server's STARTTLS listeners.
+type OpensslStartTlsRunner struct {
+	protocol test_executor.StartTlsProtocol
+	version  string
+}
+
+func (o *OpensslStartTlsRunner) Name() string {
+	return "openssl_starttls_" + o.protocol.String()
+}
+
+func (o *OpensslStartTlsRunner) Initialize() error {
+	var err error
+	o.version, err = execAndCapture("openssl", "version")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (o *OpensslStartTlsRunner) Close() error {
+	return nil
+}
+
+func (o *OpensslStartTlsRunner) GetVersion() string {
+	return o.version
+}
+
+// opensslSessionInput is what s_client sends once TLS has started: a request the server answers with
+// test_executor.STARTTLS_SUCCESS_MARKER, then one that makes the server end the session.
+func opensslSessionInput(protocol test_executor.StartTlsProtocol) []byte {
+	switch protocol {
+	case test_executor.STARTTLS_SMTP:
+		return []byte("EHLO bettertls\r\nQUIT\r\n")
+	case test_executor.STARTTLS_IMAP:
+		return []byte("a CAPABILITY\r\nb LOGOUT\r\n")
+	case test_executor.STARTTLS_POP3:
+		return []byte("CAPA\r\nQUIT\r\n")
+	case test_executor.STARTTLS_LDAP:
+		// An anonymous BindRequest and an UnbindRequest. s_client used messageID 1 for the StartTLS request.
+		return []byte{
+			0x30, 0x0c, 0x02, 0x01, 0x02, 0x60, 0x07, 0x02, 0x01, 0x03, 0x04, 0x00, 0x80, 0x00,
+			0x30, 0x05, 0x02, 0x01, 0x03, 0x42, 0x00,
+		}
+	case test_executor.STARTTLS_POSTGRES:
+		// A StartupMessage (protocol version 3.0) and a Terminate message
+		parameters := []byte("user\x00bettertls\x00\x00")
+		input := binary.BigEndian.AppendUint32(nil, uint32(8+len(parameters)))
+		input = binary.BigEndian.AppendUint32(input, 3<<16)
+		input = append(input, parameters...)
+		return append(input, 'X', 0, 0, 0, 4)
+	}
+	panic(fmt.Errorf("unhandled StartTlsProtocol: %d", protocol))
+}
+
+func (o *OpensslStartTlsRunner) RunTests(ctx *test_executor.ExecutionContext) (map[string]*test_executor.SuiteTestResults, error) {
+	return testExecStartTls(ctx, o.protocol, opensslSessionInput(o.protocol), func(caPath string, hostname string, port uint) []string {
+		// -ign_eof keeps s_client reading the server's replies after it has sent all of its input
+		args := []string{"openssl", "s_client",
+			"-starttls", o.protocol.String(),
+			"-CAfile", caPath,
+			"-connect", hostPort(hostname, port),
+			"-verify_return_error",
+			"-ign_eof"}
+
+		ipAddr := net.ParseIP(hostname)
+		if ipAddr == nil {
+			args = append(args, "-verify_hostname", hostname)
+		} else {
+			args = append(args, "-verify_ip", hostname)
+		}
+
+		return args
+	})
+}
+
+// PsqlRunner runs the PostgreSQL client (and so libpq) against the server's PostgreSQL listener.
+type PsqlRunner struct {
+	version string
+}
+
+func (p *PsqlRunner) Name() string {
+	return "psql"
+}
+
+func (p *PsqlRunner) Initialize() error {
+	var err error
+	p.version, err = execAndCapture("psql", "--version")
+	if err != nil {
+		return err
+	}
+	p.version = strings.TrimSpace(p.version)
+	return nil
+}
+
+func (p *PsqlRunner) Close() error {
+	return nil
+}
+
+func (p *PsqlRunner) GetVersion() string {
+	return p.version
+}
+
+// quoteConnInfoValue quotes a value for a libpq connection string.
+func quoteConnInfoValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+func (p *PsqlRunner) RunTests(ctx *test_executor.ExecutionContext) (map[string]*test_executor.SuiteTestResults, error) {
+	// libpq prints the server's notices during startup, including the one with STARTTLS_SUCCESS_MARKER, to stderr
+	return testExecStartTls(ctx, test_executor.STARTTLS_POSTGRES, nil, func(caPath string, hostname string, port uint) []string {
+		connInfo := fmt.Sprintf("host=%s port=%d sslmode=verify-full sslrootcert=%s dbname=bettertls user=bettertls connect_timeout=10",
+			quoteConnInfoValue(hostname), port, quoteConnInfoValue(caPath))
+		// -w never prompts for a password; the server doesn't ask for one
+		return []string{"psql", "-X", "-w", "-d", connInfo, "-c", `\q`}
+	})
+}
@@ -0,0 +1,77 @@
+package impltests
+
+import (
+	"encoding/asn1"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	test_executor "github.com/Netflix/bettertls/test-suites/test-executor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuoteConnInfoValue(t *testing.T) {
+	assert.Equal(t, `'test.localhost'`, quoteConnInfoValue("test.localhost"))
+	assert.Equal(t, `''`, quoteConnInfoValue(""))
+	assert.Equal(t, `'/tmp/a b'`, quoteConnInfoValue("/tmp/a b"))
+	assert.Equal(t, `'it\'s'`, quoteConnInfoValue("it's"))
+	assert.Equal(t, `'C:\\ca.pem'`, quoteConnInfoValue(`C:\ca.pem`))
+}
+
+func TestOpensslSessionInputLdap(t *testing.T) {
+	input := opensslSessionInput(test_executor.STARTTLS_LDAP)
+
+	// Two LDAPMessages: SEQUENCE { messageID, protocolOp }
+	type ldapMessage struct {
+		MessageId  int
+		ProtocolOp asn1.RawValue
+	}
+	var bind, unbind ldapMessage
+	rest, err := asn1.Unmarshal(input, &bind)
+	require.NoError(t, err)
+	rest, err = asn1.Unmarshal(rest, &unbind)
+	require.NoError(t, err)
+	assert.Empty(t, rest)
+
+	// [APPLICATION 0] BindRequest: version 3, an empty name and empty simple credentials
+	assert.Equal(t, 2, bind.MessageId)
+	assert.Equal(t, asn1.ClassApplication, bind.ProtocolOp.Class)
+	assert.Equal(t, 0, bind.ProtocolOp.Tag)
+	assert.True(t, bind.ProtocolOp.IsCompound)
+	var version int
+	rest, err = asn1.Unmarshal(bind.ProtocolOp.Bytes, &version)
+	require.NoError(t, err)
+	assert.Equal(t, 3, version)
+	assert.Equal(t, []byte{0x04, 0x00, 0x80, 0x00}, rest)
+
+	// [APPLICATION 2] UnbindRequest, which is NULL
+	assert.Equal(t, 3, unbind.MessageId)
+	assert.Equal(t, asn1.ClassApplication, unbind.ProtocolOp.Class)
+	assert.Equal(t, 2, unbind.ProtocolOp.Tag)
+	assert.Empty(t, unbind.ProtocolOp.Bytes)
+}
+
+func TestOpensslSessionInputPostgres(t *testing.T) {
+	input := opensslSessionInput(test_executor.STARTTLS_POSTGRES)
+
+	// A StartupMessage, whose length includes itself, for protocol 3.0
+	require.GreaterOrEqual(t, len(input), 8)
+	length := binary.BigEndian.Uint32(input)
+	require.LessOrEqual(t, int(length), len(input))
+	assert.Equal(t, uint32(3<<16), binary.BigEndian.Uint32(input[4:]))
+	parameters := string(input[8:length])
+	assert.Equal(t, "user\x00bettertls\x00\x00", parameters)
+
+	// Then a Terminate message
+	assert.Equal(t, []byte{'X', 0, 0, 0, 4}, input[length:])
+}
+
+func TestOpensslSessionInputTextProtocols(t *testing.T) {
+	for _, protocol := range []test_executor.StartTlsProtocol{test_executor.STARTTLS_SMTP, test_executor.STARTTLS_IMAP, test_executor.STARTTLS_POP3} {
+		lines := strings.Split(string(opensslSessionInput(protocol)), "\r\n")
+		// Two commands, each ending with CRLF
+		assert.Len(t, lines, 3, protocol.String())
+		assert.Empty(t, lines[2], protocol.String())
+	}
+}
@@ -0,0 +1,101 @@
+package injection
+
+import (
+	"fmt"
+
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+)
+
+const (
+	SANITY_CHECK_TEST_CASE uint = iota
+	NAME_CONSTRAINTS_FEATURE_TEST_CASE
+	CN_FALLBACK_FEATURE_TEST_CASE
+	URI_IDENTITY_FEATURE_TEST_CASE
+)
+
+const (
+	FEATURE_NAME_CONSTRAINTS test_case.Feature = iota
+	// Whether the client matches the hostname against the subject CN when there's no SAN extension
+	FEATURE_CN_FALLBACK
+	// Whether the client verifies the server by URI_IDENTITY rather than by hostname
+	FEATURE_URI_IDENTITY
+)
+
+type TestCaseProvider struct {
+	testCases []test_case.TestCase
+}
+
+func NewTestCaseProvider() *TestCaseProvider {
+	testCases := []test_case.TestCase{
+		SANITY_CHECK_TEST_CASE: &InjectionTestCase{},
+		NAME_CONSTRAINTS_FEATURE_TEST_CASE: &InjectionTestCase{
+			Constraint: CONSTRAINT_EXCLUDE_HOSTNAME,
+		},
+		CN_FALLBACK_FEATURE_TEST_CASE: &InjectionTestCase{
+			Placement: PLACEMENT_CN,
+		},
+		URI_IDENTITY_FEATURE_TEST_CASE: &InjectionTestCase{
+			Placement: PLACEMENT_URI_HOST,
+		},
+	}
+
+	for _, payload := range ALL_PAYLOADS {
+		for _, placement := range ALL_PLACEMENTS {
+			for _, constraint := range ALL_CONSTRAINTS {
+				testCases = append(testCases, &InjectionTestCase{
+					Payload:    payload,
+					Placement:  placement,
+					Constraint: constraint,
+				})
+			}
+		}
+	}
+
+	return &TestCaseProvider{
+		testCases: testCases,
+	}
+}
+
+func (p *TestCaseProvider) Name() string {
+	return "injection"
+}
+
+func (p *TestCaseProvider) GetTestCaseCount() (uint, error) {
+	return uint(len(p.testCases)), nil
+}
+
+func (p *TestCaseProvider) GetTestCase(index uint) (test_case.TestCase, error) {
+	return p.testCases[index], nil
+}
+
+func (p *TestCaseProvider) GetSanityCheckTestCase() (uint, error) {
+	return SANITY_CHECK_TEST_CASE, nil
+}
+
+func (p *TestCaseProvider) GetFeatures() []test_case.Feature {
+	return []test_case.Feature{FEATURE_NAME_CONSTRAINTS, FEATURE_CN_FALLBACK, FEATURE_URI_IDENTITY}
+}
+
+func (p *TestCaseProvider) DescribeFeature(feature test_case.Feature) string {
+	switch feature {
+	case FEATURE_NAME_CONSTRAINTS:
+		return "NAME_CONSTRAINTS"
+	case FEATURE_CN_FALLBACK:
+		return "CN_FALLBACK"
+	case FEATURE_URI_IDENTITY:
+		return "URI_IDENTITY"
+	}
+	panic(fmt.Errorf("unsupported feature: %d", feature))
+}
+
+func (p *TestCaseProvider) GetTestCasesForFeature(feature test_case.Feature) ([]uint, error) {
+	switch feature {
+	case FEATURE_NAME_CONSTRAINTS:
+		return []uint{NAME_CONSTRAINTS_FEATURE_TEST_CASE}, nil
+	case FEATURE_CN_FALLBACK:
+		return []uint{CN_FALLBACK_FEATURE_TEST_CASE}, nil
+	case FEATURE_URI_IDENTITY:
+		return []uint{URI_IDENTITY_FEATURE_TEST_CASE}, nil
+	}
+	return nil, fmt.Errorf("invalid feature: %v", feature)
+}
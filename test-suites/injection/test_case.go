@@ -0,0 +1,334 @@
+package injection
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Netflix/bettertls/test-suites/certutil"
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+)
+
+const HOSTNAME = "test.localhost"
+
+// The URI identity clients verify the server by in PLACEMENT_URI_HOST test cases
+const URI_IDENTITY = "https://" + HOSTNAME
+
+// The domain an attacker controls, and so could get a certificate for
+const ATTACKER_DNS_TREE = "evil.com"
+
+// A Payload is a name that a client comparing names as C strings, or decoding them before comparing them, could
+// mistake for HOSTNAME.
+type Payload int
+
+const (
+	// HOSTNAME itself
+	PAYLOAD_NONE Payload = iota
+	// "test.localhost\0.evil.com"
+	PAYLOAD_NUL
+	// "test.localhost\0"
+	PAYLOAD_TRAILING_NUL
+	// "test.localhost<c>.evil.com" for various control characters
+	PAYLOAD_LINE_FEED
+	PAYLOAD_CARRIAGE_RETURN
+	PAYLOAD_TAB
+	PAYLOAD_START_OF_HEADING
+	PAYLOAD_DELETE
+	// "test.localhost .evil.com"
+	PAYLOAD_SPACE
+	// "test.localhost " and " test.localhost"
+	PAYLOAD_TRAILING_SPACE
+	PAYLOAD_LEADING_SPACE
+	// "test%2elocalhost"
+	PAYLOAD_PERCENT_ENCODED_DOT
+	// "test.localhost%00.evil.com"
+	PAYLOAD_PERCENT_ENCODED_NUL
+	// "test.localhost..". A single trailing dot is covered (softly) by the nameconstraints suite.
+	PAYLOAD_DOUBLE_TRAILING_DOT
+)
+
+var ALL_PAYLOADS = []Payload{PAYLOAD_NUL, PAYLOAD_TRAILING_NUL, PAYLOAD_LINE_FEED, PAYLOAD_CARRIAGE_RETURN, PAYLOAD_TAB,
+	PAYLOAD_START_OF_HEADING, PAYLOAD_DELETE, PAYLOAD_SPACE, PAYLOAD_TRAILING_SPACE, PAYLOAD_LEADING_SPACE,
+	PAYLOAD_PERCENT_ENCODED_DOT, PAYLOAD_PERCENT_ENCODED_NUL, PAYLOAD_DOUBLE_TRAILING_DOT}
+
+func (p Payload) String() string {
+	switch p {
+	case PAYLOAD_NONE:
+		return "NONE"
+	case PAYLOAD_NUL:
+		return "NUL"
+	case PAYLOAD_TRAILING_NUL:
+		return "TRAILING_NUL"
+	case PAYLOAD_LINE_FEED:
+		return "LINE_FEED"
+	case PAYLOAD_CARRIAGE_RETURN:
+		return "CARRIAGE_RETURN"
+	case PAYLOAD_TAB:
+		return "TAB"
+	case PAYLOAD_START_OF_HEADING:
+		return "START_OF_HEADING"
+	case PAYLOAD_DELETE:
+		return "DELETE"
+	case PAYLOAD_SPACE:
+		return "SPACE"
+	case PAYLOAD_TRAILING_SPACE:
+		return "TRAILING_SPACE"
+	case PAYLOAD_LEADING_SPACE:
+		return "LEADING_SPACE"
+	case PAYLOAD_PERCENT_ENCODED_DOT:
+		return "PERCENT_ENCODED_DOT"
+	case PAYLOAD_PERCENT_ENCODED_NUL:
+		return "PERCENT_ENCODED_NUL"
+	case PAYLOAD_DOUBLE_TRAILING_DOT:
+		return "DOUBLE_TRAILING_DOT"
+	}
+	panic(fmt.Errorf("unhandled Payload: %d", p))
+}
+func (p Payload) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// name returns the (host) name carried by the leaf certificate.
+func (p Payload) name() string {
+	switch p {
+	case PAYLOAD_NONE:
+		return HOSTNAME
+	case PAYLOAD_NUL:
+		return HOSTNAME + "\x00." + ATTACKER_DNS_TREE
+	case PAYLOAD_TRAILING_NUL:
+		return HOSTNAME + "\x00"
+	case PAYLOAD_LINE_FEED:
+		return HOSTNAME + "\n." + ATTACKER_DNS_TREE
+	case PAYLOAD_CARRIAGE_RETURN:
+		return HOSTNAME + "\r." + ATTACKER_DNS_TREE
+	case PAYLOAD_TAB:
+		return HOSTNAME + "\t." + ATTACKER_DNS_TREE
+	case PAYLOAD_START_OF_HEADING:
+		return HOSTNAME + "\x01." + ATTACKER_DNS_TREE
+	case PAYLOAD_DELETE:
+		return HOSTNAME + "\x7f." + ATTACKER_DNS_TREE
+	case PAYLOAD_SPACE:
+		return HOSTNAME + " ." + ATTACKER_DNS_TREE
+	case PAYLOAD_TRAILING_SPACE:
+		return HOSTNAME + " "
+	case PAYLOAD_LEADING_SPACE:
+		return " " + HOSTNAME
+	case PAYLOAD_PERCENT_ENCODED_DOT:
+		return "test%2elocalhost"
+	case PAYLOAD_PERCENT_ENCODED_NUL:
+		return HOSTNAME + "%00." + ATTACKER_DNS_TREE
+	case PAYLOAD_DOUBLE_TRAILING_DOT:
+		return HOSTNAME + ".."
+	}
+	panic(fmt.Errorf("unhandled Payload: %d", p))
+}
+
+// A Placement is where in the leaf certificate the payload is put.
+type Placement int
+
+const (
+	// A dNSName SAN
+	PLACEMENT_SAN_DNS Placement = iota
+	// The subject CN, with no SAN extension. Only clients that fall back to the CN run these test cases.
+	PLACEMENT_CN
+	// The host of a uniformResourceIdentifier SAN, "https://<payload>", with the client verifying the server by
+	// URI_IDENTITY. Only clients that verify URI identities run these test cases.
+	PLACEMENT_URI_HOST
+)
+
+var ALL_PLACEMENTS = []Placement{PLACEMENT_SAN_DNS, PLACEMENT_CN, PLACEMENT_URI_HOST}
+
+func (p Placement) String() string {
+	switch p {
+	case PLACEMENT_SAN_DNS:
+		return "SAN_DNS"
+	case PLACEMENT_CN:
+		return "CN"
+	case PLACEMENT_URI_HOST:
+		return "URI_HOST"
+	}
+	panic(fmt.Errorf("unhandled Placement: %d", p))
+}
+func (p Placement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// A Constraint is a DNS name constraint on the ICA that issues the leaf.
+type Constraint int
+
+const (
+	CONSTRAINT_NONE Constraint = iota
+	// Permits ATTACKER_DNS_TREE, which contains the payload if it's read as a whole
+	CONSTRAINT_PERMIT_ATTACKER
+	// Excludes HOSTNAME, which contains the payload if it's read up to the injected character
+	CONSTRAINT_EXCLUDE_HOSTNAME
+)
+
+var ALL_CONSTRAINTS = []Constraint{CONSTRAINT_NONE, CONSTRAINT_PERMIT_ATTACKER, CONSTRAINT_EXCLUDE_HOSTNAME}
+
+func (c Constraint) String() string {
+	switch c {
+	case CONSTRAINT_NONE:
+		return "NONE"
+	case CONSTRAINT_PERMIT_ATTACKER:
+		return "PERMIT_ATTACKER"
+	case CONSTRAINT_EXCLUDE_HOSTNAME:
+		return "EXCLUDE_HOSTNAME"
+	}
+	panic(fmt.Errorf("unhandled Constraint: %d", c))
+}
+func (c Constraint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+// subtree returns the constraint for a placement: a URI constraint (on the URI's host) for PLACEMENT_URI_HOST, and a
+// DNS name constraint otherwise.
+func (c Constraint) subtree(placement Placement) certutil.GeneralName {
+	var domain string
+	switch c {
+	case CONSTRAINT_PERMIT_ATTACKER:
+		domain = ATTACKER_DNS_TREE
+	case CONSTRAINT_EXCLUDE_HOSTNAME:
+		domain = HOSTNAME
+	default:
+		panic(fmt.Errorf("unhandled Constraint: %d", c))
+	}
+	if placement == PLACEMENT_URI_HOST {
+		return certutil.UriName(domain)
+	}
+	return certutil.DnsName(domain)
+}
+
+// An InjectionTestCase presents a leaf certificate with a name that embeds the client's hostname alongside NUL
+// bytes, control characters or other characters that aren't allowed in a DNS name. Apart from the sanity check, none
+// of these should ever be accepted.
+type InjectionTestCase struct {
+	Payload    Payload
+	Placement  Placement
+	Constraint Constraint
+}
+
+func (t *InjectionTestCase) ExpectedResult() test_case.ExpectedResult {
+	if t.Payload == PAYLOAD_NONE && t.Constraint == CONSTRAINT_NONE {
+		return test_case.EXPECTED_RESULT_PASS
+	}
+	return test_case.EXPECTED_RESULT_FAIL
+}
+
+func (t *InjectionTestCase) GetHostname() string {
+	return HOSTNAME
+}
+
+func (t *InjectionTestCase) GetUriIdentity() string {
+	if t.Placement == PLACEMENT_URI_HOST {
+		return URI_IDENTITY
+	}
+	return ""
+}
+
+func (t *InjectionTestCase) RequiredFeatures() []test_case.Feature {
+	var requiredFeatures []test_case.Feature
+	if t.Constraint != CONSTRAINT_NONE {
+		requiredFeatures = append(requiredFeatures, FEATURE_NAME_CONSTRAINTS)
+	}
+	switch t.Placement {
+	case PLACEMENT_CN:
+		requiredFeatures = append(requiredFeatures, FEATURE_CN_FALLBACK)
+	case PLACEMENT_URI_HOST:
+		requiredFeatures = append(requiredFeatures, FEATURE_URI_IDENTITY)
+	}
+	return requiredFeatures
+}
+
+func (t *InjectionTestCase) GetCertificates(rootCert *x509.Certificate, rootKey crypto.Signer) (*tls.Certificate, error) {
+	icaTemplate := &x509.Certificate{
+		SerialNumber: certutil.RandomSerial(),
+		Subject: pkix.Name{
+			CommonName:   "ica",
+			Organization: []string{certutil.SUBJECT_ORGANIZATION},
+			SerialNumber: certutil.RandomString(),
+		},
+		NotBefore:             certutil.GetNotBefore(),
+		NotAfter:              certutil.GetNotAfter(false),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if t.Constraint != CONSTRAINT_NONE {
+		var permitted, excluded []certutil.GeneralName
+		if t.Constraint == CONSTRAINT_EXCLUDE_HOSTNAME {
+			excluded = append(excluded, t.Constraint.subtree(t.Placement))
+		} else {
+			permitted = append(permitted, t.Constraint.subtree(t.Placement))
+		}
+		ncExt, err := certutil.BuildNameConstraintsExtension(true, permitted, excluded)
+		if err != nil {
+			return nil, err
+		}
+		icaTemplate.ExtraExtensions = []pkix.Extension{ncExt}
+	}
+	icaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	icaBytes, err := x509.CreateCertificate(rand.Reader, icaTemplate, rootCert, icaKey.Public(), rootKey)
+	if err != nil {
+		return nil, err
+	}
+	ica, err := x509.ParseCertificate(icaBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: certutil.RandomSerial(),
+		Subject: pkix.Name{
+			Organization: []string{certutil.SUBJECT_ORGANIZATION},
+			SerialNumber: certutil.RandomString(),
+		},
+		NotBefore:             certutil.GetNotBefore(),
+		NotAfter:              certutil.GetNotAfter(false),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+	}
+	// The SAN extension is built by hand, since x509.CreateCertificate refuses to encode names with these characters
+	switch t.Placement {
+	case PLACEMENT_SAN_DNS:
+		sanExt, err := certutil.BuildSanExtension(false, []certutil.GeneralName{certutil.DnsName(t.Payload.name())})
+		if err != nil {
+			return nil, err
+		}
+		leafTemplate.ExtraExtensions = []pkix.Extension{sanExt}
+	case PLACEMENT_CN:
+		leafTemplate.Subject.CommonName = t.Payload.name()
+	case PLACEMENT_URI_HOST:
+		sanExt, err := certutil.BuildSanExtension(false, []certutil.GeneralName{certutil.UriName("https://" + t.Payload.name())})
+		if err != nil {
+			return nil, err
+		}
+		leafTemplate.ExtraExtensions = []pkix.Extension{sanExt}
+	default:
+		panic(fmt.Errorf("unhandled Placement: %d", t.Placement))
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	leafBytes, err := x509.CreateCertificate(rand.Reader, leafTemplate, ica, leafKey.Public(), icaKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{leafBytes, ica.Raw},
+		PrivateKey:  leafKey,
+	}, nil
+}
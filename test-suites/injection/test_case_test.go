@@ -0,0 +1,82 @@
+package injection
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/Netflix/bettertls/test-suites/certutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// san is the DER encoding of a SAN extension value with a single name of the given tag.
+func san(tag byte, name string) []byte {
+	return append([]byte{0x30, byte(len(name) + 2), tag, byte(len(name))}, name...)
+}
+
+func TestGetCertificatesEncodesPayloadAsIs(t *testing.T) {
+	rootCert, rootKey, err := certutil.GenerateSelfSignedCert("root")
+	require.NoError(t, err)
+
+	for _, payload := range append([]Payload{PAYLOAD_NONE}, ALL_PAYLOADS...) {
+		for _, placement := range ALL_PLACEMENTS {
+			testCase := &InjectionTestCase{Payload: payload, Placement: placement}
+			name := payload.String() + "/" + placement.String()
+			certificate, err := testCase.GetCertificates(rootCert, rootKey)
+			require.NoError(t, err, name)
+			require.Len(t, certificate.Certificate, 2, name)
+			leaf := certificate.Certificate[0]
+
+			switch placement {
+			case PLACEMENT_SAN_DNS:
+				assert.True(t, bytes.Contains(leaf, san(0x82, payload.name())), name)
+				assert.Empty(t, testCase.GetUriIdentity(), name)
+			case PLACEMENT_URI_HOST:
+				assert.True(t, bytes.Contains(leaf, san(0x86, "https://"+payload.name())), name)
+				assert.Equal(t, URI_IDENTITY, testCase.GetUriIdentity(), name)
+				assert.Contains(t, testCase.RequiredFeatures(), FEATURE_URI_IDENTITY, name)
+			case PLACEMENT_CN:
+				// The payload is the CN's value byte for byte, and there's no SAN extension
+				parsed, err := x509.ParseCertificate(leaf)
+				require.NoError(t, err, name)
+				assert.Equal(t, payload.name(), parsed.Subject.CommonName, name)
+				for _, ext := range parsed.Extensions {
+					assert.False(t, ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 17}), name)
+				}
+			}
+		}
+	}
+}
+
+func TestGetCertificatesConstraints(t *testing.T) {
+	rootCert, rootKey, err := certutil.GenerateSelfSignedCert("root")
+	require.NoError(t, err)
+
+	for constraint, expected := range map[Constraint][2][]string{
+		CONSTRAINT_NONE:             {nil, nil},
+		CONSTRAINT_PERMIT_ATTACKER:  {{ATTACKER_DNS_TREE}, nil},
+		CONSTRAINT_EXCLUDE_HOSTNAME: {nil, {HOSTNAME}},
+	} {
+		testCase := &InjectionTestCase{Payload: PAYLOAD_NUL, Placement: PLACEMENT_SAN_DNS, Constraint: constraint}
+		certificate, err := testCase.GetCertificates(rootCert, rootKey)
+		require.NoError(t, err, constraint.String())
+		ica, err := x509.ParseCertificate(certificate.Certificate[1])
+		require.NoError(t, err, constraint.String())
+		assert.Equal(t, expected[0], ica.PermittedDNSDomains, constraint.String())
+		assert.Equal(t, expected[1], ica.ExcludedDNSDomains, constraint.String())
+		assert.Equal(t, constraint != CONSTRAINT_NONE, ica.PermittedDNSDomainsCritical, constraint.String())
+
+		// The URI host cases constrain URIs instead
+		testCase.Placement = PLACEMENT_URI_HOST
+		certificate, err = testCase.GetCertificates(rootCert, rootKey)
+		require.NoError(t, err, constraint.String())
+		ica, err = x509.ParseCertificate(certificate.Certificate[1])
+		require.NoError(t, err, constraint.String())
+		assert.Empty(t, ica.PermittedDNSDomains, constraint.String())
+		assert.Empty(t, ica.ExcludedDNSDomains, constraint.String())
+		assert.Equal(t, expected[0], ica.PermittedURIDomains, constraint.String())
+		assert.Equal(t, expected[1], ica.ExcludedURIDomains, constraint.String())
+	}
+}
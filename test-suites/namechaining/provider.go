@@ -0,0 +1,61 @@
+package namechaining
+
+import (
+	"fmt"
+
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+)
+
+const (
+	SANITY_CHECK_TEST_CASE uint = iota
+)
+
+type TestCaseProvider struct {
+	testCases []test_case.TestCase
+}
+
+func NewTestCaseProvider() *TestCaseProvider {
+	testCases := []test_case.TestCase{
+		SANITY_CHECK_TEST_CASE: &NameChainingTestCase{},
+	}
+	for _, location := range ALL_NAME_LOCATIONS {
+		for _, difference := range ALL_NAME_DIFFERENCES {
+			testCases = append(testCases, &NameChainingTestCase{
+				Location:   location,
+				Difference: difference,
+			})
+		}
+	}
+
+	return &TestCaseProvider{
+		testCases: testCases,
+	}
+}
+
+func (p *TestCaseProvider) Name() string {
+	return "namechaining"
+}
+
+func (p *TestCaseProvider) GetTestCaseCount() (uint, error) {
+	return uint(len(p.testCases)), nil
+}
+
+func (p *TestCaseProvider) GetTestCase(index uint) (test_case.TestCase, error) {
+	return p.testCases[index], nil
+}
+
+func (p *TestCaseProvider) GetSanityCheckTestCase() (uint, error) {
+	return SANITY_CHECK_TEST_CASE, nil
+}
+
+func (p *TestCaseProvider) GetFeatures() []test_case.Feature {
+	return nil
+}
+
+func (p *TestCaseProvider) DescribeFeature(feature test_case.Feature) string {
+	panic(fmt.Errorf("unsupported feature: %d", feature))
+}
+
+func (p *TestCaseProvider) GetTestCasesForFeature(feature test_case.Feature) ([]uint, error) {
+	return nil, fmt.Errorf("invalid feature: %v", feature)
+}
@@ -0,0 +1,259 @@
+package namechaining
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Netflix/bettertls/test-suites/pathbuilding"
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+)
+
+// The node whose name is compared. Its common name has an internal space for NAME_DIFFERENCE_INTERNAL_SPACE.
+const ICA_NODE = "Issuing CA"
+
+var NAME_CHAINING_TRUST_GRAPH = pathbuilding.NewGraph("NAME_CHAINING_TRUST_GRAPH", []pathbuilding.Edge{
+	{Source: "Trust Anchor", Destination: ICA_NODE},
+	{Source: ICA_NODE, Destination: "EE"},
+})
+
+var (
+	oidCommonName         = asn1.ObjectIdentifier{2, 5, 4, 3}
+	oidSerialNumber       = asn1.ObjectIdentifier{2, 5, 4, 5}
+	oidOrganizationalUnit = asn1.ObjectIdentifier{2, 5, 4, 11}
+)
+
+// A NameLocation is which copy of the ICA's name is encoded differently.
+type NameLocation int
+
+const (
+	// The issuer of the leaf differs from the ICA's subject
+	NAME_LOCATION_LEAF_ISSUER NameLocation = iota
+	// The ICA's subject differs from the issuer of the leaf
+	NAME_LOCATION_ICA_SUBJECT
+)
+
+var ALL_NAME_LOCATIONS = []NameLocation{NAME_LOCATION_LEAF_ISSUER, NAME_LOCATION_ICA_SUBJECT}
+
+func (l NameLocation) String() string {
+	switch l {
+	case NAME_LOCATION_LEAF_ISSUER:
+		return "LEAF_ISSUER"
+	case NAME_LOCATION_ICA_SUBJECT:
+		return "ICA_SUBJECT"
+	}
+	panic(fmt.Errorf("unhandled NameLocation: %d", l))
+}
+func (l NameLocation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
+}
+
+// A NameDifference is how the ICA's name differs from the name it's compared with.
+type NameDifference int
+
+const (
+	NAME_DIFFERENCE_NONE NameDifference = iota
+	// The common name has a different value
+	NAME_DIFFERENCE_VALUE
+	// Every attribute is a UTF8String instead of a PrintableString
+	NAME_DIFFERENCE_STRING_TYPE
+	// The common name is uppercase
+	NAME_DIFFERENCE_CASE
+	// The common name has a leading space, a trailing space, or its internal space doubled
+	NAME_DIFFERENCE_LEADING_SPACE
+	NAME_DIFFERENCE_TRAILING_SPACE
+	NAME_DIFFERENCE_INTERNAL_SPACE
+	// The RDNs are in reverse order
+	NAME_DIFFERENCE_RDN_ORDER
+	// Every attribute is in a single, multi-valued RDN
+	NAME_DIFFERENCE_MULTI_VALUED_RDN
+	// The common name's value is an organizationalUnitName instead
+	NAME_DIFFERENCE_ATTRIBUTE_TYPE
+	// The serialNumber attribute is left out
+	NAME_DIFFERENCE_MISSING_ATTRIBUTE
+)
+
+var ALL_NAME_DIFFERENCES = []NameDifference{NAME_DIFFERENCE_VALUE, NAME_DIFFERENCE_STRING_TYPE, NAME_DIFFERENCE_CASE,
+	NAME_DIFFERENCE_LEADING_SPACE, NAME_DIFFERENCE_TRAILING_SPACE, NAME_DIFFERENCE_INTERNAL_SPACE,
+	NAME_DIFFERENCE_RDN_ORDER, NAME_DIFFERENCE_MULTI_VALUED_RDN, NAME_DIFFERENCE_ATTRIBUTE_TYPE,
+	NAME_DIFFERENCE_MISSING_ATTRIBUTE}
+
+func (d NameDifference) String() string {
+	switch d {
+	case NAME_DIFFERENCE_NONE:
+		return "NONE"
+	case NAME_DIFFERENCE_VALUE:
+		return "VALUE"
+	case NAME_DIFFERENCE_STRING_TYPE:
+		return "STRING_TYPE"
+	case NAME_DIFFERENCE_CASE:
+		return "CASE"
+	case NAME_DIFFERENCE_LEADING_SPACE:
+		return "LEADING_SPACE"
+	case NAME_DIFFERENCE_TRAILING_SPACE:
+		return "TRAILING_SPACE"
+	case NAME_DIFFERENCE_INTERNAL_SPACE:
+		return "INTERNAL_SPACE"
+	case NAME_DIFFERENCE_RDN_ORDER:
+		return "RDN_ORDER"
+	case NAME_DIFFERENCE_MULTI_VALUED_RDN:
+		return "MULTI_VALUED_RDN"
+	case NAME_DIFFERENCE_ATTRIBUTE_TYPE:
+		return "ATTRIBUTE_TYPE"
+	case NAME_DIFFERENCE_MISSING_ATTRIBUTE:
+		return "MISSING_ATTRIBUTE"
+	}
+	panic(fmt.Errorf("unhandled NameDifference: %d", d))
+}
+func (d NameDifference) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// mapCommonName replaces the value of the common name in an RDN sequence.
+func mapCommonName(rdns pkix.RDNSequence, f func(value string) string) {
+	for _, rdn := range rdns {
+		for i, atv := range rdn {
+			if atv.Type.Equal(oidCommonName) {
+				rdn[i].Value = f(atv.Value.(string))
+			}
+		}
+	}
+}
+
+// encode returns the DER encoding of a name with the difference applied. Names produced by x509.CreateCertificate use
+// PrintableStrings for all of the attributes here.
+func (d NameDifference) encode(name pkix.Name) ([]byte, error) {
+	rdns := name.ToRDNSequence()
+	switch d {
+	case NAME_DIFFERENCE_NONE:
+		return nil, nil
+	case NAME_DIFFERENCE_VALUE:
+		mapCommonName(rdns, func(value string) string { return value + " 2" })
+	case NAME_DIFFERENCE_STRING_TYPE:
+		for _, rdn := range rdns {
+			for i, atv := range rdn {
+				rdn[i].Value = asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte(atv.Value.(string))}
+			}
+		}
+	case NAME_DIFFERENCE_CASE:
+		mapCommonName(rdns, strings.ToUpper)
+	case NAME_DIFFERENCE_LEADING_SPACE:
+		mapCommonName(rdns, func(value string) string { return " " + value })
+	case NAME_DIFFERENCE_TRAILING_SPACE:
+		mapCommonName(rdns, func(value string) string { return value + " " })
+	case NAME_DIFFERENCE_INTERNAL_SPACE:
+		mapCommonName(rdns, func(value string) string { return strings.ReplaceAll(value, " ", "  ") })
+	case NAME_DIFFERENCE_RDN_ORDER:
+		for i, j := 0, len(rdns)-1; i < j; i, j = i+1, j-1 {
+			rdns[i], rdns[j] = rdns[j], rdns[i]
+		}
+	case NAME_DIFFERENCE_MULTI_VALUED_RDN:
+		var rdn pkix.RelativeDistinguishedNameSET
+		for _, r := range rdns {
+			rdn = append(rdn, r...)
+		}
+		rdns = pkix.RDNSequence{rdn}
+	case NAME_DIFFERENCE_ATTRIBUTE_TYPE:
+		for _, rdn := range rdns {
+			for i, atv := range rdn {
+				if atv.Type.Equal(oidCommonName) {
+					rdn[i].Type = oidOrganizationalUnit
+				}
+			}
+		}
+	case NAME_DIFFERENCE_MISSING_ATTRIBUTE:
+		var filtered pkix.RDNSequence
+		for _, rdn := range rdns {
+			if len(rdn) == 1 && rdn[0].Type.Equal(oidSerialNumber) {
+				continue
+			}
+			filtered = append(filtered, rdn)
+		}
+		rdns = filtered
+	default:
+		panic(fmt.Errorf("unhandled NameDifference: %d", d))
+	}
+	return asn1.Marshal(rdns)
+}
+
+// A NameChainingTestCase presents a chain where the leaf's issuer and the ICA's subject are the same name, encoded
+// differently.
+type NameChainingTestCase struct {
+	Location   NameLocation
+	Difference NameDifference
+}
+
+func (t *NameChainingTestCase) ExpectedResult() test_case.ExpectedResult {
+	switch t.Difference {
+	case NAME_DIFFERENCE_NONE:
+		return test_case.EXPECTED_RESULT_PASS
+	case NAME_DIFFERENCE_STRING_TYPE, NAME_DIFFERENCE_CASE, NAME_DIFFERENCE_LEADING_SPACE, NAME_DIFFERENCE_TRAILING_SPACE,
+		NAME_DIFFERENCE_INTERNAL_SPACE:
+		// RFC 5280 section 7.1 compares names after RFC 4518 string preparation, which ignores these differences.
+		// But section 4.1.2.4 also requires CAs to copy the issuer name byte-for-byte, and many clients rely on that.
+		return test_case.EXPECTED_RESULT_SOFT_PASS
+	case NAME_DIFFERENCE_VALUE, NAME_DIFFERENCE_RDN_ORDER, NAME_DIFFERENCE_MULTI_VALUED_RDN, NAME_DIFFERENCE_ATTRIBUTE_TYPE,
+		NAME_DIFFERENCE_MISSING_ATTRIBUTE:
+		// These are different names
+		return test_case.EXPECTED_RESULT_FAIL
+	}
+	panic(fmt.Errorf("unhandled NameDifference: %d", t.Difference))
+}
+
+func (t *NameChainingTestCase) GetHostname() string {
+	return "localhost"
+}
+
+func (t *NameChainingTestCase) RequiredFeatures() []test_case.Feature {
+	return nil
+}
+
+func (t *NameChainingTestCase) GetCertificates(rootCert *x509.Certificate, rootKey crypto.Signer) (*tls.Certificate, error) {
+	artifacts, err := t.GetArtifacts(&test_case.Environment{RootCert: rootCert, RootKey: rootKey})
+	if err != nil {
+		return nil, err
+	}
+	return artifacts.Certificate, nil
+}
+
+func (t *NameChainingTestCase) GetArtifacts(env *test_case.Environment) (*test_case.Artifacts, error) {
+	options := &pathbuilding.GenerateOptions{}
+	switch t.Location {
+	case NAME_LOCATION_LEAF_ISSUER:
+		options.EncodeIssuer = func(edge pathbuilding.Edge, issuer pkix.Name) ([]byte, error) {
+			if edge.Source != ICA_NODE {
+				return nil, nil
+			}
+			return t.Difference.encode(issuer)
+		}
+	case NAME_LOCATION_ICA_SUBJECT:
+		options.EncodeSubject = func(edge pathbuilding.Edge, subject pkix.Name) ([]byte, error) {
+			if edge.Destination != ICA_NODE {
+				return nil, nil
+			}
+			return t.Difference.encode(subject)
+		}
+	default:
+		panic(fmt.Errorf("unhandled NameLocation: %d", t.Location))
+	}
+
+	generated, err := pathbuilding.GenerateCertsWithOptions(env.RootCert, env.RootKey, t.GetHostname(), &pathbuilding.TestCaseImpl{
+		ExplicitTestCase: &pathbuilding.ExplicitTestCase{
+			TrustGraph: NAME_CHAINING_TRUST_GRAPH,
+			SrcNode:    "Trust Anchor",
+			DstNode:    "EE",
+		},
+	}, options)
+	if err != nil {
+		return nil, err
+	}
+	return &test_case.Artifacts{
+		Certificate:  generated.Chain,
+		TrustAnchors: generated.TrustAnchors,
+	}, nil
+}
@@ -0,0 +1,155 @@
+package namechaining
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/Netflix/bettertls/test-suites/certutil"
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type rawAttribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+// A SET, going by asn1's naming convention
+type rawRdnSET []rawAttribute
+
+// parseRawName parses an encoded name, keeping the string type of each value.
+func parseRawName(t *testing.T, encoded []byte) []rawRdnSET {
+	var rdns []rawRdnSET
+	rest, err := asn1.Unmarshal(encoded, &rdns)
+	require.NoError(t, err)
+	require.Empty(t, rest)
+	return rdns
+}
+
+func attributeTypes(rdns []rawRdnSET) []string {
+	var types []string
+	for _, rdn := range rdns {
+		for _, attribute := range rdn {
+			types = append(types, attribute.Type.String())
+		}
+	}
+	return types
+}
+
+func attributeValue(rdns []rawRdnSET, oid asn1.ObjectIdentifier) *asn1.RawValue {
+	for _, rdn := range rdns {
+		for _, attribute := range rdn {
+			if attribute.Type.Equal(oid) {
+				return &attribute.Value
+			}
+		}
+	}
+	return nil
+}
+
+func TestNameDifferenceEncode(t *testing.T) {
+	name := pkix.Name{CommonName: ICA_NODE, Organization: []string{"BetterTLS"}, SerialNumber: "1234"}
+	original, err := asn1.Marshal(name.ToRDNSequence())
+	require.NoError(t, err)
+	originalRdns := parseRawName(t, original)
+	require.Len(t, originalRdns, 3)
+	assert.Equal(t, asn1.TagPrintableString, attributeValue(originalRdns, oidCommonName).Tag)
+
+	encoded, err := NAME_DIFFERENCE_NONE.encode(name)
+	require.NoError(t, err)
+	assert.Nil(t, encoded)
+
+	for difference, commonName := range map[NameDifference]string{
+		NAME_DIFFERENCE_VALUE:          "Issuing CA 2",
+		NAME_DIFFERENCE_CASE:           "ISSUING CA",
+		NAME_DIFFERENCE_LEADING_SPACE:  " Issuing CA",
+		NAME_DIFFERENCE_TRAILING_SPACE: "Issuing CA ",
+		NAME_DIFFERENCE_INTERNAL_SPACE: "Issuing  CA",
+	} {
+		encoded, err := difference.encode(name)
+		require.NoError(t, err)
+		rdns := parseRawName(t, encoded)
+		assert.Equal(t, attributeTypes(originalRdns), attributeTypes(rdns), difference.String())
+		value := attributeValue(rdns, oidCommonName)
+		assert.Equal(t, asn1.TagPrintableString, value.Tag, difference.String())
+		assert.Equal(t, commonName, string(value.Bytes), difference.String())
+	}
+
+	encoded, err = NAME_DIFFERENCE_STRING_TYPE.encode(name)
+	require.NoError(t, err)
+	rdns := parseRawName(t, encoded)
+	assert.Equal(t, attributeTypes(originalRdns), attributeTypes(rdns))
+	for i, rdn := range rdns {
+		require.Len(t, rdn, 1)
+		assert.Equal(t, asn1.TagUTF8String, rdn[0].Value.Tag)
+		assert.Equal(t, originalRdns[i][0].Value.Bytes, rdn[0].Value.Bytes)
+	}
+
+	encoded, err = NAME_DIFFERENCE_RDN_ORDER.encode(name)
+	require.NoError(t, err)
+	rdns = parseRawName(t, encoded)
+	require.Len(t, rdns, 3)
+	for i := range rdns {
+		assert.Equal(t, originalRdns[len(originalRdns)-1-i], rdns[i])
+	}
+
+	encoded, err = NAME_DIFFERENCE_MULTI_VALUED_RDN.encode(name)
+	require.NoError(t, err)
+	rdns = parseRawName(t, encoded)
+	require.Len(t, rdns, 1)
+	assert.ElementsMatch(t, attributeTypes(originalRdns), attributeTypes(rdns))
+
+	encoded, err = NAME_DIFFERENCE_ATTRIBUTE_TYPE.encode(name)
+	require.NoError(t, err)
+	rdns = parseRawName(t, encoded)
+	assert.Nil(t, attributeValue(rdns, oidCommonName))
+	require.NotNil(t, attributeValue(rdns, oidOrganizationalUnit))
+	assert.Equal(t, ICA_NODE, string(attributeValue(rdns, oidOrganizationalUnit).Bytes))
+
+	encoded, err = NAME_DIFFERENCE_MISSING_ATTRIBUTE.encode(name)
+	require.NoError(t, err)
+	rdns = parseRawName(t, encoded)
+	assert.Len(t, rdns, 2)
+	assert.Nil(t, attributeValue(rdns, oidSerialNumber))
+}
+
+func TestNameChainingCertificates(t *testing.T) {
+	rootCert, rootKey, err := certutil.GenerateSelfSignedCert("root")
+	require.NoError(t, err)
+	env := &test_case.Environment{RootCert: rootCert, RootKey: rootKey}
+
+	for _, location := range ALL_NAME_LOCATIONS {
+		for _, difference := range append([]NameDifference{NAME_DIFFERENCE_NONE}, ALL_NAME_DIFFERENCES...) {
+			testCase := &NameChainingTestCase{Location: location, Difference: difference}
+			name := location.String() + "/" + difference.String()
+			artifacts, err := testCase.GetArtifacts(env)
+			require.NoError(t, err, name)
+			require.GreaterOrEqual(t, len(artifacts.Certificate.Certificate), 2, name)
+			leaf, err := x509.ParseCertificate(artifacts.Certificate.Certificate[0])
+			require.NoError(t, err, name)
+			ica, err := x509.ParseCertificate(artifacts.Certificate.Certificate[1])
+			require.NoError(t, err, name)
+
+			// Only the copy at the test's location is re-encoded
+			assert.Equal(t, difference == NAME_DIFFERENCE_NONE, bytes.Equal(leaf.RawIssuer, ica.RawSubject), name)
+			changed, unchanged := ica.RawSubject, leaf.RawIssuer
+			if location == NAME_LOCATION_LEAF_ISSUER {
+				changed, unchanged = leaf.RawIssuer, ica.RawSubject
+			}
+			if difference != NAME_DIFFERENCE_NONE {
+				var unchangedName pkix.RDNSequence
+				_, err = asn1.Unmarshal(unchanged, &unchangedName)
+				require.NoError(t, err, name)
+				var parsed pkix.Name
+				parsed.FillFromRDNSequence(&unchangedName)
+				expected, err := difference.encode(parsed)
+				require.NoError(t, err, name)
+				assert.Equal(t, expected, changed, name)
+			}
+		}
+	}
+}
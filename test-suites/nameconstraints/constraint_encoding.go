@@ -0,0 +1,266 @@
+package nameconstraints
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"github.com/Netflix/bettertls/test-suites/certutil"
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+	"net"
+	"strings"
+)
+
+// A ConstraintEncoding is a malformed or ambiguous way of encoding a name constraint (or the name it's checked
+// against) that x509.CreateCertificate would never produce.
+type ConstraintEncoding byte
+
+const (
+	// A DNS constraint of ".localhost". Leading dots are only meaningful in email and URI constraints.
+	CONSTRAINT_ENCODING_DNS_LEADING_DOT ConstraintEncoding = iota
+	// A DNS constraint of ".test.localhost", which contains the client's hostname only if the leading dot is ignored
+	CONSTRAINT_ENCODING_DNS_LEADING_DOT_EXACT
+	// An empty DNS constraint, which every DNS name can be constructed from by adding labels
+	CONSTRAINT_ENCODING_DNS_EMPTY
+	// A DNS constraint of "LOCALHOST". DNS names are case-insensitive.
+	CONSTRAINT_ENCODING_DNS_UPPERCASE
+	// A DNS constraint of "localhost."
+	CONSTRAINT_ENCODING_DNS_TRAILING_DOT
+	// A DNS constraint of "localhost" with a DNS SAN of "TEST.LOCALHOST"
+	CONSTRAINT_ENCODING_DNS_UPPERCASE_SAN
+	// A DNS constraint of "localhost" with a DNS SAN of "test.localhost."
+	CONSTRAINT_ENCODING_DNS_TRAILING_DOT_SAN
+	// An IP constraint of 127.0.0.0 with the non-contiguous mask 255.0.255.0
+	CONSTRAINT_ENCODING_IP_NON_CONTIGUOUS_MASK
+	// IP constraints of a length other than 8 (IPv4) or 32 (IPv6) bytes
+	CONSTRAINT_ENCODING_IP_LENGTH_5
+	CONSTRAINT_ENCODING_IP_LENGTH_9
+	// An IPv6 constraint of ::ffff:127.0.0.0/120, which holds 127.0.0.0/24 as IPv4-mapped IPv6 addresses
+	CONSTRAINT_ENCODING_IP_LENGTH_32
+	// A NameConstraints extension with neither permitted nor excluded subtrees
+	CONSTRAINT_ENCODING_EMPTY_EXTENSION
+)
+
+func (e ConstraintEncoding) String() string {
+	switch e {
+	case CONSTRAINT_ENCODING_DNS_LEADING_DOT:
+		return "DNS_LEADING_DOT"
+	case CONSTRAINT_ENCODING_DNS_LEADING_DOT_EXACT:
+		return "DNS_LEADING_DOT_EXACT"
+	case CONSTRAINT_ENCODING_DNS_EMPTY:
+		return "DNS_EMPTY"
+	case CONSTRAINT_ENCODING_DNS_UPPERCASE:
+		return "DNS_UPPERCASE"
+	case CONSTRAINT_ENCODING_DNS_TRAILING_DOT:
+		return "DNS_TRAILING_DOT"
+	case CONSTRAINT_ENCODING_DNS_UPPERCASE_SAN:
+		return "DNS_UPPERCASE_SAN"
+	case CONSTRAINT_ENCODING_DNS_TRAILING_DOT_SAN:
+		return "DNS_TRAILING_DOT_SAN"
+	case CONSTRAINT_ENCODING_IP_NON_CONTIGUOUS_MASK:
+		return "IP_NON_CONTIGUOUS_MASK"
+	case CONSTRAINT_ENCODING_IP_LENGTH_5:
+		return "IP_LENGTH_5"
+	case CONSTRAINT_ENCODING_IP_LENGTH_9:
+		return "IP_LENGTH_9"
+	case CONSTRAINT_ENCODING_IP_LENGTH_32:
+		return "IP_LENGTH_32"
+	case CONSTRAINT_ENCODING_EMPTY_EXTENSION:
+		return "EMPTY_EXTENSION"
+	}
+	panic(fmt.Errorf("unhandled ConstraintEncoding: %d", e))
+}
+func (e ConstraintEncoding) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.String())
+}
+
+var ALL_CONSTRAINT_ENCODINGS = []ConstraintEncoding{CONSTRAINT_ENCODING_DNS_LEADING_DOT, CONSTRAINT_ENCODING_DNS_LEADING_DOT_EXACT,
+	CONSTRAINT_ENCODING_DNS_EMPTY, CONSTRAINT_ENCODING_DNS_UPPERCASE, CONSTRAINT_ENCODING_DNS_TRAILING_DOT,
+	CONSTRAINT_ENCODING_DNS_UPPERCASE_SAN, CONSTRAINT_ENCODING_DNS_TRAILING_DOT_SAN, CONSTRAINT_ENCODING_IP_NON_CONTIGUOUS_MASK,
+	CONSTRAINT_ENCODING_IP_LENGTH_5, CONSTRAINT_ENCODING_IP_LENGTH_9, CONSTRAINT_ENCODING_IP_LENGTH_32,
+	CONSTRAINT_ENCODING_EMPTY_EXTENSION}
+
+func (e ConstraintEncoding) isIp() bool {
+	return e == CONSTRAINT_ENCODING_IP_NON_CONTIGUOUS_MASK || e == CONSTRAINT_ENCODING_IP_LENGTH_5 ||
+		e == CONSTRAINT_ENCODING_IP_LENGTH_9 || e == CONSTRAINT_ENCODING_IP_LENGTH_32
+}
+
+// subtree returns the raw GeneralName used as the constraint.
+func (e ConstraintEncoding) subtree() certutil.GeneralName {
+	switch e {
+	case CONSTRAINT_ENCODING_DNS_LEADING_DOT:
+		return certutil.GeneralName{Type: certutil.NAME_TYPE_DNS, Value: []byte("." + VALID_DNS_TREE)}
+	case CONSTRAINT_ENCODING_DNS_LEADING_DOT_EXACT:
+		return certutil.GeneralName{Type: certutil.NAME_TYPE_DNS, Value: []byte("." + VALID_DNS_NAME)}
+	case CONSTRAINT_ENCODING_DNS_EMPTY:
+		return certutil.GeneralName{Type: certutil.NAME_TYPE_DNS, Value: []byte{}}
+	case CONSTRAINT_ENCODING_DNS_UPPERCASE:
+		return certutil.GeneralName{Type: certutil.NAME_TYPE_DNS, Value: []byte(strings.ToUpper(VALID_DNS_TREE))}
+	case CONSTRAINT_ENCODING_DNS_TRAILING_DOT:
+		return certutil.GeneralName{Type: certutil.NAME_TYPE_DNS, Value: []byte(VALID_DNS_TREE + ".")}
+	case CONSTRAINT_ENCODING_DNS_UPPERCASE_SAN, CONSTRAINT_ENCODING_DNS_TRAILING_DOT_SAN:
+		return certutil.GeneralName{Type: certutil.NAME_TYPE_DNS, Value: []byte(VALID_DNS_TREE)}
+	case CONSTRAINT_ENCODING_IP_NON_CONTIGUOUS_MASK:
+		return certutil.GeneralName{Type: certutil.NAME_TYPE_IP, Value: []byte{127, 0, 0, 0, 255, 0, 255, 0}}
+	case CONSTRAINT_ENCODING_IP_LENGTH_5:
+		return certutil.GeneralName{Type: certutil.NAME_TYPE_IP, Value: []byte{127, 0, 0, 0, 255}}
+	case CONSTRAINT_ENCODING_IP_LENGTH_9:
+		return certutil.GeneralName{Type: certutil.NAME_TYPE_IP, Value: []byte{127, 0, 0, 0, 255, 255, 255, 0, 0}}
+	case CONSTRAINT_ENCODING_IP_LENGTH_32:
+		_, ipRange, err := net.ParseCIDR("::ffff:127.0.0.0/120")
+		if err != nil {
+			panic(err)
+		}
+		return certutil.GeneralName{Type: certutil.NAME_TYPE_IP, Value: append(ipRange.IP.To16(), ipRange.Mask...)}
+	}
+	panic(fmt.Errorf("unhandled ConstraintEncoding: %d", e))
+}
+
+// san returns the raw GeneralName used as the leaf's SAN.
+func (e ConstraintEncoding) san() certutil.GeneralName {
+	switch e {
+	case CONSTRAINT_ENCODING_DNS_UPPERCASE_SAN:
+		return certutil.GeneralName{Type: certutil.NAME_TYPE_DNS, Value: []byte(strings.ToUpper(VALID_DNS_NAME))}
+	case CONSTRAINT_ENCODING_DNS_TRAILING_DOT_SAN:
+		return certutil.GeneralName{Type: certutil.NAME_TYPE_DNS, Value: []byte(VALID_DNS_NAME + ".")}
+	}
+	if e.isIp() {
+		return certutil.GeneralName{Type: certutil.NAME_TYPE_IP, Value: rawIp(VALID_IP)}
+	}
+	return certutil.GeneralName{Type: certutil.NAME_TYPE_DNS, Value: []byte(VALID_DNS_NAME)}
+}
+
+// A ConstraintEncodingTestCase has a local_ica with a single, oddly encoded, permitted or excluded subtree which
+// (under at least one reading) contains the client's hostname.
+type ConstraintEncodingTestCase struct {
+	Encoding ConstraintEncoding
+	// Whether the subtree is excluded rather than permitted
+	Excluded bool
+}
+
+func (c ConstraintEncodingTestCase) ExpectedResult() test_case.ExpectedResult {
+	switch c.Encoding {
+	case CONSTRAINT_ENCODING_DNS_UPPERCASE, CONSTRAINT_ENCODING_DNS_UPPERCASE_SAN:
+		// Not ambiguous at all: the constraint matches the hostname
+		if c.Excluded {
+			return test_case.EXPECTED_RESULT_FAIL
+		}
+		return test_case.EXPECTED_RESULT_PASS
+	case CONSTRAINT_ENCODING_DNS_LEADING_DOT, CONSTRAINT_ENCODING_DNS_EMPTY, CONSTRAINT_ENCODING_DNS_TRAILING_DOT:
+		// The constraint most likely matches the hostname, but rejecting it as malformed is fine too. Either way, an
+		// excluded subtree must not be bypassed.
+		if c.Excluded {
+			return test_case.EXPECTED_RESULT_FAIL
+		}
+		return test_case.EXPECTED_RESULT_SOFT_PASS
+	case CONSTRAINT_ENCODING_DNS_LEADING_DOT_EXACT, CONSTRAINT_ENCODING_IP_LENGTH_32:
+		// The constraint only matches the hostname under a lax reading (ignoring the leading dot, or treating IPv4
+		// and IPv4-mapped IPv6 addresses as the same)
+		if c.Excluded {
+			return test_case.EXPECTED_RESULT_SOFT_PASS
+		}
+		return test_case.EXPECTED_RESULT_SOFT_FAIL
+	case CONSTRAINT_ENCODING_DNS_TRAILING_DOT_SAN, CONSTRAINT_ENCODING_IP_NON_CONTIGUOUS_MASK:
+		// The hostname might not match the SAN, or the constraint might be rejected as malformed. But if it is
+		// accepted, an excluded subtree must not be bypassed.
+		if c.Excluded {
+			return test_case.EXPECTED_RESULT_FAIL
+		}
+		return test_case.EXPECTED_RESULT_SOFT_PASS
+	case CONSTRAINT_ENCODING_IP_LENGTH_5, CONSTRAINT_ENCODING_IP_LENGTH_9:
+		// These can't be parsed as an IP range. Ignoring an unparseable excluded subtree would fail open.
+		if c.Excluded {
+			return test_case.EXPECTED_RESULT_FAIL
+		}
+		return test_case.EXPECTED_RESULT_SOFT_FAIL
+	case CONSTRAINT_ENCODING_EMPTY_EXTENSION:
+		// RFC 5280 forbids CAs from issuing these, but an empty extension doesn't constrain anything
+		return test_case.EXPECTED_RESULT_SOFT_PASS
+	}
+	panic(fmt.Errorf("unhandled ConstraintEncoding: %d", c.Encoding))
+}
+
+func (c ConstraintEncodingTestCase) GetHostname() string {
+	if c.Encoding.isIp() {
+		return VALID_IP
+	}
+	return VALID_DNS_NAME
+}
+
+func (c ConstraintEncodingTestCase) RequiredFeatures() []test_case.Feature {
+	return []test_case.Feature{FEATURE_NAME_CONSTRAINTS}
+}
+
+func (c ConstraintEncodingTestCase) GetCertificates(rootCert *x509.Certificate, rootKey crypto.Signer) (*tls.Certificate, error) {
+	localRoot, localRootKey, err := createCaCert("local_root", rootCert, rootKey, func(template *x509.Certificate) {})
+	if err != nil {
+		return nil, err
+	}
+
+	var permitted, excluded []certutil.GeneralName
+	if c.Encoding != CONSTRAINT_ENCODING_EMPTY_EXTENSION {
+		if c.Excluded {
+			excluded = append(excluded, c.Encoding.subtree())
+		} else {
+			permitted = append(permitted, c.Encoding.subtree())
+		}
+	}
+	ncExt, err := certutil.BuildNameConstraintsExtension(true, permitted, excluded)
+	if err != nil {
+		return nil, err
+	}
+	// Go refuses to parse most of these ICAs
+	localIca, localIcaKey, err := certutil.CreateUnparsedCaCert(&x509.Certificate{
+		SerialNumber: certutil.RandomSerial(),
+		Subject: pkix.Name{
+			CommonName:   "local_ica",
+			Organization: []string{certutil.SUBJECT_ORGANIZATION},
+			SerialNumber: certutil.RandomString(),
+		},
+		NotBefore:             certutil.GetNotBefore(),
+		NotAfter:              certutil.GetNotAfter(false),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		ExtraExtensions:       []pkix.Extension{ncExt},
+	}, localRoot, localRootKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sanExt, err := certutil.BuildSanExtension(false, []certutil.GeneralName{c.Encoding.san()})
+	if err != nil {
+		return nil, err
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	leafCertBytes, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: certutil.RandomSerial(),
+		Subject: pkix.Name{
+			Organization: []string{certutil.SUBJECT_ORGANIZATION},
+			SerialNumber: certutil.RandomString(),
+		},
+		NotBefore:             certutil.GetNotBefore(),
+		NotAfter:              certutil.GetNotAfter(false),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		ExtraExtensions:       []pkix.Extension{sanExt},
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+	}, localIca, leafKey.Public(), localIcaKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{leafCertBytes, localIca.Raw, localRoot.Raw, rootCert.Raw},
+		PrivateKey:  leafKey,
+	}, nil
+}
@@ -0,0 +1,90 @@
+package nameconstraints
+
+import (
+	"crypto/x509"
+	"strings"
+	"testing"
+
+	"github.com/Netflix/bettertls/test-suites/certutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// der encodes a DER element with a short length.
+func der(tag byte, content ...[]byte) []byte {
+	var body []byte
+	for _, c := range content {
+		body = append(body, c...)
+	}
+	return append([]byte{tag, byte(len(body))}, body...)
+}
+
+func TestConstraintEncodingValues(t *testing.T) {
+	// The constraints and SANs are encoded exactly as written, with GeneralName tags [2] (dNSName) and [7] (iPAddress)
+	for encoding, expected := range map[ConstraintEncoding][2][]byte{
+		CONSTRAINT_ENCODING_DNS_LEADING_DOT:        {der(0x82, []byte(".localhost")), der(0x82, []byte("test.localhost"))},
+		CONSTRAINT_ENCODING_DNS_LEADING_DOT_EXACT:  {der(0x82, []byte(".test.localhost")), der(0x82, []byte("test.localhost"))},
+		CONSTRAINT_ENCODING_DNS_EMPTY:              {der(0x82), der(0x82, []byte("test.localhost"))},
+		CONSTRAINT_ENCODING_DNS_UPPERCASE:          {der(0x82, []byte("LOCALHOST")), der(0x82, []byte("test.localhost"))},
+		CONSTRAINT_ENCODING_DNS_TRAILING_DOT:       {der(0x82, []byte("localhost.")), der(0x82, []byte("test.localhost"))},
+		CONSTRAINT_ENCODING_DNS_UPPERCASE_SAN:      {der(0x82, []byte("localhost")), der(0x82, []byte("TEST.LOCALHOST"))},
+		CONSTRAINT_ENCODING_DNS_TRAILING_DOT_SAN:   {der(0x82, []byte("localhost")), der(0x82, []byte("test.localhost."))},
+		CONSTRAINT_ENCODING_IP_NON_CONTIGUOUS_MASK: {der(0x87, []byte{127, 0, 0, 0, 255, 0, 255, 0}), der(0x87, []byte{127, 0, 0, 1})},
+		CONSTRAINT_ENCODING_IP_LENGTH_5:            {der(0x87, []byte{127, 0, 0, 0, 255}), der(0x87, []byte{127, 0, 0, 1})},
+		CONSTRAINT_ENCODING_IP_LENGTH_9:            {der(0x87, []byte{127, 0, 0, 0, 255, 255, 255, 0, 0}), der(0x87, []byte{127, 0, 0, 1})},
+		CONSTRAINT_ENCODING_IP_LENGTH_32: {
+			der(0x87, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 127, 0, 0, 0},
+				[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0}),
+			der(0x87, []byte{127, 0, 0, 1}),
+		},
+	} {
+		subtree, err := certutil.BuildSanExtension(false, []certutil.GeneralName{encoding.subtree()})
+		require.NoError(t, err)
+		assert.Equal(t, der(0x30, expected[0]), subtree.Value, encoding.String())
+		san, err := certutil.BuildSanExtension(false, []certutil.GeneralName{encoding.san()})
+		require.NoError(t, err)
+		assert.Equal(t, der(0x30, expected[1]), san.Value, encoding.String())
+	}
+}
+
+func TestConstraintEncodingCertificates(t *testing.T) {
+	root, rootKey, err := certutil.GenerateSelfSignedCert("root")
+	require.NoError(t, err)
+
+	for _, encoding := range ALL_CONSTRAINT_ENCODINGS {
+		for _, excluded := range []bool{false, true} {
+			testCase := ConstraintEncodingTestCase{Encoding: encoding, Excluded: excluded}
+			name := testCase.Encoding.String()
+			assert.NotPanics(t, func() { testCase.ExpectedResult() }, name)
+			certificate, err := testCase.GetCertificates(root, rootKey)
+			require.NoError(t, err, name)
+			require.Len(t, certificate.Certificate, 4, name)
+			assert.Equal(t, root.Raw, certificate.Certificate[3], name)
+
+			// The local_ica's NameConstraints extension holds the subtree, as permitted ([0]) or excluded ([1])
+			ica := certificate.Certificate[1]
+			if encoding == CONSTRAINT_ENCODING_EMPTY_EXTENSION {
+				assert.Contains(t, string(ica), string(der(0x04, der(0x30))), name)
+				continue
+			}
+			subtreeTag := byte(0xa0)
+			if excluded {
+				subtreeTag = 0xa1
+			}
+			subtree, err := certutil.BuildSanExtension(false, []certutil.GeneralName{encoding.subtree()})
+			require.NoError(t, err)
+			assert.Contains(t, string(ica), string(der(subtreeTag, subtree.Value)), name)
+
+			// Go can always parse the leaf, and its SAN is the hostname up to case and a trailing dot
+			leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+			require.NoError(t, err, name)
+			if encoding.isIp() {
+				require.Len(t, leaf.IPAddresses, 1, name)
+				assert.Equal(t, testCase.GetHostname(), leaf.IPAddresses[0].String(), name)
+			} else {
+				require.Len(t, leaf.DNSNames, 1, name)
+				assert.Equal(t, testCase.GetHostname(), strings.TrimSuffix(strings.ToLower(leaf.DNSNames[0]), "."), name)
+			}
+		}
+	}
+}
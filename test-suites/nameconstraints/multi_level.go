@@ -0,0 +1,298 @@
+package nameconstraints
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"github.com/Netflix/bettertls/test-suites/certutil"
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+	"strings"
+)
+
+const SIBLING_DNS_NAME = "other.localhost"
+
+// A DnsSubtreeConstraint is a DNS name constraint placed on one of the CAs in a MultiLevelTestCase.
+type DnsSubtreeConstraint byte
+
+const (
+	DNS_SUBTREE_NONE DnsSubtreeConstraint = iota
+	// Permits VALID_DNS_TREE, which contains the client's hostname
+	DNS_SUBTREE_PERMIT_PARENT
+	// Permits exactly the client's hostname
+	DNS_SUBTREE_PERMIT_EXACT
+	// Permits INVALID_DNS_TREE, which is disjoint from the client's hostname
+	DNS_SUBTREE_PERMIT_DISJOINT
+	// Excludes exactly the client's hostname
+	DNS_SUBTREE_EXCLUDE_EXACT
+	// Excludes a sibling of the client's hostname under VALID_DNS_TREE
+	DNS_SUBTREE_EXCLUDE_SIBLING
+	// Excludes INVALID_DNS_TREE
+	DNS_SUBTREE_EXCLUDE_DISJOINT
+)
+
+var ALL_DNS_SUBTREE_CONSTRAINTS = []DnsSubtreeConstraint{DNS_SUBTREE_NONE, DNS_SUBTREE_PERMIT_PARENT, DNS_SUBTREE_PERMIT_EXACT,
+	DNS_SUBTREE_PERMIT_DISJOINT, DNS_SUBTREE_EXCLUDE_EXACT, DNS_SUBTREE_EXCLUDE_SIBLING, DNS_SUBTREE_EXCLUDE_DISJOINT}
+
+func (c DnsSubtreeConstraint) String() string {
+	switch c {
+	case DNS_SUBTREE_NONE:
+		return "NONE"
+	case DNS_SUBTREE_PERMIT_PARENT:
+		return "PERMIT_PARENT"
+	case DNS_SUBTREE_PERMIT_EXACT:
+		return "PERMIT_EXACT"
+	case DNS_SUBTREE_PERMIT_DISJOINT:
+		return "PERMIT_DISJOINT"
+	case DNS_SUBTREE_EXCLUDE_EXACT:
+		return "EXCLUDE_EXACT"
+	case DNS_SUBTREE_EXCLUDE_SIBLING:
+		return "EXCLUDE_SIBLING"
+	case DNS_SUBTREE_EXCLUDE_DISJOINT:
+		return "EXCLUDE_DISJOINT"
+	}
+	panic(fmt.Errorf("unhandled DnsSubtreeConstraint: %d", c))
+}
+func (c DnsSubtreeConstraint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+func (c DnsSubtreeConstraint) subtrees() (permitted []string, excluded []string) {
+	switch c {
+	case DNS_SUBTREE_NONE:
+	case DNS_SUBTREE_PERMIT_PARENT:
+		permitted = []string{VALID_DNS_TREE}
+	case DNS_SUBTREE_PERMIT_EXACT:
+		permitted = []string{VALID_DNS_NAME}
+	case DNS_SUBTREE_PERMIT_DISJOINT:
+		permitted = []string{INVALID_DNS_TREE}
+	case DNS_SUBTREE_EXCLUDE_EXACT:
+		excluded = []string{VALID_DNS_NAME}
+	case DNS_SUBTREE_EXCLUDE_SIBLING:
+		excluded = []string{SIBLING_DNS_NAME}
+	case DNS_SUBTREE_EXCLUDE_DISJOINT:
+		excluded = []string{INVALID_DNS_TREE}
+	default:
+		panic(fmt.Errorf("unhandled DnsSubtreeConstraint: %d", c))
+	}
+	return
+}
+
+func (c DnsSubtreeConstraint) apply(template *x509.Certificate) {
+	if c == DNS_SUBTREE_NONE {
+		return
+	}
+	template.PermittedDNSDomainsCritical = true
+	template.PermittedDNSDomains, template.ExcludedDNSDomains = c.subtrees()
+}
+
+// dnsNameInSubtree reports whether a DNS name is within the subtree rooted at the given DNS name.
+func dnsNameInSubtree(name string, subtree string) bool {
+	return name == subtree || strings.HasSuffix(name, "."+subtree)
+}
+
+// effectiveDnsSubtrees is the result of processing the DNS name constraints of several CAs along a path, as in
+// RFC 5280 section 6.1.4 (g).
+type effectiveDnsSubtrees struct {
+	// If false, every name is permitted (no CA has restricted the permitted subtrees yet)
+	restricted bool
+	permitted  []string
+	excluded   []string
+}
+
+// intersect adds the constraints of another CA: permitted subtrees are intersected and excluded subtrees are unioned.
+func (e effectiveDnsSubtrees) intersect(c DnsSubtreeConstraint) effectiveDnsSubtrees {
+	permitted, excluded := c.subtrees()
+	result := effectiveDnsSubtrees{
+		restricted: e.restricted,
+		permitted:  e.permitted,
+		excluded:   append(append([]string{}, e.excluded...), excluded...),
+	}
+	if len(permitted) == 0 {
+		return result
+	}
+	if !e.restricted {
+		result.restricted = true
+		result.permitted = permitted
+		return result
+	}
+	// The intersection of two DNS subtrees is the narrower one if one contains the other, and empty otherwise
+	result.permitted = nil
+	for _, a := range e.permitted {
+		for _, b := range permitted {
+			if dnsNameInSubtree(a, b) {
+				result.permitted = append(result.permitted, a)
+			} else if dnsNameInSubtree(b, a) {
+				result.permitted = append(result.permitted, b)
+			}
+		}
+	}
+	return result
+}
+
+func (e effectiveDnsSubtrees) permits(name string) bool {
+	for _, subtree := range e.excluded {
+		if dnsNameInSubtree(name, subtree) {
+			return false
+		}
+	}
+	if !e.restricted {
+		return true
+	}
+	for _, subtree := range e.permitted {
+		if dnsNameInSubtree(name, subtree) {
+			return true
+		}
+	}
+	return false
+}
+
+// A MultiLevelTestCase spreads DNS name constraints across every CA in the path: the bettertls root, local_root and
+// local_ica. Clients have to intersect the permitted subtrees and union the excluded subtrees of all of them.
+type MultiLevelTestCase struct {
+	RootConstraint      DnsSubtreeConstraint
+	LocalRootConstraint DnsSubtreeConstraint
+	IcaConstraint       DnsSubtreeConstraint
+}
+
+func (m MultiLevelTestCase) ExpectedResult() test_case.ExpectedResult {
+	// RFC 5280 doesn't require constraints in the trust anchor's certificate to be applied, but test cases with them
+	// are only run against clients that have shown they do (FEATURE_CONSTRAINED_ANCHOR)
+	subtrees := effectiveDnsSubtrees{}.intersect(m.RootConstraint).intersect(m.LocalRootConstraint).intersect(m.IcaConstraint)
+	if subtrees.permits(VALID_DNS_NAME) {
+		return test_case.EXPECTED_RESULT_PASS
+	}
+	return test_case.EXPECTED_RESULT_FAIL
+}
+
+func (m MultiLevelTestCase) GetHostname() string {
+	return VALID_DNS_NAME
+}
+
+func (m MultiLevelTestCase) RequiredFeatures() []test_case.Feature {
+	var requiredFeatures []test_case.Feature
+	if m.RootConstraint != DNS_SUBTREE_NONE || m.LocalRootConstraint != DNS_SUBTREE_NONE || m.IcaConstraint != DNS_SUBTREE_NONE {
+		requiredFeatures = append(requiredFeatures, FEATURE_NAME_CONSTRAINTS)
+	}
+	if m.RootConstraint != DNS_SUBTREE_NONE {
+		requiredFeatures = append(requiredFeatures, FEATURE_CONSTRAINED_ANCHOR)
+	}
+	return requiredFeatures
+}
+
+func (m MultiLevelTestCase) GetCertificates(rootCert *x509.Certificate, rootKey crypto.Signer) (*tls.Certificate, error) {
+	artifacts, err := m.GetArtifacts(&test_case.Environment{RootCert: rootCert, RootKey: rootKey})
+	if err != nil {
+		return nil, err
+	}
+	return artifacts.Certificate, nil
+}
+
+// constrainedRootCopy creates a copy of the bettertls root, with the same name and key, that carries the given
+// constraint.
+func constrainedRootCopy(env *test_case.Environment, constraint DnsSubtreeConstraint) (*x509.Certificate, error) {
+	template := &x509.Certificate{
+		SerialNumber:          certutil.RandomSerial(),
+		RawSubject:            env.RootCert.RawSubject,
+		SubjectKeyId:          env.RootCert.SubjectKeyId,
+		NotBefore:             certutil.GetNotBefore(),
+		NotAfter:              certutil.GetNotAfter(false),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	constraint.apply(template)
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, env.RootKey.Public(), env.RootKey)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(certBytes)
+}
+
+// createCaCert creates a CA certificate issued by parent. editTemplate can add constraints to the certificate's
+// template.
+func createCaCert(commonName string, parent *x509.Certificate, parentKey crypto.Signer, editTemplate func(template *x509.Certificate)) (*x509.Certificate, crypto.Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: certutil.RandomSerial(),
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: []string{certutil.SUBJECT_ORGANIZATION},
+			SerialNumber: certutil.RandomString(),
+		},
+		NotBefore:             certutil.GetNotBefore(),
+		NotAfter:              certutil.GetNotAfter(false),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	editTemplate(template)
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+func (m MultiLevelTestCase) GetArtifacts(env *test_case.Environment) (*test_case.Artifacts, error) {
+	root, rootKey := env.RootCert, env.RootKey
+	if m.RootConstraint != DNS_SUBTREE_NONE {
+		// The client trusts a constrained copy of the bettertls root instead of the root itself
+		var err error
+		root, err = constrainedRootCopy(env, m.RootConstraint)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	localRoot, localRootKey, err := createCaCert("local_root", root, rootKey, m.LocalRootConstraint.apply)
+	if err != nil {
+		return nil, err
+	}
+	localIca, localIcaKey, err := createCaCert("local_ica", localRoot, localRootKey, m.IcaConstraint.apply)
+	if err != nil {
+		return nil, err
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	leafCertBytes, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: certutil.RandomSerial(),
+		Subject: pkix.Name{
+			Organization: []string{certutil.SUBJECT_ORGANIZATION},
+			SerialNumber: certutil.RandomString(),
+		},
+		NotBefore:             certutil.GetNotBefore(),
+		NotAfter:              certutil.GetNotAfter(false),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:              []string{VALID_DNS_NAME},
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+	}, localIca, leafKey.Public(), localIcaKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &test_case.Artifacts{
+		Certificate: &tls.Certificate{
+			Certificate: [][]byte{leafCertBytes, localIca.Raw, localRoot.Raw, root.Raw},
+			PrivateKey:  leafKey,
+		},
+		TrustAnchors: []*x509.Certificate{root},
+	}, nil
+}
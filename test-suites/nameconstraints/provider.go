@@ -2,12 +2,16 @@ package nameconstraints
 
 import (
 	"fmt"
+	"github.com/Netflix/bettertls/test-suites/certutil"
 	test_case "github.com/Netflix/bettertls/test-suites/test-case"
 	"net"
 )
 
 type TestCaseProvider struct {
-	testCases []NameConstraintsTestCase
+	testCases                               []test_case.TestCase
+	directoryNameConstraintsFeatureTestCase uint
+	constrainedAnchorFeatureTestCases       []uint
+	nonCriticalFeatureTestCase              uint
 }
 
 const (
@@ -20,7 +24,7 @@ const (
 )
 
 func NewTestCaseProvider() *TestCaseProvider {
-	testCases := make([]NameConstraintsTestCase, 6, 9491)
+	testCases := make([]test_case.TestCase, 6, 16739)
 
 	testCases[SANITY_CHECK_TEST_CASE] = NameConstraintsTestCase{
 		ClientHostnameType:          CLIENT_HOSTNAME_TYPE_DNS,
@@ -102,34 +106,7 @@ func NewTestCaseProvider() *TestCaseProvider {
 	})
 
 	for _, clientHostnameType := range []ClientHostnameType{CLIENT_HOSTNAME_TYPE_DNS, CLIENT_HOSTNAME_TYPE_IP} {
-		for _, commonNameType := range []CommonNameType{CN_TYPE_DNS, CN_TYPE_IP} {
-			for _, commonNameValue := range ALL_TRINARY_VALUES {
-				for _, dnsSan := range ALL_TRINARY_VALUES {
-					for _, ipSan := range ALL_TRINARY_VALUES {
-						for _, dnsWhitelist := range ALL_TRINARY_VALUES {
-							for _, ipWhitelist := range ALL_TRINARY_VALUES {
-								for _, dnsBlacklist := range ALL_TRINARY_VALUES {
-									for _, ipBlacklist := range ALL_TRINARY_VALUES {
-										tc := NameConstraintsTestCase{
-											ClientHostnameType:          clientHostnameType,
-											CommonNameType:              commonNameType,
-											CommonNameValue:             commonNameValue,
-											DnsSan:                      dnsSan,
-											IpSan:                       ipSan,
-											NameConstraintsIpWhitelist:  ipWhitelist,
-											NameConstraintsDnsWhitelist: dnsWhitelist,
-											NameConstraintsIpBlacklist:  ipBlacklist,
-											NameConstraintsDnsBlacklist: dnsBlacklist,
-										}
-										testCases = append(testCases, tc)
-									}
-								}
-							}
-						}
-					}
-				}
-			}
-		}
+		testCases = appendHostnameMatrix(testCases, clientHostnameType)
 	}
 
 	// Try encoding the client-requested hostname/IP into SANs with other tags
@@ -198,13 +175,243 @@ func NewTestCaseProvider() *TestCaseProvider {
 		}
 	}
 
+	// rfc822Name constraints, checked against both email SANs and the subject's emailAddress attribute
+	for _, emailSan := range ALL_TRINARY_VALUES {
+		for _, subjectEmail := range ALL_TRINARY_VALUES {
+			for _, emailWhitelist := range ALL_TRINARY_VALUES {
+				for _, emailBlacklist := range ALL_TRINARY_VALUES {
+					testCases = append(testCases, NameConstraintsTestCase{
+						ClientHostnameType:            CLIENT_HOSTNAME_TYPE_DNS,
+						DnsSan:                        EXTVAL_VALID,
+						EmailSan:                      emailSan,
+						SubjectEmail:                  subjectEmail,
+						NameConstraintsEmailWhitelist: emailWhitelist,
+						NameConstraintsEmailBlacklist: emailBlacklist,
+					})
+				}
+			}
+		}
+	}
+
+	// Without any SANs, rfc822Name constraints must be applied to the subject's emailAddress attribute. The hostname is
+	// then only in the CN.
+	for _, subjectEmail := range []TrinaryValue{EXTVAL_VALID, EXTVAL_INVALID} {
+		for _, emailWhitelist := range ALL_TRINARY_VALUES {
+			for _, emailBlacklist := range ALL_TRINARY_VALUES {
+				testCases = append(testCases, NameConstraintsTestCase{
+					ClientHostnameType:            CLIENT_HOSTNAME_TYPE_DNS,
+					CommonNameType:                CN_TYPE_DNS,
+					CommonNameValue:               EXTVAL_VALID,
+					DnsSan:                        EXTVAL_NONE,
+					SubjectEmail:                  subjectEmail,
+					NameConstraintsEmailWhitelist: emailWhitelist,
+					NameConstraintsEmailBlacklist: emailBlacklist,
+				})
+			}
+		}
+	}
+
+	// URI constraints, which are matched against the host component of URI SANs
+	for _, uriSan := range ALL_TRINARY_VALUES {
+		for _, uriWhitelist := range ALL_TRINARY_VALUES {
+			for _, uriBlacklist := range ALL_TRINARY_VALUES {
+				testCases = append(testCases, NameConstraintsTestCase{
+					ClientHostnameType:          CLIENT_HOSTNAME_TYPE_DNS,
+					DnsSan:                      EXTVAL_VALID,
+					UriSan:                      uriSan,
+					NameConstraintsUriWhitelist: uriWhitelist,
+					NameConstraintsUriBlacklist: uriBlacklist,
+				})
+			}
+		}
+	}
+
+	// directoryName constraints, which are matched against the leaf's subject DN
+	var directoryNameConstraintsFeatureTestCase uint
+	for _, subjectOu := range ALL_TRINARY_VALUES {
+		for _, dnWhitelist := range ALL_TRINARY_VALUES {
+			for _, dnBlacklist := range ALL_TRINARY_VALUES {
+				if subjectOu == EXTVAL_VALID && dnWhitelist == EXTVAL_VALID && dnBlacklist == EXTVAL_NONE {
+					directoryNameConstraintsFeatureTestCase = uint(len(testCases))
+				}
+				testCases = append(testCases, NameConstraintsTestCase{
+					ClientHostnameType:         CLIENT_HOSTNAME_TYPE_DNS,
+					DnsSan:                     EXTVAL_VALID,
+					SubjectOrganizationalUnit:  subjectOu,
+					NameConstraintsDnWhitelist: dnWhitelist,
+					NameConstraintsDnBlacklist: dnBlacklist,
+				})
+			}
+		}
+	}
+
+	// IPv6 clients, which get IPv6 SANs and constraints
+	testCases = appendHostnameMatrix(testCases, CLIENT_HOSTNAME_TYPE_IPV6)
+
+	// Try encoding the client-requested IPv6 address into SANs with other tags, or in other notations
+	validIpv6 := net.ParseIP(VALID_IPV6)
+	for sanTag := 0; sanTag < 16; sanTag++ {
+		for _, ipEncoding := range [][]byte{validIpv6, []byte(VALID_IPV6), []byte("[" + VALID_IPV6 + "]"),
+			[]byte("0:0:0:0:0:0:0:1"), []byte(VALID_IPV6 + "%lo"),
+		} {
+			testCases = append(testCases, NameConstraintsTestCase{
+				ClientHostnameType:         CLIENT_HOSTNAME_TYPE_IPV6,
+				IpSan:                      EXTVAL_INVALID,
+				NameConstraintsIpWhitelist: EXTVAL_INVALID,
+				ExtraSan:                   &ExtraSan{tag: sanTag, value: ipEncoding},
+			})
+			testCases = append(testCases, NameConstraintsTestCase{
+				ClientHostnameType:         CLIENT_HOSTNAME_TYPE_IPV6,
+				IpSan:                      EXTVAL_INVALID,
+				NameConstraintsIpBlacklist: EXTVAL_VALID,
+				ExtraSan:                   &ExtraSan{tag: sanTag, value: ipEncoding},
+			})
+		}
+	}
+
+	// An IPv4-mapped IPv6 SAN is 16 bytes long, so it isn't matched by IPv4 constraints. It must not be usable to get
+	// around them.
+	mappedIp := net.ParseIP(VALID_IP).To16()
+	testCases = append(testCases, NameConstraintsTestCase{
+		ClientHostnameType:         CLIENT_HOSTNAME_TYPE_IP,
+		IpSan:                      EXTVAL_INVALID,
+		NameConstraintsIpWhitelist: EXTVAL_INVALID,
+		ExtraSan:                   &ExtraSan{tag: certutil.NAME_TYPE_IP, value: mappedIp},
+	})
+	testCases = append(testCases, NameConstraintsTestCase{
+		ClientHostnameType:         CLIENT_HOSTNAME_TYPE_IP,
+		IpSan:                      EXTVAL_INVALID,
+		NameConstraintsIpBlacklist: EXTVAL_VALID,
+		ExtraSan:                   &ExtraSan{tag: certutil.NAME_TYPE_IP, value: mappedIp},
+	})
+
+	// IP constraints of the other address family, e.g. IPv4 ranges against IPv6 SANs
+	for _, clientHostnameType := range []ClientHostnameType{CLIENT_HOSTNAME_TYPE_IP, CLIENT_HOSTNAME_TYPE_IPV6} {
+		for _, ipSan := range []TrinaryValue{EXTVAL_VALID, EXTVAL_INVALID} {
+			for _, ipWhitelist := range ALL_TRINARY_VALUES {
+				for _, ipBlacklist := range ALL_TRINARY_VALUES {
+					if ipWhitelist == EXTVAL_NONE && ipBlacklist == EXTVAL_NONE {
+						continue
+					}
+					testCases = append(testCases, NameConstraintsTestCase{
+						ClientHostnameType:         clientHostnameType,
+						IpSan:                      ipSan,
+						NameConstraintsIpWhitelist: ipWhitelist,
+						NameConstraintsIpBlacklist: ipBlacklist,
+						IpConstraintFamilyMismatch: true,
+					})
+				}
+			}
+		}
+	}
+
+	// DNS constraints spread across the trust root, local_root and local_ica
+	// The feature probes are a constraint on the root alone that permits the hostname, and one that denies it
+	var constrainedAnchorFeatureTestCases []uint
+	for _, rootConstraint := range ALL_DNS_SUBTREE_CONSTRAINTS {
+		for _, localRootConstraint := range ALL_DNS_SUBTREE_CONSTRAINTS {
+			for _, icaConstraint := range ALL_DNS_SUBTREE_CONSTRAINTS {
+				if (rootConstraint == DNS_SUBTREE_PERMIT_PARENT || rootConstraint == DNS_SUBTREE_PERMIT_DISJOINT) &&
+					localRootConstraint == DNS_SUBTREE_NONE && icaConstraint == DNS_SUBTREE_NONE {
+					constrainedAnchorFeatureTestCases = append(constrainedAnchorFeatureTestCases, uint(len(testCases)))
+				}
+				testCases = append(testCases, MultiLevelTestCase{
+					RootConstraint:      rootConstraint,
+					LocalRootConstraint: localRootConstraint,
+					IcaConstraint:       icaConstraint,
+				})
+			}
+		}
+	}
+
+	// Malformed and ambiguous constraint encodings
+	for _, encoding := range ALL_CONSTRAINT_ENCODINGS {
+		testCases = append(testCases, ConstraintEncodingTestCase{Encoding: encoding})
+		if encoding != CONSTRAINT_ENCODING_EMPTY_EXTENSION {
+			testCases = append(testCases, ConstraintEncodingTestCase{Encoding: encoding, Excluded: true})
+		}
+	}
+
+	// Non-critical name constraints. The first test case is the feature probe.
+	nonCriticalFeatureTestCase := uint(len(testCases))
+	testCases = append(testCases, NameConstraintsTestCase{
+		ClientHostnameType:          CLIENT_HOSTNAME_TYPE_DNS,
+		DnsSan:                      EXTVAL_VALID,
+		NameConstraintsDnsWhitelist: EXTVAL_INVALID,
+		NameConstraintsNonCritical:  true,
+	})
+	for _, clientHostnameType := range []ClientHostnameType{CLIENT_HOSTNAME_TYPE_DNS, CLIENT_HOSTNAME_TYPE_IP, CLIENT_HOSTNAME_TYPE_IPV6} {
+		for _, dnsSan := range ALL_TRINARY_VALUES {
+			for _, ipSan := range ALL_TRINARY_VALUES {
+				for _, dnsWhitelist := range ALL_TRINARY_VALUES {
+					for _, ipWhitelist := range ALL_TRINARY_VALUES {
+						for _, dnsBlacklist := range ALL_TRINARY_VALUES {
+							for _, ipBlacklist := range ALL_TRINARY_VALUES {
+								if dnsWhitelist == EXTVAL_NONE && ipWhitelist == EXTVAL_NONE && dnsBlacklist == EXTVAL_NONE && ipBlacklist == EXTVAL_NONE {
+									continue
+								}
+								testCases = append(testCases, NameConstraintsTestCase{
+									ClientHostnameType:          clientHostnameType,
+									DnsSan:                      dnsSan,
+									IpSan:                       ipSan,
+									NameConstraintsIpWhitelist:  ipWhitelist,
+									NameConstraintsDnsWhitelist: dnsWhitelist,
+									NameConstraintsIpBlacklist:  ipBlacklist,
+									NameConstraintsDnsBlacklist: dnsBlacklist,
+									NameConstraintsNonCritical:  true,
+								})
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
 	// Adding more test cases? Be a pal and remember to update the testCases slice's capacity at the top.
 
 	return &TestCaseProvider{
-		testCases: testCases,
+		testCases:                               testCases,
+		directoryNameConstraintsFeatureTestCase: directoryNameConstraintsFeatureTestCase,
+		constrainedAnchorFeatureTestCases:       constrainedAnchorFeatureTestCases,
+		nonCriticalFeatureTestCase:              nonCriticalFeatureTestCase,
 	}
 }
 
+// appendHostnameMatrix appends every combination of CN, SAN and DNS/IP name constraint values for the given client
+// hostname type.
+func appendHostnameMatrix(testCases []test_case.TestCase, clientHostnameType ClientHostnameType) []test_case.TestCase {
+	for _, commonNameType := range []CommonNameType{CN_TYPE_DNS, CN_TYPE_IP} {
+		for _, commonNameValue := range ALL_TRINARY_VALUES {
+			for _, dnsSan := range ALL_TRINARY_VALUES {
+				for _, ipSan := range ALL_TRINARY_VALUES {
+					for _, dnsWhitelist := range ALL_TRINARY_VALUES {
+						for _, ipWhitelist := range ALL_TRINARY_VALUES {
+							for _, dnsBlacklist := range ALL_TRINARY_VALUES {
+								for _, ipBlacklist := range ALL_TRINARY_VALUES {
+									tc := NameConstraintsTestCase{
+										ClientHostnameType:          clientHostnameType,
+										CommonNameType:              commonNameType,
+										CommonNameValue:             commonNameValue,
+										DnsSan:                      dnsSan,
+										IpSan:                       ipSan,
+										NameConstraintsIpWhitelist:  ipWhitelist,
+										NameConstraintsDnsWhitelist: dnsWhitelist,
+										NameConstraintsIpBlacklist:  ipBlacklist,
+										NameConstraintsDnsBlacklist: dnsBlacklist,
+									}
+									testCases = append(testCases, tc)
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return testCases
+}
+
 func (p *TestCaseProvider) Name() string {
 	return "nameconstraints"
 }
@@ -225,10 +432,14 @@ const (
 	FEATURE_NAME_CONSTRAINTS test_case.Feature = iota + 1
 	FEATURE_VALIDATE_DNS
 	FEATURE_VALIDATE_IP
+	FEATURE_DIRECTORY_NAME_CONSTRAINTS
+	FEATURE_CONSTRAINED_ANCHOR
+	FEATURE_NON_CRITICAL_NAME_CONSTRAINTS
 )
 
 func (p *TestCaseProvider) GetFeatures() []test_case.Feature {
-	return []test_case.Feature{FEATURE_NAME_CONSTRAINTS, FEATURE_VALIDATE_DNS, FEATURE_VALIDATE_IP}
+	return []test_case.Feature{FEATURE_NAME_CONSTRAINTS, FEATURE_VALIDATE_DNS, FEATURE_VALIDATE_IP, FEATURE_DIRECTORY_NAME_CONSTRAINTS, FEATURE_CONSTRAINED_ANCHOR,
+		FEATURE_NON_CRITICAL_NAME_CONSTRAINTS}
 }
 
 func (p *TestCaseProvider) DescribeFeature(feature test_case.Feature) string {
@@ -239,6 +450,12 @@ func (p *TestCaseProvider) DescribeFeature(feature test_case.Feature) string {
 		return "VALIDATE_DNS"
 	case FEATURE_VALIDATE_IP:
 		return "VALIDATE_IP"
+	case FEATURE_DIRECTORY_NAME_CONSTRAINTS:
+		return "DIRECTORY_NAME_CONSTRAINTS"
+	case FEATURE_CONSTRAINED_ANCHOR:
+		return "CONSTRAINED_ANCHOR"
+	case FEATURE_NON_CRITICAL_NAME_CONSTRAINTS:
+		return "NON_CRITICAL_NAME_CONSTRAINTS"
 	}
 	panic(fmt.Errorf("unsupported feature: %d", feature))
 }
@@ -253,6 +470,15 @@ func (p *TestCaseProvider) GetTestCasesForFeature(feature test_case.Feature) ([]
 	if feature == FEATURE_VALIDATE_IP {
 		return []uint{FEATURE_VALIDATE_IP_TEST_CASE_1, FEATURE_VALIDATE_IP_TEST_CASE_2}, nil
 	}
+	if feature == FEATURE_DIRECTORY_NAME_CONSTRAINTS {
+		return []uint{p.directoryNameConstraintsFeatureTestCase}, nil
+	}
+	if feature == FEATURE_CONSTRAINED_ANCHOR {
+		return p.constrainedAnchorFeatureTestCases, nil
+	}
+	if feature == FEATURE_NON_CRITICAL_NAME_CONSTRAINTS {
+		return []uint{p.nonCriticalFeatureTestCase}, nil
+	}
 
 	return nil, fmt.Errorf("invalid feature: %v", feature)
 }
@@ -8,6 +8,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/json"
 	"fmt"
 	"github.com/Netflix/bettertls/test-suites/certutil"
@@ -25,6 +26,21 @@ const VALID_DNS_TREE = "localhost"
 const INVALID_DNS_TREE = "example.com"
 const VALID_IP_RANGE = "127.0.0.0/24"
 const INVALID_IP_RANGE = "1.1.1.0/24"
+const VALID_IPV6 = "::1"
+const INVALID_IPV6 = "2001:db8::1"
+const VALID_IPV6_RANGE = "::/120"
+const INVALID_IPV6_RANGE = "2001:db8::/64"
+const VALID_EMAIL = "test@test.localhost"
+const INVALID_EMAIL = "test@bad.example.com"
+const VALID_EMAIL_TREE = ".localhost"
+const INVALID_EMAIL_TREE = ".example.com"
+const VALID_URI = "spiffe://test.localhost/ns/x"
+const INVALID_URI = "spiffe://bad.example.com/ns/x"
+const VALID_URI_TREE = ".localhost"
+const INVALID_URI_TREE = ".example.com"
+const INVALID_URI_HOST = "bad.example.com"
+const VALID_OU = "valid"
+const INVALID_OU = "invalid"
 
 type TrinaryValue byte
 
@@ -76,6 +92,7 @@ type ClientHostnameType byte
 const (
 	CLIENT_HOSTNAME_TYPE_DNS ClientHostnameType = iota
 	CLIENT_HOSTNAME_TYPE_IP
+	CLIENT_HOSTNAME_TYPE_IPV6
 )
 
 func (cht ClientHostnameType) String() string {
@@ -84,6 +101,8 @@ func (cht ClientHostnameType) String() string {
 		return "DNS"
 	case CLIENT_HOSTNAME_TYPE_IP:
 		return "IP"
+	case CLIENT_HOSTNAME_TYPE_IPV6:
+		return "IPV6"
 	}
 	panic(fmt.Errorf("unhandled ClientHostnameType: %d", cht))
 }
@@ -102,13 +121,98 @@ type NameConstraintsTestCase struct {
 	NameConstraintsIpBlacklist  TrinaryValue
 	NameConstraintsDnsBlacklist TrinaryValue
 	ExtraSan                    *ExtraSan
+
+	// If set, the IP name constraints use ranges of the other address family than the IP SANs and CN (e.g. IPv4 ranges
+	// for an IPv6 client). Such ranges can never contain the certificate's addresses.
+	IpConstraintFamilyMismatch bool `json:",omitempty"`
+
+	// Names and constraints of other forms. These are never the subject of hostname verification, so they only
+	// matter for the soft NameConstraints violation checks in ExpectedResult.
+	EmailSan                      TrinaryValue `json:",omitempty"`
+	SubjectEmail                  TrinaryValue `json:",omitempty"`
+	UriSan                        TrinaryValue `json:",omitempty"`
+	SubjectOrganizationalUnit     TrinaryValue `json:",omitempty"`
+	NameConstraintsEmailWhitelist TrinaryValue `json:",omitempty"`
+	NameConstraintsEmailBlacklist TrinaryValue `json:",omitempty"`
+	NameConstraintsUriWhitelist   TrinaryValue `json:",omitempty"`
+	NameConstraintsUriBlacklist   TrinaryValue `json:",omitempty"`
+	NameConstraintsDnWhitelist    TrinaryValue `json:",omitempty"`
+	NameConstraintsDnBlacklist    TrinaryValue `json:",omitempty"`
+
+	// If set, the name constraints extension is marked non-critical. RFC 5280 requires CAs to mark it critical.
+	NameConstraintsNonCritical bool `json:",omitempty"`
+}
+
+// violatesConstraints reports whether a name of the given value is denied by the given whitelist and blacklist values
+// of its name form. A name that's absent can't violate anything.
+func violatesConstraints(name TrinaryValue, whitelist TrinaryValue, blacklist TrinaryValue) bool {
+	if name == EXTVAL_VALID {
+		return whitelist == EXTVAL_INVALID || blacklist == EXTVAL_VALID
+	}
+	if name == EXTVAL_INVALID {
+		return whitelist == EXTVAL_VALID || blacklist == EXTVAL_INVALID
+	}
+	return false
+}
+
+// ipViolates reports whether an IP address of the given value is denied by the IP name constraints.
+func (n NameConstraintsTestCase) ipViolates(ip TrinaryValue) bool {
+	if n.IpConstraintFamilyMismatch {
+		// An address is never within a range of the other family, so any whitelist denies it and no blacklist does
+		return ip != EXTVAL_NONE && n.NameConstraintsIpWhitelist != EXTVAL_NONE
+	}
+	return violatesConstraints(ip, n.NameConstraintsIpWhitelist, n.NameConstraintsIpBlacklist)
+}
+
+func (n NameConstraintsTestCase) isIpClient() bool {
+	return n.ClientHostnameType == CLIENT_HOSTNAME_TYPE_IP || n.ClientHostnameType == CLIENT_HOSTNAME_TYPE_IPV6
 }
 
+// The IP addresses in the certificate are of the same family as the client's address. DNS clients get IPv4 addresses.
+func (n NameConstraintsTestCase) validIp() string {
+	if n.ClientHostnameType == CLIENT_HOSTNAME_TYPE_IPV6 {
+		return VALID_IPV6
+	}
+	return VALID_IP
+}
+
+func (n NameConstraintsTestCase) invalidIp() string {
+	if n.ClientHostnameType == CLIENT_HOSTNAME_TYPE_IPV6 {
+		return INVALID_IPV6
+	}
+	return INVALID_IP
+}
+
+func (n NameConstraintsTestCase) ipRanges() (valid string, invalid string) {
+	if (n.ClientHostnameType == CLIENT_HOSTNAME_TYPE_IPV6) != n.IpConstraintFamilyMismatch {
+		return VALID_IPV6_RANGE, INVALID_IPV6_RANGE
+	}
+	return VALID_IP_RANGE, INVALID_IP_RANGE
+}
+
+func rawIp(ip string) net.IP {
+	rawIp := net.ParseIP(ip)
+	if ip := rawIp.To4(); ip != nil {
+		rawIp = ip
+	}
+	return rawIp
+}
+
+func (n NameConstraintsTestCase) hasSan() bool {
+	return n.DnsSan != EXTVAL_NONE || n.IpSan != EXTVAL_NONE || n.EmailSan != EXTVAL_NONE || n.UriSan != EXTVAL_NONE || n.ExtraSan != nil
+}
+
+var oidEmailAddress = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+
 type ExtraSan struct {
 	tag   int
 	value []byte
 }
 
+func (es *ExtraSan) generalName() certutil.GeneralName {
+	return certutil.GeneralName{Type: es.tag, Value: es.value}
+}
+
 func (es *ExtraSan) MarshalJSON() ([]byte, error) {
 	return json.Marshal(map[string]interface{}{
 		"tag":   es.tag,
@@ -116,7 +220,24 @@ func (es *ExtraSan) MarshalJSON() ([]byte, error) {
 	})
 }
 
+func (n NameConstraintsTestCase) hasNameConstraints() bool {
+	return n.NameConstraintsIpWhitelist != EXTVAL_NONE || n.NameConstraintsDnsWhitelist != EXTVAL_NONE ||
+		n.NameConstraintsIpBlacklist != EXTVAL_NONE || n.NameConstraintsDnsBlacklist != EXTVAL_NONE ||
+		n.NameConstraintsEmailWhitelist != EXTVAL_NONE || n.NameConstraintsEmailBlacklist != EXTVAL_NONE ||
+		n.NameConstraintsUriWhitelist != EXTVAL_NONE || n.NameConstraintsUriBlacklist != EXTVAL_NONE ||
+		n.NameConstraintsDnWhitelist != EXTVAL_NONE || n.NameConstraintsDnBlacklist != EXTVAL_NONE
+}
+
 func (n NameConstraintsTestCase) ExpectedResult() test_case.ExpectedResult {
+	result := n.expectedResultIgnoringCriticality()
+	// Clients may reject a CA that marks its name constraints non-critical, since RFC 5280 forbids CAs from doing so
+	if n.NameConstraintsNonCritical && n.hasNameConstraints() && result == test_case.EXPECTED_RESULT_PASS {
+		return test_case.EXPECTED_RESULT_SOFT_PASS
+	}
+	return result
+}
+
+func (n NameConstraintsTestCase) expectedResultIgnoringCriticality() test_case.ExpectedResult {
 	isSoftFail := false
 	isSoftPass := false
 
@@ -129,7 +250,7 @@ func (n NameConstraintsTestCase) ExpectedResult() test_case.ExpectedResult {
 			// CN matches the client hostname, but CN's shouldn't be used for hostname verification anymore, so mark as soft fail
 			isSoftFail = true
 		}
-	} else if n.ClientHostnameType == CLIENT_HOSTNAME_TYPE_IP {
+	} else if n.isIpClient() {
 		if n.IpSan != EXTVAL_VALID {
 			if n.CommonNameType != CN_TYPE_IP || n.CommonNameValue != EXTVAL_VALID {
 				return test_case.EXPECTED_RESULT_FAIL
@@ -144,8 +265,8 @@ func (n NameConstraintsTestCase) ExpectedResult() test_case.ExpectedResult {
 		if n.NameConstraintsDnsWhitelist == EXTVAL_INVALID || n.NameConstraintsDnsBlacklist == EXTVAL_VALID {
 			return test_case.EXPECTED_RESULT_FAIL
 		}
-	} else if n.ClientHostnameType == CLIENT_HOSTNAME_TYPE_IP {
-		if n.NameConstraintsIpWhitelist == EXTVAL_INVALID || n.NameConstraintsIpBlacklist == EXTVAL_VALID {
+	} else if n.isIpClient() {
+		if n.ipViolates(EXTVAL_VALID) {
 			return test_case.EXPECTED_RESULT_FAIL
 		}
 	}
@@ -161,12 +282,20 @@ func (n NameConstraintsTestCase) ExpectedResult() test_case.ExpectedResult {
 	if n.DnsSan == EXTVAL_INVALID && (n.NameConstraintsDnsWhitelist == EXTVAL_VALID || n.NameConstraintsDnsBlacklist == EXTVAL_INVALID) {
 		hasSanViolation = true
 	}
-	// If the cert has a valid IP and NC extensions deny it
-	if n.IpSan == EXTVAL_VALID && (n.NameConstraintsIpWhitelist == EXTVAL_INVALID || n.NameConstraintsIpBlacklist == EXTVAL_VALID) {
+	// If the cert has an IP and NC extensions deny it
+	if n.ipViolates(n.IpSan) {
+		hasSanViolation = true
+	}
+	if violatesConstraints(n.EmailSan, n.NameConstraintsEmailWhitelist, n.NameConstraintsEmailBlacklist) ||
+		violatesConstraints(n.UriSan, n.NameConstraintsUriWhitelist, n.NameConstraintsUriBlacklist) {
+		hasSanViolation = true
+	}
+	// directoryName constraints apply to the leaf's subject DN. The DN subtrees pin the OU, so a subject without an OU
+	// is outside any whitelisted subtree.
+	if n.NameConstraintsDnWhitelist != EXTVAL_NONE && n.SubjectOrganizationalUnit != n.NameConstraintsDnWhitelist {
 		hasSanViolation = true
 	}
-	// If the cert has an invalid IP and NC extensions deny it
-	if n.IpSan == EXTVAL_INVALID && (n.NameConstraintsIpWhitelist == EXTVAL_VALID || n.NameConstraintsIpBlacklist == EXTVAL_INVALID) {
+	if n.NameConstraintsDnBlacklist != EXTVAL_NONE && n.SubjectOrganizationalUnit == n.NameConstraintsDnBlacklist {
 		hasSanViolation = true
 	}
 
@@ -177,10 +306,16 @@ func (n NameConstraintsTestCase) ExpectedResult() test_case.ExpectedResult {
 	if (n.CommonNameType == CN_TYPE_DNS && n.CommonNameValue == EXTVAL_INVALID) && (n.NameConstraintsDnsWhitelist == EXTVAL_VALID || n.NameConstraintsDnsBlacklist == EXTVAL_INVALID) {
 		hasCnViolation = true
 	}
-	if (n.CommonNameType == CN_TYPE_IP && n.CommonNameValue == EXTVAL_VALID) && (n.NameConstraintsIpWhitelist == EXTVAL_INVALID || n.NameConstraintsIpBlacklist == EXTVAL_VALID) {
+	if n.CommonNameType == CN_TYPE_IP && n.ipViolates(n.CommonNameValue) {
 		hasCnViolation = true
 	}
-	if (n.CommonNameType == CN_TYPE_IP && n.CommonNameValue == EXTVAL_INVALID) && (n.NameConstraintsIpWhitelist == EXTVAL_VALID || n.NameConstraintsIpBlacklist == EXTVAL_INVALID) {
+	// RFC 5280 requires rfc822Name constraints to be applied to the subject emailAddress attribute when there is no SAN
+	// extension, so a violation then fails even a client that accepts the hostname in the CN. Otherwise, treat it like
+	// a CN violation.
+	if violatesConstraints(n.SubjectEmail, n.NameConstraintsEmailWhitelist, n.NameConstraintsEmailBlacklist) {
+		if !n.hasSan() {
+			return test_case.EXPECTED_RESULT_FAIL
+		}
 		hasCnViolation = true
 	}
 
@@ -209,6 +344,8 @@ func (n NameConstraintsTestCase) GetHostname() string {
 		return VALID_DNS_NAME
 	} else if n.ClientHostnameType == CLIENT_HOSTNAME_TYPE_IP {
 		return VALID_IP
+	} else if n.ClientHostnameType == CLIENT_HOSTNAME_TYPE_IPV6 {
+		return VALID_IPV6
 	} else {
 		panic(fmt.Errorf("unhandled client hostname type: %v", n.ClientHostnameType))
 	}
@@ -216,16 +353,23 @@ func (n NameConstraintsTestCase) GetHostname() string {
 
 func (n NameConstraintsTestCase) RequiredFeatures() []test_case.Feature {
 	var requiredFeatures []test_case.Feature
-	if n.NameConstraintsIpWhitelist != EXTVAL_NONE || n.NameConstraintsDnsWhitelist != EXTVAL_NONE ||
-		n.NameConstraintsIpBlacklist != EXTVAL_NONE || n.NameConstraintsDnsBlacklist != EXTVAL_NONE {
+	if n.hasNameConstraints() {
 		requiredFeatures = append(requiredFeatures, FEATURE_NAME_CONSTRAINTS)
 	}
+	// RFC 5280 lets clients ignore non-critical extensions they don't recognize, so only expect non-critical name
+	// constraints to cause a failure for clients that enforce them
+	if n.NameConstraintsNonCritical && n.hasNameConstraints() && n.ExpectedResult() == test_case.EXPECTED_RESULT_FAIL {
+		requiredFeatures = append(requiredFeatures, FEATURE_NON_CRITICAL_NAME_CONSTRAINTS)
+	}
+	if n.NameConstraintsDnWhitelist != EXTVAL_NONE || n.NameConstraintsDnBlacklist != EXTVAL_NONE {
+		requiredFeatures = append(requiredFeatures, FEATURE_DIRECTORY_NAME_CONSTRAINTS)
+	}
 
 	// If the test doesn't have a NC violation but has a client hostname / SAN mismatch, then validation is a required feature to get the expected result
 	if n.ClientHostnameType == CLIENT_HOSTNAME_TYPE_DNS && n.DnsSan != EXTVAL_VALID {
 		requiredFeatures = append(requiredFeatures, FEATURE_VALIDATE_DNS)
 	}
-	if n.ClientHostnameType == CLIENT_HOSTNAME_TYPE_IP && n.IpSan != EXTVAL_VALID {
+	if n.isIpClient() && n.IpSan != EXTVAL_VALID {
 		requiredFeatures = append(requiredFeatures, FEATURE_VALIDATE_IP)
 	}
 
@@ -258,11 +402,12 @@ func (n NameConstraintsTestCase) GetCertificates(rootCert *x509.Certificate, roo
 		return nil, err
 	}
 
-	_, validIpRange, err := net.ParseCIDR(VALID_IP_RANGE)
+	validIpRangeString, invalidIpRangeString := n.ipRanges()
+	_, validIpRange, err := net.ParseCIDR(validIpRangeString)
 	if err != nil {
 		return nil, err
 	}
-	_, invalidIpRange, err := net.ParseCIDR(INVALID_IP_RANGE)
+	_, invalidIpRange, err := net.ParseCIDR(invalidIpRangeString)
 	if err != nil {
 		return nil, err
 	}
@@ -281,7 +426,7 @@ func (n NameConstraintsTestCase) GetCertificates(rootCert *x509.Certificate, roo
 		IsCA:                  true,
 	}
 	if n.NameConstraintsDnsWhitelist != EXTVAL_NONE {
-		icaTemplate.PermittedDNSDomainsCritical = true
+		icaTemplate.PermittedDNSDomainsCritical = !n.NameConstraintsNonCritical
 		if n.NameConstraintsDnsWhitelist == EXTVAL_VALID {
 			icaTemplate.PermittedDNSDomains = []string{VALID_DNS_TREE}
 		} else if n.NameConstraintsDnsWhitelist == EXTVAL_INVALID {
@@ -289,7 +434,7 @@ func (n NameConstraintsTestCase) GetCertificates(rootCert *x509.Certificate, roo
 		}
 	}
 	if n.NameConstraintsDnsBlacklist != EXTVAL_NONE {
-		icaTemplate.PermittedDNSDomainsCritical = true
+		icaTemplate.PermittedDNSDomainsCritical = !n.NameConstraintsNonCritical
 		if n.NameConstraintsDnsBlacklist == EXTVAL_VALID {
 			icaTemplate.ExcludedDNSDomains = []string{VALID_DNS_TREE}
 		} else if n.NameConstraintsDnsBlacklist == EXTVAL_INVALID {
@@ -297,7 +442,7 @@ func (n NameConstraintsTestCase) GetCertificates(rootCert *x509.Certificate, roo
 		}
 	}
 	if n.NameConstraintsIpWhitelist != EXTVAL_NONE {
-		icaTemplate.PermittedDNSDomainsCritical = true
+		icaTemplate.PermittedDNSDomainsCritical = !n.NameConstraintsNonCritical
 		if n.NameConstraintsIpWhitelist == EXTVAL_VALID {
 			icaTemplate.PermittedIPRanges = []*net.IPNet{validIpRange}
 		} else if n.NameConstraintsIpWhitelist == EXTVAL_INVALID {
@@ -305,13 +450,68 @@ func (n NameConstraintsTestCase) GetCertificates(rootCert *x509.Certificate, roo
 		}
 	}
 	if n.NameConstraintsIpBlacklist != EXTVAL_NONE {
-		icaTemplate.PermittedDNSDomainsCritical = true
+		icaTemplate.PermittedDNSDomainsCritical = !n.NameConstraintsNonCritical
 		if n.NameConstraintsIpBlacklist == EXTVAL_VALID {
 			icaTemplate.ExcludedIPRanges = []*net.IPNet{validIpRange}
 		} else if n.NameConstraintsIpBlacklist == EXTVAL_INVALID {
 			icaTemplate.ExcludedIPRanges = []*net.IPNet{invalidIpRange}
 		}
 	}
+	if n.NameConstraintsEmailWhitelist != EXTVAL_NONE {
+		icaTemplate.PermittedDNSDomainsCritical = !n.NameConstraintsNonCritical
+		if n.NameConstraintsEmailWhitelist == EXTVAL_VALID {
+			icaTemplate.PermittedEmailAddresses = []string{VALID_EMAIL_TREE}
+		} else if n.NameConstraintsEmailWhitelist == EXTVAL_INVALID {
+			icaTemplate.PermittedEmailAddresses = []string{INVALID_EMAIL_TREE}
+		}
+	}
+	if n.NameConstraintsEmailBlacklist != EXTVAL_NONE {
+		icaTemplate.PermittedDNSDomainsCritical = !n.NameConstraintsNonCritical
+		if n.NameConstraintsEmailBlacklist == EXTVAL_VALID {
+			icaTemplate.ExcludedEmailAddresses = []string{VALID_EMAIL_TREE}
+		} else if n.NameConstraintsEmailBlacklist == EXTVAL_INVALID {
+			icaTemplate.ExcludedEmailAddresses = []string{INVALID_EMAIL}
+		}
+	}
+	if n.NameConstraintsUriWhitelist != EXTVAL_NONE {
+		icaTemplate.PermittedDNSDomainsCritical = !n.NameConstraintsNonCritical
+		if n.NameConstraintsUriWhitelist == EXTVAL_VALID {
+			icaTemplate.PermittedURIDomains = []string{VALID_URI_TREE}
+		} else if n.NameConstraintsUriWhitelist == EXTVAL_INVALID {
+			icaTemplate.PermittedURIDomains = []string{INVALID_URI_TREE}
+		}
+	}
+	if n.NameConstraintsUriBlacklist != EXTVAL_NONE {
+		icaTemplate.PermittedDNSDomainsCritical = !n.NameConstraintsNonCritical
+		if n.NameConstraintsUriBlacklist == EXTVAL_VALID {
+			icaTemplate.ExcludedURIDomains = []string{VALID_URI_TREE}
+		} else if n.NameConstraintsUriBlacklist == EXTVAL_INVALID {
+			icaTemplate.ExcludedURIDomains = []string{INVALID_URI_HOST}
+		}
+	}
+	if n.NameConstraintsDnWhitelist != EXTVAL_NONE || n.NameConstraintsDnBlacklist != EXTVAL_NONE {
+		// x509.CreateCertificate can't encode directoryName constraints, so the whole extension is built by hand
+		icaTemplate.PermittedDNSDomainsCritical = !n.NameConstraintsNonCritical
+		var permittedNames, excludedNames []certutil.GeneralName
+		if n.NameConstraintsDnWhitelist != EXTVAL_NONE {
+			subtree, err := organizationalUnitSubtree(n.NameConstraintsDnWhitelist)
+			if err != nil {
+				return nil, err
+			}
+			permittedNames = append(permittedNames, subtree)
+		}
+		if n.NameConstraintsDnBlacklist != EXTVAL_NONE {
+			subtree, err := organizationalUnitSubtree(n.NameConstraintsDnBlacklist)
+			if err != nil {
+				return nil, err
+			}
+			excludedNames = append(excludedNames, subtree)
+		}
+		err = certutil.MoveNameConstraintsToExtension(icaTemplate, permittedNames, excludedNames)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	localIcaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
@@ -331,22 +531,28 @@ func (n NameConstraintsTestCase) GetCertificates(rootCert *x509.Certificate, roo
 		if n.CommonNameType == CN_TYPE_DNS {
 			commonName = VALID_DNS_NAME
 		} else if n.CommonNameType == CN_TYPE_IP {
-			commonName = VALID_IP
+			commonName = n.validIp()
 		}
 	} else if n.CommonNameValue == EXTVAL_INVALID {
 		if n.CommonNameType == CN_TYPE_DNS {
 			commonName = INVALID_DNS_NAME
 		} else if n.CommonNameType == CN_TYPE_IP {
-			commonName = INVALID_IP
+			commonName = n.invalidIp()
 		}
 	}
 
+	var organizationalUnit []string
+	if n.SubjectOrganizationalUnit != EXTVAL_NONE {
+		organizationalUnit = []string{organizationalUnitValue(n.SubjectOrganizationalUnit)}
+	}
+
 	leafTemplate := &x509.Certificate{
 		SerialNumber: certutil.RandomSerial(),
 		Subject: pkix.Name{
-			CommonName:   commonName,
-			Organization: []string{certutil.SUBJECT_ORGANIZATION},
-			SerialNumber: certutil.RandomString(),
+			CommonName:         commonName,
+			Organization:       []string{certutil.SUBJECT_ORGANIZATION},
+			OrganizationalUnit: organizationalUnit,
+			SerialNumber:       certutil.RandomString(),
 		},
 		NotBefore:             certutil.GetNotBefore(),
 		NotAfter:              certutil.GetNotAfter(false),
@@ -355,38 +561,53 @@ func (n NameConstraintsTestCase) GetCertificates(rootCert *x509.Certificate, roo
 		BasicConstraintsValid: true,
 		IsCA:                  false,
 	}
-	var sans []*ExtraSan
+	var sans []certutil.GeneralName
 	if n.DnsSan == EXTVAL_VALID {
-		sans = append(sans, &ExtraSan{tag: nameTypeDNS, value: []byte(VALID_DNS_NAME)})
+		sans = append(sans, certutil.GeneralName{Type: certutil.NAME_TYPE_DNS, Value: []byte(VALID_DNS_NAME)})
 	}
 	if n.DnsSan == EXTVAL_INVALID {
-		sans = append(sans, &ExtraSan{tag: nameTypeDNS, value: []byte(INVALID_DNS_NAME)})
+		sans = append(sans, certutil.GeneralName{Type: certutil.NAME_TYPE_DNS, Value: []byte(INVALID_DNS_NAME)})
 	}
 	if n.IpSan == EXTVAL_VALID {
-		rawIp := net.ParseIP(VALID_IP)
-		if ip := rawIp.To4(); ip != nil {
-			rawIp = ip
-		}
-		sans = append(sans, &ExtraSan{tag: nameTypeIP, value: rawIp})
+		sans = append(sans, certutil.GeneralName{Type: certutil.NAME_TYPE_IP, Value: rawIp(n.validIp())})
 	}
 	if n.IpSan == EXTVAL_INVALID {
-		rawIp := net.ParseIP(INVALID_IP)
-		if ip := rawIp.To4(); ip != nil {
-			rawIp = ip
-		}
-		sans = append(sans, &ExtraSan{tag: nameTypeIP, value: rawIp})
+		sans = append(sans, certutil.GeneralName{Type: certutil.NAME_TYPE_IP, Value: rawIp(n.invalidIp())})
+	}
+	if n.EmailSan == EXTVAL_VALID {
+		sans = append(sans, certutil.GeneralName{Type: certutil.NAME_TYPE_EMAIL, Value: []byte(VALID_EMAIL)})
+	}
+	if n.EmailSan == EXTVAL_INVALID {
+		sans = append(sans, certutil.GeneralName{Type: certutil.NAME_TYPE_EMAIL, Value: []byte(INVALID_EMAIL)})
+	}
+	if n.UriSan == EXTVAL_VALID {
+		sans = append(sans, certutil.UriName(VALID_URI))
+	}
+	if n.UriSan == EXTVAL_INVALID {
+		sans = append(sans, certutil.UriName(INVALID_URI))
 	}
 	if n.ExtraSan != nil {
-		sans = append(sans, n.ExtraSan)
+		sans = append(sans, n.ExtraSan.generalName())
 	}
 	if len(sans) > 0 {
-		sanExt, err := buildSanExtension(false, sans)
+		sanExt, err := certutil.BuildSanExtension(false, sans)
 		if err != nil {
 			return nil, err
 		}
 		leafTemplate.ExtraExtensions = append(leafTemplate.ExtraExtensions, sanExt)
 	}
 
+	if n.SubjectEmail != EXTVAL_NONE {
+		email := VALID_EMAIL
+		if n.SubjectEmail == EXTVAL_INVALID {
+			email = INVALID_EMAIL
+		}
+		leafTemplate.Subject.ExtraNames = append(leafTemplate.Subject.ExtraNames, pkix.AttributeTypeAndValue{
+			Type:  oidEmailAddress,
+			Value: asn1.RawValue{Tag: asn1.TagIA5String, Bytes: []byte(email)},
+		})
+	}
+
 	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
 		return nil, err
@@ -402,3 +623,18 @@ func (n NameConstraintsTestCase) GetCertificates(rootCert *x509.Certificate, roo
 	}, nil
 
 }
+
+func organizationalUnitValue(tv TrinaryValue) string {
+	if tv == EXTVAL_VALID {
+		return VALID_OU
+	}
+	return INVALID_OU
+}
+
+// organizationalUnitSubtree returns the directoryName subtree holding every leaf subject with the OU for the given value.
+func organizationalUnitSubtree(tv TrinaryValue) (certutil.GeneralName, error) {
+	return certutil.DirectoryName(pkix.Name{
+		Organization:       []string{certutil.SUBJECT_ORGANIZATION},
+		OrganizationalUnit: []string{organizationalUnitValue(tv)},
+	})
+}
@@ -46,6 +46,30 @@ type ExplicitTestCase struct {
 	// An optional comment, explaining what the test is and/or why a client be able to succeed/fail at building the
 	// trust path.
 	Comment string
+	// Additional nodes (besides SrcNode) whose self-signed certificates the client will also trust
+	ExtraTrustedNodes []string `json:",omitempty"`
+	// Nodes for which the client will also trust an unrelated root with the same subject, but a different key
+	DistractorRoots []string `json:",omitempty"`
+	// Edges whose certificates the server leaves out of its chain, and which the client is instead given ahead of
+	// time as untrusted intermediates (like the intermediates preloaded by browsers)
+	OutOfBandEdges []Edge `json:",omitempty"`
+}
+
+// TrustedNodes returns every node the client will trust in this test case.
+func (etc *ExplicitTestCase) TrustedNodes() []string {
+	return append([]string{etc.SrcNode}, etc.ExtraTrustedNodes...)
+}
+
+// FindTrustedPath returns a path of valid edges from any trusted node to the destination node, or nil if there is
+// none.
+func (etc *ExplicitTestCase) FindTrustedPath() []string {
+	for _, node := range etc.TrustedNodes() {
+		path := etc.TrustGraph.Reachable(etc.InvalidEdges, node, etc.DstNode)
+		if len(path) > 0 {
+			return path
+		}
+	}
+	return nil
 }
 
 var EXPLICIT_TEST_CASES = []*ExplicitTestCase{
@@ -168,3 +192,118 @@ var EXPLICIT_TEST_CASES = []*ExplicitTestCase{
 		Comment:       "Certificate from infrastructure Z to bridge CA is invalid.",
 	},
 }
+
+// Test cases where the client trusts more than one root. The first of these is used to check whether the client
+// supports trust stores holding multiple roots at all.
+var MULTIPLE_TRUST_ANCHOR_TEST_CASES = []*ExplicitTestCase{
+	{
+		TrustGraph:        LINEAR_TRUST_GRAPH,
+		SrcNode:           "Unrelated Root",
+		DstNode:           "EE",
+		ExtraTrustedNodes: []string{"Trust Anchor"},
+		Comment:           "The trust anchor is not the first root in the client's trust store.",
+	},
+	{
+		TrustGraph:      LINEAR_TRUST_GRAPH,
+		SrcNode:         "Trust Anchor",
+		DstNode:         "EE",
+		DistractorRoots: []string{"Trust Anchor"},
+		Comment:         "Another trusted root shares the trust anchor's subject, but not its key.",
+	},
+	{
+		TrustGraph:      LINEAR_TRUST_GRAPH,
+		SrcNode:         "Unrelated Root",
+		DstNode:         "EE",
+		DistractorRoots: []string{"Trust Anchor"},
+		ExpectFailure:   true,
+		Comment:         "The only trusted root with the trust anchor's subject has a different key.",
+	},
+	{
+		TrustGraph:      LINEAR_TRUST_GRAPH,
+		SrcNode:         "Trust Anchor",
+		DstNode:         "EE",
+		DistractorRoots: []string{"ICA"},
+		Comment:         "A trusted root shares the ICA's subject, but the leaf can only be verified with the ICA's key.",
+	},
+	{
+		TrustGraph:        LINEAR_TRUST_GRAPH,
+		SrcNode:           "Trust Anchor",
+		DstNode:           "EE",
+		ExtraTrustedNodes: []string{"ICA"},
+		InvalidEdges:      []Edge{{"Trust Anchor", "ICA"}},
+		InvalidReason:     INVALID_REASON_EXPIRED,
+		Comment:           "The ICA is trusted alongside the trust anchor, so the expired TA => ICA cert should not cause validation to fail.",
+	},
+	{
+		TrustGraph:        TWO_ROOTS,
+		SrcNode:           "Root1",
+		DstNode:           "EE",
+		ExtraTrustedNodes: []string{"Root2"},
+		InvalidEdges:      []Edge{{"Root1", "ICA"}},
+		InvalidReason:     INVALID_REASON_EXPIRED,
+		Comment:           "Should be able to discover a path to the second trusted root when the first is invalid.",
+	},
+	{
+		TrustGraph:        TWO_ROOTS,
+		SrcNode:           "Root1",
+		DstNode:           "EE",
+		ExtraTrustedNodes: []string{"Root2"},
+		DistractorRoots:   []string{"Root1", "Root2"},
+		Comment:           "Both roots are trusted, each alongside a distractor with the same subject.",
+	},
+	{
+		TrustGraph:        BRIDGE_CA_PKI,
+		SrcNode:           "TA Z",
+		DstNode:           "EE",
+		ExtraTrustedNodes: []string{"TA X"},
+		InvalidEdges:      []Edge{{"TA Z", "Bridge CA"}},
+		InvalidReason:     INVALID_REASON_EXPIRED,
+		Comment:           "Infrastructure X's root is trusted directly, so the invalid certificate to the bridge CA is irrelevant.",
+	},
+}
+
+// Test cases where the client is given some intermediates ahead of time, and the server leaves them out of its
+// chain. The first of these is used to check whether the client can be given out-of-band intermediates at all.
+var OUT_OF_BAND_INTERMEDIATE_TEST_CASES = []*ExplicitTestCase{
+	{
+		TrustGraph:     LINEAR_TRUST_GRAPH,
+		SrcNode:        "Trust Anchor",
+		DstNode:        "EE",
+		OutOfBandEdges: []Edge{{"Trust Anchor", "ICA"}},
+		Comment:        "The server only sends the leaf, and the client already has the ICA.",
+	},
+	{
+		TrustGraph:     LINEAR_TRUST_GRAPH,
+		SrcNode:        "Trust Anchor",
+		DstNode:        "EE",
+		OutOfBandEdges: []Edge{{"Trust Anchor", "ICA"}},
+		InvalidEdges:   []Edge{{"Trust Anchor", "ICA"}},
+		InvalidReason:  INVALID_REASON_EXPIRED,
+		ExpectFailure:  true,
+		Comment:        "The ICA the client already has is expired.",
+	},
+	{
+		TrustGraph:     TWO_ROOTS,
+		SrcNode:        "Root2",
+		DstNode:        "EE",
+		OutOfBandEdges: []Edge{{"Root2", "ICA"}},
+		Comment:        "The server only sends the ICA cross-signed by the untrusted root, and the client already has the one signed by the trusted root.",
+	},
+	{
+		TrustGraph:     TWO_ROOTS,
+		SrcNode:        "Root1",
+		DstNode:        "EE",
+		OutOfBandEdges: []Edge{{"Root2", "ICA"}},
+		InvalidEdges:   []Edge{{"Root1", "ICA"}},
+		InvalidReason:  INVALID_REASON_EXPIRED,
+		ExpectFailure:  true,
+		Comment:        "The ICA the client already has leads to an untrusted root, and the one sent by the server is expired.",
+	},
+	{
+		TrustGraph:     BRIDGE_CA_PKI,
+		SrcNode:        "TA Z",
+		DstNode:        "EE",
+		OutOfBandEdges: []Edge{{"TA Z", "Bridge CA"}, {"Bridge CA", "TA X"}},
+		Comment:        "The client already has the bridge CA's cross-certificates, which the server doesn't send.",
+	},
+}
@@ -11,7 +11,49 @@ import (
 	"github.com/Netflix/bettertls/test-suites/certutil"
 )
 
+// GenerateOptions customizes how GenerateCertsWithOptions creates the certificates for a trust graph.
+type GenerateOptions struct {
+	// If set, called with the template for each edge's certificate just before it is signed.
+	EditTemplate func(edge Edge, template *x509.Certificate)
+	// If set, called with the subject of each edge's certificate. A non-nil result is used as the DER encoding of the
+	// subject instead of the one x509.CreateCertificate would produce.
+	EncodeSubject func(edge Edge, subject pkix.Name) ([]byte, error)
+	// Like EncodeSubject, for the issuer of each edge's certificate (which is otherwise the issuing node's subject,
+	// exactly as encoded in the node's certificate).
+	EncodeIssuer func(edge Edge, issuer pkix.Name) ([]byte, error)
+}
+
+// GeneratedCerts holds all of the certificates and keys generated for a test case's trust graph.
+type GeneratedCerts struct {
+	// The certificate for each edge in the trust graph
+	EdgeCerts map[Edge]*x509.Certificate
+	// A self-signed certificate for each node in the trust graph. For the test case's source node, this is the trust
+	// root that was passed in.
+	NodeCerts map[string]*x509.Certificate
+	// The private key for each node in the trust graph
+	NodeKeys map[string]crypto.Signer
+	// The certificate chain (leaf first, followed by all intermediates in edge order) and key for the test case's
+	// destination node
+	Chain *tls.Certificate
+	// The certificates the client should trust: one for each trusted node, with any distractor root placed just
+	// before the node it shares a subject with
+	TrustAnchors []*x509.Certificate
+	// The certificates for the test case's out-of-band edges, which are not part of Chain
+	OutOfBandIntermediates []*x509.Certificate
+}
+
 func GenerateCerts(rootCa *x509.Certificate, rootKey crypto.Signer, leafDnsName string, testCase *TestCaseImpl) (*tls.Certificate, error) {
+	generated, err := GenerateCertsWithOptions(rootCa, rootKey, leafDnsName, testCase, nil)
+	if err != nil {
+		return nil, err
+	}
+	return generated.Chain, nil
+}
+
+func GenerateCertsWithOptions(rootCa *x509.Certificate, rootKey crypto.Signer, leafDnsName string, testCase *TestCaseImpl, options *GenerateOptions) (*GeneratedCerts, error) {
+	if options == nil {
+		options = &GenerateOptions{}
+	}
 
 	// Generate self-signed certs and keys for all entities in the graph
 	entityKeys := make(map[string]crypto.Signer)
@@ -75,7 +117,31 @@ func GenerateCerts(rootCa *x509.Certificate, rootKey crypto.Signer, leafDnsName
 			}
 		}
 
-		certBytes, err := x509.CreateCertificate(rand.Reader, template, issuerCert, entityKeys[dst].Public(), issuerKey)
+		if options.EditTemplate != nil {
+			options.EditTemplate(Edge{src, dst}, template)
+		}
+		if options.EncodeSubject != nil {
+			rawSubject, err := options.EncodeSubject(Edge{src, dst}, template.Subject)
+			if err != nil {
+				return nil, err
+			}
+			template.RawSubject = rawSubject
+		}
+		parent := issuerCert
+		if options.EncodeIssuer != nil {
+			rawIssuer, err := options.EncodeIssuer(Edge{src, dst}, issuerCert.Subject)
+			if err != nil {
+				return nil, err
+			}
+			if rawIssuer != nil {
+				// x509.CreateCertificate takes the issuer from the parent's raw subject
+				parentCopy := *issuerCert
+				parentCopy.RawSubject = rawIssuer
+				parent = &parentCopy
+			}
+		}
+
+		certBytes, err := x509.CreateCertificate(rand.Reader, template, parent, entityKeys[dst].Public(), issuerKey)
 		if err != nil {
 			return nil, err
 		}
@@ -86,6 +152,8 @@ func GenerateCerts(rootCa *x509.Certificate, rootKey crypto.Signer, leafDnsName
 		return cert, nil
 	}
 
+	edgeCerts := make(map[Edge]*x509.Certificate)
+	outOfBand := make([]*x509.Certificate, 0)
 	leafCerts := make([][]byte, 0, 1)
 	intermediates := make([][]byte, 0, testCase.ExplicitTestCase.TrustGraph.EdgeCount())
 	for _, edge := range testCase.ExplicitTestCase.TrustGraph.GetAllEdges() {
@@ -94,16 +162,51 @@ func GenerateCerts(rootCa *x509.Certificate, rootKey crypto.Signer, leafDnsName
 		if err != nil {
 			return nil, err
 		}
+		edgeCerts[edge] = cert
 
-		if edge.Destination == testCase.ExplicitTestCase.DstNode {
+		if edge.MemberOf(testCase.ExplicitTestCase.OutOfBandEdges) {
+			outOfBand = append(outOfBand, cert)
+		} else if edge.Destination == testCase.ExplicitTestCase.DstNode {
 			leafCerts = append(leafCerts, cert.Raw)
 		} else {
 			intermediates = append(intermediates, cert.Raw)
 		}
 	}
 
-	return &tls.Certificate{
-		Certificate: append(leafCerts, intermediates...),
-		PrivateKey:  entityKeys[testCase.ExplicitTestCase.DstNode],
+	trustAnchors := make([]*x509.Certificate, 0)
+	addDistractor := func(node string) error {
+		distractor, _, err := certutil.GenerateSelfSignedCertWithSubject(entitySelfSignedCerts[node].Subject)
+		if err != nil {
+			return err
+		}
+		trustAnchors = append(trustAnchors, distractor)
+		return nil
+	}
+	for _, node := range testCase.ExplicitTestCase.TrustedNodes() {
+		if stringInSlice(testCase.ExplicitTestCase.DistractorRoots, node) {
+			if err := addDistractor(node); err != nil {
+				return nil, err
+			}
+		}
+		trustAnchors = append(trustAnchors, entitySelfSignedCerts[node])
+	}
+	for _, node := range testCase.ExplicitTestCase.DistractorRoots {
+		if !stringInSlice(testCase.ExplicitTestCase.TrustedNodes(), node) {
+			if err := addDistractor(node); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &GeneratedCerts{
+		TrustAnchors:           trustAnchors,
+		OutOfBandIntermediates: outOfBand,
+		EdgeCerts:              edgeCerts,
+		NodeCerts:              entitySelfSignedCerts,
+		NodeKeys:               entityKeys,
+		Chain: &tls.Certificate{
+			Certificate: append(leafCerts, intermediates...),
+			PrivateKey:  entityKeys[testCase.ExplicitTestCase.DstNode],
+		},
 	}, nil
 }
@@ -13,7 +13,9 @@ const (
 )
 
 type TestCaseProvider struct {
-	testCases []test_case.TestCase
+	testCases                             []test_case.TestCase
+	multipleTrustAnchorsFeatureTestCase   uint
+	outOfBandIntermediatesFeatureTestCase uint
 }
 
 func NewTestCaseProvider() *TestCaseProvider {
@@ -78,8 +80,26 @@ func NewTestCaseProvider() *TestCaseProvider {
 		}
 	}
 
+	multipleTrustAnchorsFeatureTestCase := uint(len(testCases))
+	for _, testCase := range MULTIPLE_TRUST_ANCHOR_TEST_CASES {
+		testCases = append(testCases, &TestCaseImpl{
+			ExplicitTestCase: testCase,
+			InvalidReason:    testCase.InvalidReason,
+		})
+	}
+
+	outOfBandIntermediatesFeatureTestCase := uint(len(testCases))
+	for _, testCase := range OUT_OF_BAND_INTERMEDIATE_TEST_CASES {
+		testCases = append(testCases, &TestCaseImpl{
+			ExplicitTestCase: testCase,
+			InvalidReason:    testCase.InvalidReason,
+		})
+	}
+
 	return &TestCaseProvider{
-		testCases: testCases,
+		testCases:                             testCases,
+		multipleTrustAnchorsFeatureTestCase:   multipleTrustAnchorsFeatureTestCase,
+		outOfBandIntermediatesFeatureTestCase: outOfBandIntermediatesFeatureTestCase,
 	}
 }
 
@@ -100,7 +120,7 @@ func (p *TestCaseProvider) GetSanityCheckTestCase() (uint, error) {
 }
 
 func (p *TestCaseProvider) GetFeatures() []test_case.Feature {
-	features := make([]test_case.Feature, 0, 1+len(InvalidReasons()))
+	features := make([]test_case.Feature, 0, 3+len(InvalidReasons()))
 	features = append(features, FEATURE_BRANCHING)
 	for _, invalidReason := range InvalidReasons() {
 		if invalidReason == INVALID_REASON_UNSPECIFIED {
@@ -108,6 +128,7 @@ func (p *TestCaseProvider) GetFeatures() []test_case.Feature {
 		}
 		features = append(features, invalidReasonToFeature(invalidReason))
 	}
+	features = append(features, FEATURE_MULTIPLE_TRUST_ANCHORS, FEATURE_OUT_OF_BAND_INTERMEDIATES)
 	return features
 }
 
@@ -115,6 +136,12 @@ func (p *TestCaseProvider) DescribeFeature(feature test_case.Feature) string {
 	if feature == FEATURE_BRANCHING {
 		return "BRANCHING"
 	}
+	if feature == FEATURE_MULTIPLE_TRUST_ANCHORS {
+		return "MULTIPLE_TRUST_ANCHORS"
+	}
+	if feature == FEATURE_OUT_OF_BAND_INTERMEDIATES {
+		return "OUT_OF_BAND_INTERMEDIATES"
+	}
 	for _, reason := range InvalidReasons() {
 		if reason == INVALID_REASON_UNSPECIFIED {
 			continue
@@ -130,6 +157,12 @@ func (p *TestCaseProvider) GetTestCasesForFeature(feature test_case.Feature) ([]
 	if feature == FEATURE_BRANCHING {
 		return []uint{BRANCHING_FEATURE_TEST_CASE_1, BRANCHING_FEATURE_TEST_CASE_2}, nil
 	}
+	if feature == FEATURE_MULTIPLE_TRUST_ANCHORS {
+		return []uint{p.multipleTrustAnchorsFeatureTestCase}, nil
+	}
+	if feature == FEATURE_OUT_OF_BAND_INTERMEDIATES {
+		return []uint{p.outOfBandIntermediatesFeatureTestCase}, nil
+	}
 	for idx, reason := range InvalidReasons() {
 		if feature == invalidReasonToFeature(reason) {
 			return []uint{FIRST_INVALID_REASON_TEST_CASE + uint(idx-1)}, nil
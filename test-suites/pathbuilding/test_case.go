@@ -9,6 +9,10 @@ import (
 
 const FEATURE_BRANCHING = 0
 
+// Numbered well clear of the features derived from invalid reasons, so that adding a reason doesn't renumber it
+const FEATURE_MULTIPLE_TRUST_ANCHORS test_case.Feature = 100
+const FEATURE_OUT_OF_BAND_INTERMEDIATES test_case.Feature = 101
+
 func invalidReasonToFeature(reason InvalidReason) test_case.Feature {
 	return test_case.Feature(1 + reason)
 }
@@ -23,8 +27,7 @@ func (p *TestCaseImpl) GetHostname() string {
 }
 
 func (p *TestCaseImpl) ExpectedResult() test_case.ExpectedResult {
-	etc := p.ExplicitTestCase
-	path := etc.TrustGraph.Reachable(etc.InvalidEdges, etc.SrcNode, etc.DstNode)
+	path := p.ExplicitTestCase.FindTrustedPath()
 	if len(path) > 0 {
 		return test_case.EXPECTED_RESULT_PASS
 	}
@@ -32,16 +35,34 @@ func (p *TestCaseImpl) ExpectedResult() test_case.ExpectedResult {
 }
 
 func (p *TestCaseImpl) RequiredFeatures() []test_case.Feature {
-	requiredFeatures := make([]test_case.Feature, 0, 2)
+	requiredFeatures := make([]test_case.Feature, 0, 4)
 	if p.ExplicitTestCase.TrustGraph != LINEAR_TRUST_GRAPH {
 		requiredFeatures = append(requiredFeatures, FEATURE_BRANCHING)
 	}
 	if len(p.ExplicitTestCase.InvalidEdges) > 0 && p.InvalidReason != INVALID_REASON_UNSPECIFIED {
 		requiredFeatures = append(requiredFeatures, invalidReasonToFeature(p.InvalidReason))
 	}
+	if len(p.ExplicitTestCase.ExtraTrustedNodes) > 0 || len(p.ExplicitTestCase.DistractorRoots) > 0 {
+		requiredFeatures = append(requiredFeatures, FEATURE_MULTIPLE_TRUST_ANCHORS)
+	}
+	if len(p.ExplicitTestCase.OutOfBandEdges) > 0 {
+		requiredFeatures = append(requiredFeatures, FEATURE_OUT_OF_BAND_INTERMEDIATES)
+	}
 	return requiredFeatures
 }
 
 func (p *TestCaseImpl) GetCertificates(rootCert *x509.Certificate, rootKey crypto.Signer) (*tls.Certificate, error) {
 	return GenerateCerts(rootCert, rootKey, "localhost", p)
 }
+
+func (p *TestCaseImpl) GetArtifacts(env *test_case.Environment) (*test_case.Artifacts, error) {
+	generated, err := GenerateCertsWithOptions(env.RootCert, env.RootKey, "localhost", p, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &test_case.Artifacts{
+		Certificate:   generated.Chain,
+		TrustAnchors:  generated.TrustAnchors,
+		Intermediates: generated.OutOfBandIntermediates,
+	}, nil
+}
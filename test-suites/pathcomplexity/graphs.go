@@ -0,0 +1,100 @@
+package pathcomplexity
+
+import (
+	"fmt"
+
+	"github.com/Netflix/bettertls/test-suites/pathbuilding"
+)
+
+// DeepChain returns a trust graph with a single path from "Trust Anchor" to "EE" that passes through the given number
+// of intermediate CAs.
+func DeepChain(depth int) *pathbuilding.TrustGraph {
+	icaName := func(i int) string {
+		return fmt.Sprintf("ICA %d", i)
+	}
+
+	edges := make([]pathbuilding.Edge, 0, depth+1)
+	edges = append(edges, pathbuilding.Edge{Source: icaName(depth), Destination: "EE"})
+	for i := depth; i > 1; i-- {
+		edges = append(edges, pathbuilding.Edge{Source: icaName(i - 1), Destination: icaName(i)})
+	}
+	edges = append(edges, pathbuilding.Edge{Source: "Trust Anchor", Destination: icaName(1)})
+	return pathbuilding.NewGraph(fmt.Sprintf("DEEP_CHAIN_%d", depth), edges)
+}
+
+/*
+FanIn returns a trust graph where the ICA issuing the EE certificate has been cross-signed by the given number of
+untrusted roots in addition to the trust anchor. The certificate from the trust anchor is always the last one sent.
+
+	+--------+
+	| Root 1 |=======v
+	+--------+       |
+	   ...           +-----+      +----+
+	+--------+       | ICA |=====>| EE |
+	| Root N |=======>-----+      +----+
+	+--------+       ^
+	+--------------+ |
+	| Trust Anchor |=+
+	+--------------+
+*/
+func FanIn(width int) *pathbuilding.TrustGraph {
+	edges := make([]pathbuilding.Edge, 0, width+2)
+	edges = append(edges, pathbuilding.Edge{Source: "ICA", Destination: "EE"})
+	for i := 1; i <= width; i++ {
+		edges = append(edges, pathbuilding.Edge{Source: fmt.Sprintf("Root %d", i), Destination: "ICA"})
+	}
+	edges = append(edges, pathbuilding.Edge{Source: "Trust Anchor", Destination: "ICA"})
+	return pathbuilding.NewGraph(fmt.Sprintf("FAN_IN_%d", width), edges)
+}
+
+/*
+Mesh returns a trust graph with depth layers of width CAs each, where every CA in a layer has a certificate from every
+CA in the layer above it, plus the edges which must be considered invalid so that exactly one path from "Trust Anchor"
+to "EE" remains. The valid path always goes through the last CA of each layer and its certificates are sent after all
+of the invalid alternatives, so a path builder that doesn't prune invalid edges early may have to consider every one of
+the width^depth paths through the mesh before finding it.
+
+	    +--------------+
+	    | Trust Anchor |
+	    +--------------+
+	     /      |     \
+	+-----+ +-----+ +-----+
+	| 1.1 | | 1.2 | | 1.3 |
+	+-----+ +-----+ +-----+
+	   |   X   |   X   |
+	+-----+ +-----+ +-----+
+	| 2.1 | | 2.2 | | 2.3 |
+	+-----+ +-----+ +-----+
+	                   |
+	                 +----+
+	                 | EE |
+	                 +----+
+*/
+func Mesh(width int, depth int) (*pathbuilding.TrustGraph, []pathbuilding.Edge) {
+	caName := func(layer int, i int) string {
+		return fmt.Sprintf("CA %d.%d", layer, i)
+	}
+
+	edges := make([]pathbuilding.Edge, 0, 1+(depth-1)*width*width+width)
+	invalidEdges := make([]pathbuilding.Edge, 0, cap(edges)-depth-1)
+	edges = append(edges, pathbuilding.Edge{Source: caName(depth, width), Destination: "EE"})
+	for layer := depth; layer > 1; layer-- {
+		for dst := 1; dst <= width; dst++ {
+			for src := 1; src <= width; src++ {
+				edge := pathbuilding.Edge{Source: caName(layer-1, src), Destination: caName(layer, dst)}
+				edges = append(edges, edge)
+				if src != width || dst != width {
+					invalidEdges = append(invalidEdges, edge)
+				}
+			}
+		}
+	}
+	for dst := 1; dst <= width; dst++ {
+		edge := pathbuilding.Edge{Source: "Trust Anchor", Destination: caName(1, dst)}
+		edges = append(edges, edge)
+		if dst != width {
+			invalidEdges = append(invalidEdges, edge)
+		}
+	}
+	return pathbuilding.NewGraph(fmt.Sprintf("MESH_%dx%d", width, depth), edges), invalidEdges
+}
@@ -0,0 +1,187 @@
+package pathcomplexity
+
+import (
+	"fmt"
+
+	"github.com/Netflix/bettertls/test-suites/pathbuilding"
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+)
+
+const (
+	SANITY_CHECK_TEST_CASE uint = iota
+	BRANCHING_FEATURE_TEST_CASE
+	INVALID_REASON_EXPIRED_FEATURE_TEST_CASE
+)
+
+const (
+	FEATURE_BRANCHING test_case.Feature = iota
+	FEATURE_INVALID_REASON_EXPIRED
+)
+
+// Graphs at or below these sizes are small enough that every client which supports path building should be able to
+// find the valid path through them.
+const (
+	MAX_COMMON_CHAIN_DEPTH = 10
+	MAX_COMMON_FAN_IN      = 10
+	MAX_COMMON_MESH_PATHS  = 27
+)
+
+var CHAIN_DEPTHS = []int{10, 25, 50, 100}
+var FAN_IN_WIDTHS = []int{10, 50, 100}
+var MESH_SIZES = [][2]int{{3, 3}, {4, 4}, {5, 5}, {6, 6}}
+
+type TestCaseProvider struct {
+	testCases []test_case.TestCase
+}
+
+func NewTestCaseProvider() *TestCaseProvider {
+	testCases := make([]test_case.TestCase, 3)
+
+	testCases[SANITY_CHECK_TEST_CASE] = &ComplexityTestCase{
+		ExplicitTestCase: &pathbuilding.ExplicitTestCase{
+			TrustGraph: DeepChain(1),
+			SrcNode:    "Trust Anchor",
+			DstNode:    "EE",
+		},
+	}
+	testCases[BRANCHING_FEATURE_TEST_CASE] = &ComplexityTestCase{
+		ExplicitTestCase: &pathbuilding.ExplicitTestCase{
+			TrustGraph: FanIn(1),
+			SrcNode:    "Trust Anchor",
+			DstNode:    "EE",
+		},
+	}
+	testCases[INVALID_REASON_EXPIRED_FEATURE_TEST_CASE] = &ComplexityTestCase{
+		ExplicitTestCase: &pathbuilding.ExplicitTestCase{
+			TrustGraph:    DeepChain(1),
+			SrcNode:       "Trust Anchor",
+			DstNode:       "EE",
+			InvalidEdges:  []pathbuilding.Edge{{Source: "Trust Anchor", Destination: "ICA 1"}},
+			InvalidReason: pathbuilding.INVALID_REASON_EXPIRED,
+			ExpectFailure: true,
+		},
+	}
+
+	for _, depth := range CHAIN_DEPTHS {
+		graph := DeepChain(depth)
+		testCases = append(testCases, &ComplexityTestCase{
+			ExplicitTestCase: &pathbuilding.ExplicitTestCase{
+				TrustGraph: graph,
+				SrcNode:    "Trust Anchor",
+				DstNode:    "EE",
+				Comment:    fmt.Sprintf("A single chain through %d intermediates.", depth),
+			},
+			ExceedsCommonLimits: depth > MAX_COMMON_CHAIN_DEPTH,
+		})
+		testCases = append(testCases, &ComplexityTestCase{
+			ExplicitTestCase: &pathbuilding.ExplicitTestCase{
+				TrustGraph:    graph,
+				SrcNode:       "Trust Anchor",
+				DstNode:       "EE",
+				InvalidEdges:  []pathbuilding.Edge{{Source: "Trust Anchor", Destination: "ICA 1"}},
+				InvalidReason: pathbuilding.INVALID_REASON_EXPIRED,
+				ExpectFailure: true,
+				Comment:       fmt.Sprintf("A single chain through %d intermediates, broken at the very top.", depth),
+			},
+		})
+	}
+
+	for _, width := range FAN_IN_WIDTHS {
+		graph := FanIn(width)
+		testCases = append(testCases, &ComplexityTestCase{
+			ExplicitTestCase: &pathbuilding.ExplicitTestCase{
+				TrustGraph: graph,
+				SrcNode:    "Trust Anchor",
+				DstNode:    "EE",
+				Comment:    fmt.Sprintf("The ICA is cross-signed by %d untrusted roots before the trust anchor.", width),
+			},
+			ExceedsCommonLimits: width > MAX_COMMON_FAN_IN,
+		})
+		testCases = append(testCases, &ComplexityTestCase{
+			ExplicitTestCase: &pathbuilding.ExplicitTestCase{
+				TrustGraph:    graph,
+				SrcNode:       "Trust Anchor",
+				DstNode:       "EE",
+				InvalidEdges:  []pathbuilding.Edge{{Source: "Trust Anchor", Destination: "ICA"}},
+				InvalidReason: pathbuilding.INVALID_REASON_EXPIRED,
+				ExpectFailure: true,
+				Comment:       fmt.Sprintf("The ICA is cross-signed by %d untrusted roots and the trust anchor's certificate is invalid.", width),
+			},
+		})
+	}
+
+	for _, size := range MESH_SIZES {
+		width, depth := size[0], size[1]
+		graph, invalidEdges := Mesh(width, depth)
+		pathCount := 1
+		for i := 0; i < depth; i++ {
+			pathCount *= width
+		}
+		testCases = append(testCases, &ComplexityTestCase{
+			ExplicitTestCase: &pathbuilding.ExplicitTestCase{
+				TrustGraph:    graph,
+				SrcNode:       "Trust Anchor",
+				DstNode:       "EE",
+				InvalidEdges:  invalidEdges,
+				InvalidReason: pathbuilding.INVALID_REASON_EXPIRED,
+				Comment:       fmt.Sprintf("A %dx%d mesh of cross-signed CAs with one valid path out of %d.", width, depth, pathCount),
+			},
+			ExceedsCommonLimits: pathCount > MAX_COMMON_MESH_PATHS,
+		})
+		testCases = append(testCases, &ComplexityTestCase{
+			ExplicitTestCase: &pathbuilding.ExplicitTestCase{
+				TrustGraph:    graph,
+				SrcNode:       "Trust Anchor",
+				DstNode:       "EE",
+				InvalidEdges:  append(append([]pathbuilding.Edge{}, invalidEdges...), pathbuilding.Edge{Source: "Trust Anchor", Destination: fmt.Sprintf("CA 1.%d", width)}),
+				InvalidReason: pathbuilding.INVALID_REASON_EXPIRED,
+				ExpectFailure: true,
+				Comment:       fmt.Sprintf("A %dx%d mesh of cross-signed CAs with no valid path.", width, depth),
+			},
+		})
+	}
+
+	return &TestCaseProvider{
+		testCases: testCases,
+	}
+}
+
+func (p *TestCaseProvider) Name() string {
+	return "pathcomplexity"
+}
+
+func (p *TestCaseProvider) GetTestCaseCount() (uint, error) {
+	return uint(len(p.testCases)), nil
+}
+
+func (p *TestCaseProvider) GetTestCase(index uint) (test_case.TestCase, error) {
+	return p.testCases[index], nil
+}
+
+func (p *TestCaseProvider) GetSanityCheckTestCase() (uint, error) {
+	return SANITY_CHECK_TEST_CASE, nil
+}
+
+func (p *TestCaseProvider) GetFeatures() []test_case.Feature {
+	return []test_case.Feature{FEATURE_BRANCHING, FEATURE_INVALID_REASON_EXPIRED}
+}
+
+func (p *TestCaseProvider) DescribeFeature(feature test_case.Feature) string {
+	switch feature {
+	case FEATURE_BRANCHING:
+		return "BRANCHING"
+	case FEATURE_INVALID_REASON_EXPIRED:
+		return "INVALID_REASON_EXPIRED"
+	}
+	panic(fmt.Errorf("unsupported feature: %d", feature))
+}
+
+func (p *TestCaseProvider) GetTestCasesForFeature(feature test_case.Feature) ([]uint, error) {
+	switch feature {
+	case FEATURE_BRANCHING:
+		return []uint{BRANCHING_FEATURE_TEST_CASE}, nil
+	case FEATURE_INVALID_REASON_EXPIRED:
+		return []uint{INVALID_REASON_EXPIRED_FEATURE_TEST_CASE}, nil
+	}
+	return nil, fmt.Errorf("invalid feature: %v", feature)
+}
@@ -0,0 +1,63 @@
+package pathcomplexity
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+
+	"github.com/Netflix/bettertls/test-suites/pathbuilding"
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+)
+
+type ComplexityTestCase struct {
+	ExplicitTestCase *pathbuilding.ExplicitTestCase
+	// Whether the trust graph is large enough that a client may reasonably refuse to build a path through it, e.g.
+	// because it caps the length of chains or the number of candidate paths it will consider.
+	ExceedsCommonLimits bool
+}
+
+func (c *ComplexityTestCase) GetHostname() string {
+	return "localhost"
+}
+
+func (c *ComplexityTestCase) ExpectedResult() test_case.ExpectedResult {
+	etc := c.ExplicitTestCase
+	path := etc.TrustGraph.Reachable(etc.InvalidEdges, etc.SrcNode, etc.DstNode)
+	if len(path) == 0 {
+		return test_case.EXPECTED_RESULT_FAIL
+	}
+	if c.ExceedsCommonLimits {
+		return test_case.EXPECTED_RESULT_SOFT_PASS
+	}
+	return test_case.EXPECTED_RESULT_PASS
+}
+
+func (c *ComplexityTestCase) RequiredFeatures() []test_case.Feature {
+	requiredFeatures := make([]test_case.Feature, 0, 2)
+	if c.hasBranches() {
+		requiredFeatures = append(requiredFeatures, FEATURE_BRANCHING)
+	}
+	if len(c.ExplicitTestCase.InvalidEdges) > 0 {
+		requiredFeatures = append(requiredFeatures, FEATURE_INVALID_REASON_EXPIRED)
+	}
+	return requiredFeatures
+}
+
+// hasBranches returns whether any node in the trust graph has more than one certificate.
+func (c *ComplexityTestCase) hasBranches() bool {
+	destinations := pathbuilding.NewStringSet()
+	for _, edge := range c.ExplicitTestCase.TrustGraph.GetAllEdges() {
+		if destinations.Contains(edge.Destination) {
+			return true
+		}
+		destinations.Add(edge.Destination)
+	}
+	return false
+}
+
+func (c *ComplexityTestCase) GetCertificates(rootCert *x509.Certificate, rootKey crypto.Signer) (*tls.Certificate, error) {
+	return pathbuilding.GenerateCerts(rootCert, rootKey, "localhost", &pathbuilding.TestCaseImpl{
+		ExplicitTestCase: c.ExplicitTestCase,
+		InvalidReason:    c.ExplicitTestCase.InvalidReason,
+	})
+}
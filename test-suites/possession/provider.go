@@ -0,0 +1,103 @@
+package possession
+
+import (
+	"fmt"
+
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+)
+
+const (
+	SANITY_CHECK_TEST_CASE uint = iota
+	TLS_1_2_FEATURE_TEST_CASE
+	TLS_1_3_FEATURE_TEST_CASE
+	RSA_FEATURE_TEST_CASE
+)
+
+const (
+	FEATURE_TLS_1_2 test_case.Feature = iota
+	FEATURE_TLS_1_3
+	FEATURE_RSA
+)
+
+type TestCaseProvider struct {
+	testCases []test_case.TestCase
+}
+
+func NewTestCaseProvider() *TestCaseProvider {
+	testCases := []test_case.TestCase{
+		SANITY_CHECK_TEST_CASE:    &PossessionTestCase{},
+		TLS_1_2_FEATURE_TEST_CASE: &PossessionTestCase{TlsVersion: TLS_VERSION_1_2},
+		TLS_1_3_FEATURE_TEST_CASE: &PossessionTestCase{TlsVersion: TLS_VERSION_1_3},
+		RSA_FEATURE_TEST_CASE:     &PossessionTestCase{KeyType: KEY_TYPE_RSA},
+	}
+
+	for _, keyType := range ALL_KEY_TYPES {
+		for _, tlsVersion := range ALL_TLS_VERSIONS {
+			if keyType == KEY_TYPE_RSA {
+				// The ECDSA equivalents are the TLS version feature tests
+				testCases = append(testCases, &PossessionTestCase{
+					KeyType:    keyType,
+					TlsVersion: tlsVersion,
+				})
+			}
+			for _, fault := range ALL_FAULTS {
+				if fault == FAULT_WRONG_KEY_TYPE && tlsVersion != TLS_VERSION_1_3 {
+					continue
+				}
+				testCases = append(testCases, &PossessionTestCase{
+					KeyType:    keyType,
+					TlsVersion: tlsVersion,
+					Fault:      fault,
+				})
+			}
+		}
+	}
+
+	return &TestCaseProvider{
+		testCases: testCases,
+	}
+}
+
+func (p *TestCaseProvider) Name() string {
+	return "possession"
+}
+
+func (p *TestCaseProvider) GetTestCaseCount() (uint, error) {
+	return uint(len(p.testCases)), nil
+}
+
+func (p *TestCaseProvider) GetTestCase(index uint) (test_case.TestCase, error) {
+	return p.testCases[index], nil
+}
+
+func (p *TestCaseProvider) GetSanityCheckTestCase() (uint, error) {
+	return SANITY_CHECK_TEST_CASE, nil
+}
+
+func (p *TestCaseProvider) GetFeatures() []test_case.Feature {
+	return []test_case.Feature{FEATURE_TLS_1_2, FEATURE_TLS_1_3, FEATURE_RSA}
+}
+
+func (p *TestCaseProvider) DescribeFeature(feature test_case.Feature) string {
+	switch feature {
+	case FEATURE_TLS_1_2:
+		return "TLS_1_2"
+	case FEATURE_TLS_1_3:
+		return "TLS_1_3"
+	case FEATURE_RSA:
+		return "RSA"
+	}
+	panic(fmt.Errorf("unsupported feature: %d", feature))
+}
+
+func (p *TestCaseProvider) GetTestCasesForFeature(feature test_case.Feature) ([]uint, error) {
+	switch feature {
+	case FEATURE_TLS_1_2:
+		return []uint{TLS_1_2_FEATURE_TEST_CASE}, nil
+	case FEATURE_TLS_1_3:
+		return []uint{TLS_1_3_FEATURE_TEST_CASE}, nil
+	case FEATURE_RSA:
+		return []uint{RSA_FEATURE_TEST_CASE}, nil
+	}
+	return nil, fmt.Errorf("invalid feature: %v", feature)
+}
@@ -0,0 +1,241 @@
+package possession
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/Netflix/bettertls/test-suites/certutil"
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+)
+
+// A KeyType is the type of the leaf's key.
+type KeyType int
+
+const (
+	KEY_TYPE_ECDSA KeyType = iota
+	KEY_TYPE_RSA
+)
+
+var ALL_KEY_TYPES = []KeyType{KEY_TYPE_ECDSA, KEY_TYPE_RSA}
+
+func (k KeyType) String() string {
+	switch k {
+	case KEY_TYPE_ECDSA:
+		return "ECDSA"
+	case KEY_TYPE_RSA:
+		return "RSA"
+	}
+	panic(fmt.Errorf("unhandled KeyType: %d", k))
+}
+func (k KeyType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(k.String())
+}
+
+func (k KeyType) generateKey() (crypto.Signer, error) {
+	switch k {
+	case KEY_TYPE_ECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KEY_TYPE_RSA:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+	panic(fmt.Errorf("unhandled KeyType: %d", k))
+}
+
+func (k KeyType) other() KeyType {
+	if k == KEY_TYPE_ECDSA {
+		return KEY_TYPE_RSA
+	}
+	return KEY_TYPE_ECDSA
+}
+
+// A TlsVersion is the TLS version the server negotiates. The handshake signature is over ServerKeyExchange in TLS 1.2
+// and CertificateVerify in TLS 1.3.
+type TlsVersion int
+
+const (
+	// Whichever version the client and server prefer
+	TLS_VERSION_ANY TlsVersion = iota
+	TLS_VERSION_1_2
+	TLS_VERSION_1_3
+)
+
+var ALL_TLS_VERSIONS = []TlsVersion{TLS_VERSION_1_2, TLS_VERSION_1_3}
+
+func (v TlsVersion) String() string {
+	switch v {
+	case TLS_VERSION_ANY:
+		return "ANY"
+	case TLS_VERSION_1_2:
+		return "TLS_1_2"
+	case TLS_VERSION_1_3:
+		return "TLS_1_3"
+	}
+	panic(fmt.Errorf("unhandled TlsVersion: %d", v))
+}
+func (v TlsVersion) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.String())
+}
+
+func (v TlsVersion) version() uint16 {
+	switch v {
+	case TLS_VERSION_ANY:
+		return 0
+	case TLS_VERSION_1_2:
+		return tls.VersionTLS12
+	case TLS_VERSION_1_3:
+		return tls.VersionTLS13
+	}
+	panic(fmt.Errorf("unhandled TlsVersion: %d", v))
+}
+
+// A Fault is what's wrong with the key the server signs the handshake with.
+type Fault int
+
+const (
+	FAULT_NONE Fault = iota
+	// A different key of the same type (and curve or size) as the leaf's
+	FAULT_WRONG_KEY
+	// A key of the other type. Only over TLS 1.3: over TLS 1.2, crypto/tls picks the cipher suite by the signing key's
+	// type, and clients reject a suite that doesn't match the certificate's key before checking the ServerKeyExchange
+	// signature.
+	FAULT_WRONG_KEY_TYPE
+	// The leaf's key, with a byte of every signature flipped
+	FAULT_CORRUPT_SIGNATURE
+)
+
+var ALL_FAULTS = []Fault{FAULT_WRONG_KEY, FAULT_WRONG_KEY_TYPE, FAULT_CORRUPT_SIGNATURE}
+
+func (f Fault) String() string {
+	switch f {
+	case FAULT_NONE:
+		return "NONE"
+	case FAULT_WRONG_KEY:
+		return "WRONG_KEY"
+	case FAULT_WRONG_KEY_TYPE:
+		return "WRONG_KEY_TYPE"
+	case FAULT_CORRUPT_SIGNATURE:
+		return "CORRUPT_SIGNATURE"
+	}
+	panic(fmt.Errorf("unhandled Fault: %d", f))
+}
+func (f Fault) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.String())
+}
+
+// corruptingSigner signs with the wrapped key, then flips the last byte of the signature. For ECDSA, that leaves the
+// DER encoding of the signature intact.
+type corruptingSigner struct {
+	crypto.Signer
+}
+
+func (s corruptingSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	signature, err := s.Signer.Sign(rand, digest, opts)
+	if err != nil {
+		return nil, err
+	}
+	signature[len(signature)-1] ^= 0xff
+	return signature, nil
+}
+
+// A PossessionTestCase presents a valid chain for the hostname, but signs the handshake with a key other than the
+// leaf's (or corrupts the signature). The server can't prove it holds the leaf's key, so clients must always reject it.
+type PossessionTestCase struct {
+	KeyType    KeyType
+	TlsVersion TlsVersion
+	Fault      Fault
+}
+
+func (t *PossessionTestCase) ExpectedResult() test_case.ExpectedResult {
+	if t.Fault == FAULT_NONE {
+		return test_case.EXPECTED_RESULT_PASS
+	}
+	return test_case.EXPECTED_RESULT_FAIL
+}
+
+func (t *PossessionTestCase) GetHostname() string {
+	return "localhost"
+}
+
+func (t *PossessionTestCase) RequiredFeatures() []test_case.Feature {
+	var requiredFeatures []test_case.Feature
+	switch t.TlsVersion {
+	case TLS_VERSION_1_2:
+		requiredFeatures = append(requiredFeatures, FEATURE_TLS_1_2)
+	case TLS_VERSION_1_3:
+		requiredFeatures = append(requiredFeatures, FEATURE_TLS_1_3)
+	}
+	if t.KeyType == KEY_TYPE_RSA {
+		requiredFeatures = append(requiredFeatures, FEATURE_RSA)
+	}
+	return requiredFeatures
+}
+
+func (t *PossessionTestCase) RequiresHandshake() bool {
+	return true
+}
+
+func (t *PossessionTestCase) GetCertificates(rootCert *x509.Certificate, rootKey crypto.Signer) (*tls.Certificate, error) {
+	artifacts, err := t.GetArtifacts(&test_case.Environment{RootCert: rootCert, RootKey: rootKey})
+	if err != nil {
+		return nil, err
+	}
+	return artifacts.Certificate, nil
+}
+
+func (t *PossessionTestCase) GetArtifacts(env *test_case.Environment) (*test_case.Artifacts, error) {
+	leafKey, err := t.KeyType.generateKey()
+	if err != nil {
+		return nil, err
+	}
+	leafBytes, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: certutil.RandomSerial(),
+		Subject: pkix.Name{
+			Organization: []string{certutil.SUBJECT_ORGANIZATION},
+			SerialNumber: certutil.RandomString(),
+		},
+		NotBefore:             certutil.GetNotBefore(),
+		NotAfter:              certutil.GetNotAfter(false),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:              []string{t.GetHostname()},
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+	}, env.RootCert, leafKey.Public(), env.RootKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var signingKey crypto.Signer
+	switch t.Fault {
+	case FAULT_NONE:
+		signingKey = leafKey
+	case FAULT_WRONG_KEY:
+		signingKey, err = t.KeyType.generateKey()
+	case FAULT_WRONG_KEY_TYPE:
+		signingKey, err = t.KeyType.other().generateKey()
+	case FAULT_CORRUPT_SIGNATURE:
+		signingKey = corruptingSigner{leafKey}
+	default:
+		panic(fmt.Errorf("unhandled Fault: %d", t.Fault))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &test_case.Artifacts{
+		Certificate: &tls.Certificate{
+			Certificate: [][]byte{leafBytes},
+			PrivateKey:  signingKey,
+		},
+		TlsVersion: t.TlsVersion.version(),
+	}, nil
+}
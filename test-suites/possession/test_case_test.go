@@ -0,0 +1,94 @@
+package possession
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+
+	"github.com/Netflix/bettertls/test-suites/certutil"
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorruptingSigner(t *testing.T) {
+	digest := sha256.Sum256([]byte("handshake"))
+
+	ecdsaKey, err := KEY_TYPE_ECDSA.generateKey()
+	require.NoError(t, err)
+	signature, err := corruptingSigner{ecdsaKey}.Sign(rand.Reader, digest[:], crypto.SHA256)
+	require.NoError(t, err)
+	// The signature is still a well-formed Ecdsa-Sig-Value, it just doesn't verify
+	var sig struct {
+		R, S *big.Int
+	}
+	rest, err := asn1.Unmarshal(signature, &sig)
+	require.NoError(t, err)
+	assert.Empty(t, rest)
+	assert.False(t, ecdsa.VerifyASN1(ecdsaKey.Public().(*ecdsa.PublicKey), digest[:], signature))
+
+	rsaKey, err := KEY_TYPE_RSA.generateKey()
+	require.NoError(t, err)
+	signature, err = corruptingSigner{rsaKey}.Sign(rand.Reader, digest[:], crypto.SHA256)
+	require.NoError(t, err)
+	assert.Error(t, rsa.VerifyPKCS1v15(rsaKey.Public().(*rsa.PublicKey), crypto.SHA256, digest[:], signature))
+	signature[len(signature)-1] ^= 0xff
+	assert.NoError(t, rsa.VerifyPKCS1v15(rsaKey.Public().(*rsa.PublicKey), crypto.SHA256, digest[:], signature))
+}
+
+func TestGetArtifacts(t *testing.T) {
+	rootCert, rootKey, err := certutil.GenerateSelfSignedCert("root")
+	require.NoError(t, err)
+	env := &test_case.Environment{RootCert: rootCert, RootKey: rootKey}
+
+	for _, keyType := range ALL_KEY_TYPES {
+		for _, fault := range append([]Fault{FAULT_NONE}, ALL_FAULTS...) {
+			testCase := &PossessionTestCase{KeyType: keyType, TlsVersion: TLS_VERSION_1_3, Fault: fault}
+			name := keyType.String() + "/" + fault.String()
+			artifacts, err := testCase.GetArtifacts(env)
+			require.NoError(t, err, name)
+			require.Len(t, artifacts.Certificate.Certificate, 1, name)
+			leaf, err := x509.ParseCertificate(artifacts.Certificate.Certificate[0])
+			require.NoError(t, err, name)
+			require.NoError(t, leaf.CheckSignatureFrom(rootCert), name)
+			assert.Equal(t, uint16(tls.VersionTLS13), artifacts.TlsVersion, name)
+
+			// Only the wrong-key faults swap out the leaf's key
+			signer, ok := artifacts.Certificate.PrivateKey.(crypto.Signer)
+			require.True(t, ok, name)
+			type publicKey interface {
+				Equal(crypto.PublicKey) bool
+			}
+			matchesLeaf := signer.Public().(publicKey).Equal(leaf.PublicKey)
+			assert.Equal(t, fault == FAULT_NONE || fault == FAULT_CORRUPT_SIGNATURE, matchesLeaf, name)
+			_, isCorrupting := signer.(corruptingSigner)
+			assert.Equal(t, fault == FAULT_CORRUPT_SIGNATURE, isCorrupting, name)
+			_, isEcdsa := signer.Public().(*ecdsa.PublicKey)
+			assert.Equal(t, (keyType == KEY_TYPE_ECDSA) != (fault == FAULT_WRONG_KEY_TYPE), isEcdsa, name)
+		}
+	}
+}
+
+func TestProviderWrongKeyTypeOnlyOverTls13(t *testing.T) {
+	provider := NewTestCaseProvider()
+	count, err := provider.GetTestCaseCount()
+	require.NoError(t, err)
+	wrongKeyTypeCases := 0
+	for i := uint(0); i < count; i++ {
+		testCase, err := provider.GetTestCase(i)
+		require.NoError(t, err)
+		possessionTestCase := testCase.(*PossessionTestCase)
+		if possessionTestCase.Fault == FAULT_WRONG_KEY_TYPE {
+			assert.Equal(t, TLS_VERSION_1_3, possessionTestCase.TlsVersion)
+			wrongKeyTypeCases++
+		}
+	}
+	assert.Equal(t, len(ALL_KEY_TYPES), wrongKeyTypeCases)
+}
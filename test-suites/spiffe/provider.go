@@ -0,0 +1,151 @@
+package spiffe
+
+import (
+	"fmt"
+
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+)
+
+const (
+	SANITY_CHECK_TEST_CASE uint = iota
+)
+
+type TestCaseProvider struct {
+	testCases []test_case.TestCase
+}
+
+func NewTestCaseProvider() *TestCaseProvider {
+	testCases := []test_case.TestCase{
+		SANITY_CHECK_TEST_CASE: &SpiffeTestCase{
+			UriSans:  []string{SPIFFE_ID},
+			Expected: test_case.EXPECTED_RESULT_PASS,
+		},
+		// An X509-SVID must have exactly one URI SAN, but generic URI SAN matchers accept any matching SAN
+		&SpiffeTestCase{
+			UriSans:  []string{SPIFFE_ID, OTHER_SPIFFE_ID},
+			Expected: test_case.EXPECTED_RESULT_SOFT_PASS,
+		},
+		&SpiffeTestCase{
+			UriSans:  []string{OTHER_SPIFFE_ID, SPIFFE_ID},
+			Expected: test_case.EXPECTED_RESULT_SOFT_PASS,
+		},
+		&SpiffeTestCase{
+			UriSans:  []string{OTHER_SPIFFE_ID},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		// The identity must be a URI SAN, not a DNS SAN or CN, and the hostname isn't an identity
+		&SpiffeTestCase{
+			DnsSans:  []string{HOSTNAME},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		&SpiffeTestCase{
+			CommonName: SPIFFE_ID,
+			Expected:   test_case.EXPECTED_RESULT_FAIL,
+		},
+		&SpiffeTestCase{
+			DnsSans:  []string{SPIFFE_ID},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		// SPIFFE IDs may not have a trailing slash, and aren't normalized before being compared
+		&SpiffeTestCase{
+			UriSans:  []string{SPIFFE_ID + "/"},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		// The scheme and trust domain are case-insensitive under RFC 3986, but SPIFFE requires them to be lowercase
+		&SpiffeTestCase{
+			UriSans:  []string{"SPIFFE://" + TRUST_DOMAIN + "/ns/x"},
+			Expected: test_case.EXPECTED_RESULT_SOFT_FAIL,
+		},
+		&SpiffeTestCase{
+			UriSans:  []string{"spiffe://BETTERTLS.TEST/ns/x"},
+			Expected: test_case.EXPECTED_RESULT_SOFT_FAIL,
+		},
+		// Paths are case-sensitive
+		&SpiffeTestCase{
+			UriSans:  []string{"spiffe://" + TRUST_DOMAIN + "/NS/x"},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		// SPIFFE IDs may not have a query, fragment, userinfo or port, nor empty, "." or percent-encoded path segments
+		&SpiffeTestCase{
+			UriSans:  []string{SPIFFE_ID + "?q=1"},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		&SpiffeTestCase{
+			UriSans:  []string{SPIFFE_ID + "#fragment"},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		&SpiffeTestCase{
+			UriSans:  []string{"spiffe://user@" + TRUST_DOMAIN + "/ns/x"},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		&SpiffeTestCase{
+			UriSans:  []string{"spiffe://" + TRUST_DOMAIN + ":443/ns/x"},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		&SpiffeTestCase{
+			UriSans:  []string{"spiffe://" + TRUST_DOMAIN + "//ns/x"},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		&SpiffeTestCase{
+			UriSans:  []string{"spiffe://" + TRUST_DOMAIN + "/ns/./x"},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		&SpiffeTestCase{
+			UriSans:  []string{"spiffe://" + TRUST_DOMAIN + "/ns/%78"},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		// Prefix matching is not identity matching
+		&SpiffeTestCase{
+			UriSans:  []string{SPIFFE_ID + "y"},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		&SpiffeTestCase{
+			UriSans:  []string{"spiffe://" + TRUST_DOMAIN + "/ns"},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		&SpiffeTestCase{
+			UriSans:  []string{SPIFFE_ID + "/y"},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		&SpiffeTestCase{
+			UriSans:  []string{"https://" + TRUST_DOMAIN + "/ns/x"},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+		&SpiffeTestCase{
+			UriSans:  []string{"spiffe:///ns/x"},
+			Expected: test_case.EXPECTED_RESULT_FAIL,
+		},
+	}
+
+	return &TestCaseProvider{
+		testCases: testCases,
+	}
+}
+
+func (p *TestCaseProvider) Name() string {
+	return "spiffe"
+}
+
+func (p *TestCaseProvider) GetTestCaseCount() (uint, error) {
+	return uint(len(p.testCases)), nil
+}
+
+func (p *TestCaseProvider) GetTestCase(index uint) (test_case.TestCase, error) {
+	return p.testCases[index], nil
+}
+
+func (p *TestCaseProvider) GetSanityCheckTestCase() (uint, error) {
+	return SANITY_CHECK_TEST_CASE, nil
+}
+
+func (p *TestCaseProvider) GetFeatures() []test_case.Feature {
+	return nil
+}
+
+func (p *TestCaseProvider) DescribeFeature(feature test_case.Feature) string {
+	panic(fmt.Errorf("unsupported feature: %d", feature))
+}
+
+func (p *TestCaseProvider) GetTestCasesForFeature(feature test_case.Feature) ([]uint, error) {
+	return nil, fmt.Errorf("invalid feature: %v", feature)
+}
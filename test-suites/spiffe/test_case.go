@@ -0,0 +1,95 @@
+package spiffe
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+
+	"github.com/Netflix/bettertls/test-suites/certutil"
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+)
+
+// The name the client connects to. Leaf certificates don't have it as a SAN, since clients verify SPIFFE_ID instead.
+const HOSTNAME = "localhost"
+const TRUST_DOMAIN = "bettertls.test"
+const SPIFFE_ID = "spiffe://" + TRUST_DOMAIN + "/ns/x"
+const OTHER_SPIFFE_ID = "spiffe://" + TRUST_DOMAIN + "/ns/y"
+
+// A SpiffeTestCase has the client verify the server by the URI identity SPIFFE_ID, and presents a leaf with the given
+// SANs (encoded as-is, so they may be malformed).
+type SpiffeTestCase struct {
+	UriSans    []string
+	DnsSans    []string `json:",omitempty"`
+	CommonName string   `json:",omitempty"`
+	Expected   test_case.ExpectedResult
+}
+
+func (t *SpiffeTestCase) ExpectedResult() test_case.ExpectedResult {
+	return t.Expected
+}
+
+func (t *SpiffeTestCase) GetHostname() string {
+	return HOSTNAME
+}
+
+func (t *SpiffeTestCase) GetUriIdentity() string {
+	return SPIFFE_ID
+}
+
+func (t *SpiffeTestCase) RequiredFeatures() []test_case.Feature {
+	return nil
+}
+
+// sans returns the leaf's SANs: the URIs, then the DNS names.
+func (t *SpiffeTestCase) sans() []certutil.GeneralName {
+	var sans []certutil.GeneralName
+	for _, uri := range t.UriSans {
+		sans = append(sans, certutil.UriName(uri))
+	}
+	for _, dnsName := range t.DnsSans {
+		sans = append(sans, certutil.DnsName(dnsName))
+	}
+	return sans
+}
+
+func (t *SpiffeTestCase) GetCertificates(rootCert *x509.Certificate, rootKey crypto.Signer) (*tls.Certificate, error) {
+	leafTemplate := &x509.Certificate{
+		SerialNumber: certutil.RandomSerial(),
+		Subject: pkix.Name{
+			CommonName:   t.CommonName,
+			Organization: []string{certutil.SUBJECT_ORGANIZATION},
+			SerialNumber: certutil.RandomString(),
+		},
+		NotBefore:             certutil.GetNotBefore(),
+		NotAfter:              certutil.GetNotAfter(false),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+	}
+	if sans := t.sans(); len(sans) > 0 {
+		sanExt, err := certutil.BuildSanExtension(false, sans)
+		if err != nil {
+			return nil, err
+		}
+		leafTemplate.ExtraExtensions = []pkix.Extension{sanExt}
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	leafBytes, err := x509.CreateCertificate(rand.Reader, leafTemplate, rootCert, leafKey.Public(), rootKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{leafBytes},
+		PrivateKey:  leafKey,
+	}, nil
+}
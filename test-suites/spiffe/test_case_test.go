@@ -0,0 +1,60 @@
+package spiffe
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/Netflix/bettertls/test-suites/certutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanExtension(t *testing.T) {
+	testCase := &SpiffeTestCase{
+		UriSans: []string{SPIFFE_ID, "spiffe://BetterTLS.test/ns/x?q"},
+		DnsSans: []string{HOSTNAME},
+	}
+	ext, err := certutil.BuildSanExtension(false, testCase.sans())
+	require.NoError(t, err)
+	assert.Equal(t, "2.5.29.17", ext.Id.String())
+	assert.False(t, ext.Critical)
+
+	// The URIs ([6]) come before the DNS names ([2]), and are encoded as-is even though the second isn't a valid SPIFFE
+	// ID
+	var expected []byte
+	for _, san := range []struct {
+		tag   byte
+		value string
+	}{{0x86, SPIFFE_ID}, {0x86, "spiffe://BetterTLS.test/ns/x?q"}, {0x82, HOSTNAME}} {
+		expected = append(expected, san.tag, byte(len(san.value)))
+		expected = append(expected, san.value...)
+	}
+	assert.Equal(t, append([]byte{0x30, byte(len(expected))}, expected...), ext.Value)
+}
+
+func TestGetCertificates(t *testing.T) {
+	rootCert, rootKey, err := certutil.GenerateSelfSignedCert("root")
+	require.NoError(t, err)
+
+	certificate, err := (&SpiffeTestCase{UriSans: []string{SPIFFE_ID, OTHER_SPIFFE_ID}, DnsSans: []string{HOSTNAME}}).GetCertificates(rootCert, rootKey)
+	require.NoError(t, err)
+	require.Len(t, certificate.Certificate, 1)
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	require.NoError(t, err)
+	require.Len(t, leaf.URIs, 2)
+	assert.Equal(t, SPIFFE_ID, leaf.URIs[0].String())
+	assert.Equal(t, OTHER_SPIFFE_ID, leaf.URIs[1].String())
+	assert.Equal(t, []string{HOSTNAME}, leaf.DNSNames)
+	assert.Contains(t, leaf.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+	require.NoError(t, leaf.CheckSignatureFrom(rootCert))
+
+	// Without any SANs, the leaf has no SAN extension at all
+	certificate, err = (&SpiffeTestCase{CommonName: SPIFFE_ID}).GetCertificates(rootCert, rootKey)
+	require.NoError(t, err)
+	leaf, err = x509.ParseCertificate(certificate.Certificate[0])
+	require.NoError(t, err)
+	assert.Equal(t, SPIFFE_ID, leaf.Subject.CommonName)
+	for _, ext := range leaf.Extensions {
+		assert.NotEqual(t, "2.5.29.17", ext.Id.String())
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 )
 
@@ -82,3 +83,130 @@ type TestCaseProvider interface {
 	// For a given feature, a list of test cases (as indices) that must pass for the client to be considered to support the feature.
 	GetTestCasesForFeature(feature Feature) ([]uint, error)
 }
+
+// The AIA base URL used for artifacts that aren't hosted by a running server, i.e. that of a server started with the
+// default plaintext port.
+const DEFAULT_AIA_BASE_URL = "http://127.0.0.1:8080/aia/"
+
+// Environment describes the server that a test case's artifacts will be served from.
+type Environment struct {
+	RootCert *x509.Certificate
+	RootKey  crypto.Signer
+	// The base URL (ending in "/") under which Artifacts.AiaResources are served, e.g. "http://127.0.0.1:8080/aia/"
+	AiaBaseUrl string
+}
+
+// An AiaResource is a document served over plaintext HTTP, e.g. for clients following caIssuers URLs.
+type AiaResource struct {
+	ContentType string
+	Body        []byte
+}
+
+// Artifacts are everything the server needs in order to host a single instance of a test case.
+type Artifacts struct {
+	// The certificate chain and key presented in the TLS handshake
+	Certificate *tls.Certificate
+	// Resources served under Environment.AiaBaseUrl, keyed by their path relative to it
+	AiaResources map[string]*AiaResource
+	// The certificates the client should trust. If empty, this is just Environment.RootCert.
+	TrustAnchors []*x509.Certificate
+	// Untrusted intermediates the client should be given ahead of time, separately from the server's chain
+	Intermediates []*x509.Certificate
+	// If set, the only TLS version (e.g. tls.VersionTLS12) the server will negotiate
+	TlsVersion uint16
+}
+
+// TrustAnchorsPem encodes the trust anchors as a PEM bundle, suitable for a client's CA file.
+func (a *Artifacts) TrustAnchorsPem() []byte {
+	return encodePemBundle(a.TrustAnchors)
+}
+
+// IntermediatesPem encodes the out-of-band intermediates as a PEM bundle.
+func (a *Artifacts) IntermediatesPem() []byte {
+	return encodePemBundle(a.Intermediates)
+}
+
+// ChainPem encodes the certificate chain presented in the handshake (leaf first) as a PEM bundle.
+func (a *Artifacts) ChainPem() []byte {
+	return encodeDerPemBundle(a.Certificate.Certificate)
+}
+
+// LeafPem encodes just the leaf certificate.
+func (a *Artifacts) LeafPem() []byte {
+	return encodeDerPemBundle(a.Certificate.Certificate[:1])
+}
+
+func encodePemBundle(certs []*x509.Certificate) []byte {
+	var bundle []byte
+	for _, cert := range certs {
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return bundle
+}
+
+func encodeDerPemBundle(certs [][]byte) []byte {
+	var bundle []byte
+	for _, cert := range certs {
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})...)
+	}
+	return bundle
+}
+
+// ArtifactTestCase is implemented by test cases that need more than a certificate chain to be hosted.
+type ArtifactTestCase interface {
+	TestCase
+	GetArtifacts(env *Environment) (*Artifacts, error)
+}
+
+// GetArtifacts gets the artifacts for a test case, falling back to TestCase.GetCertificates for test cases that do
+// not implement ArtifactTestCase.
+func GetArtifacts(testCase TestCase, env *Environment) (*Artifacts, error) {
+	var artifacts *Artifacts
+	if artifactTestCase, ok := testCase.(ArtifactTestCase); ok {
+		var err error
+		artifacts, err = artifactTestCase.GetArtifacts(env)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		certs, err := testCase.GetCertificates(env.RootCert, env.RootKey)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = &Artifacts{Certificate: certs}
+	}
+	if len(artifacts.TrustAnchors) == 0 {
+		artifacts.TrustAnchors = []*x509.Certificate{env.RootCert}
+	}
+	return artifacts, nil
+}
+
+// UriIdentityTestCase is implemented by test cases where the client should verify the server by a URI SAN (e.g. a
+// SPIFFE ID) instead of by hostname. GetHostname is still the name the client connects to.
+type UriIdentityTestCase interface {
+	TestCase
+	GetUriIdentity() string
+}
+
+// GetUriIdentity gets the URI identity the server should be verified by, or "" if it should be verified by hostname.
+func GetUriIdentity(testCase TestCase) string {
+	if uriIdentityTestCase, ok := testCase.(UriIdentityTestCase); ok {
+		return uriIdentityTestCase.GetUriIdentity()
+	}
+	return ""
+}
+
+// HandshakeTestCase is implemented by test cases whose outcome depends on the TLS handshake itself (e.g. whether the
+// server can prove possession of the leaf's key), so they can't be run by verifying the certificates alone.
+type HandshakeTestCase interface {
+	TestCase
+	RequiresHandshake() bool
+}
+
+// RequiresHandshake reports whether a test case can only be run with a real TLS handshake.
+func RequiresHandshake(testCase TestCase) bool {
+	if handshakeTestCase, ok := testCase.(HandshakeTestCase); ok {
+		return handshakeTestCase.RequiresHandshake()
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package test_executor
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// How much of a test's traffic a trafficRecorder keeps. Clients that are given a chain are done with the test after a
+// handshake, so this only stops a misbehaving client from using up memory.
+const maxCapturedBytes = 16 << 20
+
+// A trafficRecorder keeps the raw bytes of the TCP connections to the TLS and STARTTLS listeners (and through the
+// CONNECT proxy) since it was last reset, along with the TLS secrets the server logged for them, so that a test's
+// traffic can be written out as a capture. Only TCP is captured: QUIC connections aren't recorded. Once maxBytes of
+// data have been recorded, the rest is dropped.
+type trafficRecorder struct {
+	lock     sync.Mutex
+	maxBytes int
+	bytes    int
+	// Whether data was dropped because of maxBytes
+	truncated bool
+	conns     []*recordedConn
+	keyLog    bytes.Buffer
+}
+
+// A recordedSegment is what one Read or Write on a connection carried. A segment with fin set is the end of one side
+// of the connection.
+type recordedSegment struct {
+	fromClient bool
+	time       time.Time
+	data       []byte
+	fin        bool
+}
+
+type recordedConn struct {
+	net.Conn
+	recorder *trafficRecorder
+	start    time.Time
+	segments []recordedSegment
+	// Whether each side has ended the connection
+	clientFin bool
+	serverFin bool
+}
+
+func newTrafficRecorder(maxBytes int) *trafficRecorder {
+	return &trafficRecorder{maxBytes: maxBytes}
+}
+
+func (r *trafficRecorder) reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.bytes = 0
+	r.truncated = false
+	r.conns = nil
+	r.keyLog.Reset()
+}
+
+// Write records a line of the key log (in the format of tls.Config.KeyLogWriter).
+func (r *trafficRecorder) Write(line []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.keyLog.Write(line)
+}
+
+func (r *trafficRecorder) wrap(conn net.Conn) net.Conn {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	recorded := &recordedConn{Conn: conn, recorder: r, start: time.Now()}
+	r.conns = append(r.conns, recorded)
+	return recorded
+}
+
+// writeCapture writes everything recorded since the last reset as a pcapng file.
+func (r *trafficRecorder) writeCapture(w io.Writer) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.truncated {
+		logrus.Warnf("The capture only has the first %d bytes of the test's traffic", r.maxBytes)
+	}
+	return writePcapng(w, r.conns, r.keyLog.Bytes())
+}
+
+func (c *recordedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.record(true, b[:n], errors.Is(err, io.EOF))
+	return n, err
+}
+
+func (c *recordedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.record(false, b[:n], false)
+	return n, err
+}
+
+func (c *recordedConn) Close() error {
+	c.record(false, nil, true)
+	return c.Conn.Close()
+}
+
+func (c *recordedConn) record(fromClient bool, data []byte, fin bool) {
+	c.recorder.lock.Lock()
+	defer c.recorder.lock.Unlock()
+	now := time.Now()
+	if len(data) > c.recorder.maxBytes-c.recorder.bytes {
+		data = data[:c.recorder.maxBytes-c.recorder.bytes]
+		c.recorder.truncated = true
+	}
+	c.recorder.bytes += len(data)
+	if len(data) > 0 {
+		c.segments = append(c.segments, recordedSegment{fromClient: fromClient, time: now, data: append([]byte(nil), data...)})
+	}
+	if fin && fromClient && !c.clientFin {
+		c.clientFin = true
+		c.segments = append(c.segments, recordedSegment{fromClient: true, time: now, fin: true})
+	}
+	if fin && !fromClient && !c.serverFin {
+		c.serverFin = true
+		c.segments = append(c.segments, recordedSegment{fromClient: false, time: now, fin: true})
+	}
+}
+
+// A recordingListener records every connection it accepts.
+type recordingListener struct {
+	net.Listener
+	recorder *trafficRecorder
+}
+
+func (l *recordingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.recorder.wrap(conn), nil
+}
@@ -0,0 +1,47 @@
+package test_executor
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrafficRecorderLimit(t *testing.T) {
+	recorder := newTrafficRecorder(10)
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := recorder.wrap(server)
+	go func() {
+		client.Write([]byte("0123456"))
+		client.Write([]byte("789abc"))
+		io.Copy(io.Discard, client)
+	}()
+
+	buffer := make([]byte, 7)
+	_, err := io.ReadFull(conn, buffer)
+	require.NoError(t, err)
+	_, err = io.ReadFull(conn, buffer[:6])
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("xyz"))
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	// Data past the limit is dropped, but the connection is still closed
+	recorded := recorder.conns[0]
+	require.Len(t, recorded.segments, 3)
+	assert.Equal(t, []byte("0123456"), recorded.segments[0].data)
+	assert.Equal(t, []byte("789"), recorded.segments[1].data)
+	assert.True(t, recorded.segments[2].fin)
+	assert.True(t, recorder.truncated)
+
+	// A reset starts over
+	recorder.reset()
+	assert.Empty(t, recorder.conns)
+	assert.False(t, recorder.truncated)
+	var capture bytes.Buffer
+	require.NoError(t, recorder.writeCapture(&capture))
+}
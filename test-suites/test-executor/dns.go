@@ -0,0 +1,212 @@
+package test_executor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// The zone the DNS responder answers for if ServerOptions.DnsZone isn't set. .test is reserved for testing (RFC 6761),
+// so it can never shadow a real name.
+const DefaultDnsZone = "bettertls.test"
+
+// How long resolvers may cache an answer
+const dnsTtl = 60
+
+// How long a TCP client can stay connected to the DNS responder
+const dnsTcpTimeout = 10 * time.Second
+
+// A dnsResponder answers A and AAAA queries for the names under a zone, and for a list of other names, with the test
+// server's loopback address. It's authoritative for those names and refuses everything else, so it never needs the
+// network.
+type dnsResponder struct {
+	zone  string
+	names map[string]bool
+	ipv4  net.IP
+	// nil if the server doesn't listen on IPv6
+	ipv6 net.IP
+
+	udpConn     net.PacketConn
+	tcpListener net.Listener
+}
+
+// canonicalDnsName lowercases a name and makes it fully qualified, as names appear in queries.
+func canonicalDnsName(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
+
+// newDnsResponder listens for DNS queries over UDP and TCP on a loopback address. bindAddress is the test server's bind
+// address, which determines the addresses in answers.
+func newDnsResponder(bindAddress string, port uint16, zone string, names []string) (*dnsResponder, error) {
+	responder := &dnsResponder{
+		zone:  canonicalDnsName(zone),
+		names: make(map[string]bool),
+		ipv4:  net.IPv4(127, 0, 0, 1),
+		ipv6:  net.IPv6loopback,
+	}
+	for _, name := range names {
+		responder.names[canonicalDnsName(name)] = true
+	}
+	if bindIp := net.ParseIP(bindAddress); bindIp != nil {
+		switch {
+		case bindIp.IsUnspecified() && bindIp.To4() != nil:
+			// 0.0.0.0 only listens on IPv4
+			responder.ipv6 = nil
+		case bindIp.IsUnspecified():
+		case !bindIp.IsLoopback():
+			return nil, fmt.Errorf("the DNS responder only answers with loopback addresses, but the server is bound to %s", bindAddress)
+		case bindIp.To4() != nil:
+			responder.ipv4, responder.ipv6 = bindIp, nil
+		default:
+			responder.ipv4, responder.ipv6 = nil, bindIp
+		}
+	}
+
+	// Never listen beyond loopback, whatever the server is bound to
+	listenIp := responder.ipv4
+	if listenIp == nil {
+		listenIp = responder.ipv6
+	}
+	var err error
+	responder.tcpListener, err = net.Listen("tcp", net.JoinHostPort(listenIp.String(), strconv.Itoa(int(port))))
+	if err != nil {
+		return nil, err
+	}
+	// Use the same port for UDP, in case it was chosen by the system
+	udpPort := responder.tcpListener.Addr().(*net.TCPAddr).Port
+	responder.udpConn, err = net.ListenPacket("udp", net.JoinHostPort(listenIp.String(), strconv.Itoa(udpPort)))
+	if err != nil {
+		responder.tcpListener.Close()
+		return nil, err
+	}
+	return responder, nil
+}
+
+func (d *dnsResponder) Port() int {
+	return d.tcpListener.Addr().(*net.TCPAddr).Port
+}
+
+func (d *dnsResponder) Close() error {
+	d.udpConn.Close()
+	return d.tcpListener.Close()
+}
+
+func (d *dnsResponder) answersFor(name string) bool {
+	return name == d.zone || strings.HasSuffix(name, "."+d.zone) || d.names[name]
+}
+
+// answer builds the response to a query, or returns nil if the query should be dropped.
+func (d *dnsResponder) answer(query []byte) []byte {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil || header.Response {
+		return nil
+	}
+	questions, err := parser.AllQuestions()
+	if err != nil {
+		return nil
+	}
+	response := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               header.ID,
+			Response:         true,
+			OpCode:           header.OpCode,
+			Authoritative:    true,
+			RecursionDesired: header.RecursionDesired,
+		},
+		Questions: questions,
+	}
+
+	switch {
+	case header.OpCode != 0:
+		response.RCode = dnsmessage.RCodeNotImplemented
+	case len(questions) != 1:
+		response.RCode = dnsmessage.RCodeFormatError
+	case questions[0].Class != dnsmessage.ClassINET || !d.answersFor(strings.ToLower(questions[0].Name.String())):
+		response.Authoritative = false
+		response.RCode = dnsmessage.RCodeRefused
+	default:
+		// Other types (and A or AAAA for an address family the server doesn't listen on) get an empty answer
+		question := questions[0]
+		resourceHeader := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: dnsTtl}
+		if question.Type == dnsmessage.TypeA && d.ipv4 != nil {
+			var a dnsmessage.AResource
+			copy(a.A[:], d.ipv4.To4())
+			response.Answers = append(response.Answers, dnsmessage.Resource{Header: resourceHeader, Body: &a})
+		} else if question.Type == dnsmessage.TypeAAAA && d.ipv6 != nil {
+			var aaaa dnsmessage.AAAAResource
+			copy(aaaa.AAAA[:], d.ipv6.To16())
+			response.Answers = append(response.Answers, dnsmessage.Resource{Header: resourceHeader, Body: &aaaa})
+		}
+	}
+
+	packed, err := response.Pack()
+	if err != nil {
+		logrus.Debugf("Failed to pack DNS response: %v", err)
+		return nil
+	}
+	return packed
+}
+
+// serveUdp answers queries over UDP until the responder is closed.
+func (d *dnsResponder) serveUdp() {
+	buffer := make([]byte, 65535)
+	for {
+		n, addr, err := d.udpConn.ReadFrom(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		if response := d.answer(buffer[:n]); response != nil {
+			d.udpConn.WriteTo(response, addr)
+		}
+	}
+}
+
+// serveTcp answers queries over TCP until the responder is closed.
+func (d *dnsResponder) serveTcp() {
+	for {
+		conn, err := d.tcpListener.Accept()
+		if err != nil {
+			return
+		}
+		go d.handleTcp(conn)
+	}
+}
+
+func (d *dnsResponder) handleTcp(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(dnsTcpTimeout))
+	for {
+		// Messages over TCP are prefixed with their length
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		response := d.answer(query)
+		if response == nil {
+			return
+		}
+		if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(response))), response...)); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package test_executor
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func packDnsQuery(t *testing.T, id uint16, name string, qtype dnsmessage.Type) []byte {
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	packed, err := query.Pack()
+	require.NoError(t, err)
+	return packed
+}
+
+func unpackDnsResponse(t *testing.T, packed []byte) *dnsmessage.Message {
+	require.NotNil(t, packed)
+	var response dnsmessage.Message
+	require.NoError(t, response.Unpack(packed))
+	return &response
+}
+
+func TestDnsResponderAnswers(t *testing.T) {
+	responder := &dnsResponder{
+		zone:  canonicalDnsName("BetterTLS.test"),
+		names: map[string]bool{canonicalDnsName("extra.example"): true},
+		ipv4:  net.IPv4(127, 0, 0, 1),
+		ipv6:  net.IPv6loopback,
+	}
+
+	for _, name := range []string{"bettertls.test.", "www.bettertls.test.", "WWW.BetterTLS.Test.", "extra.example."} {
+		response := unpackDnsResponse(t, responder.answer(packDnsQuery(t, 1, name, dnsmessage.TypeA)))
+		assert.Equal(t, uint16(1), response.ID, name)
+		assert.True(t, response.Response, name)
+		assert.True(t, response.Authoritative, name)
+		assert.True(t, response.RecursionDesired, name)
+		assert.Equal(t, dnsmessage.RCodeSuccess, response.RCode, name)
+		require.Len(t, response.Answers, 1, name)
+		assert.Equal(t, name, response.Answers[0].Header.Name.String())
+		assert.Equal(t, uint32(dnsTtl), response.Answers[0].Header.TTL)
+		assert.Equal(t, &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}}, response.Answers[0].Body, name)
+	}
+
+	response := unpackDnsResponse(t, responder.answer(packDnsQuery(t, 2, "www.bettertls.test.", dnsmessage.TypeAAAA)))
+	assert.Equal(t, dnsmessage.RCodeSuccess, response.RCode)
+	require.Len(t, response.Answers, 1)
+	assert.Equal(t, dnsmessage.TypeAAAA, response.Answers[0].Header.Type)
+	var aaaa dnsmessage.AAAAResource
+	copy(aaaa.AAAA[:], net.IPv6loopback)
+	assert.Equal(t, &aaaa, response.Answers[0].Body)
+
+	// Other types get an empty answer
+	response = unpackDnsResponse(t, responder.answer(packDnsQuery(t, 3, "www.bettertls.test.", dnsmessage.TypeMX)))
+	assert.Equal(t, dnsmessage.RCodeSuccess, response.RCode)
+	assert.Empty(t, response.Answers)
+
+	// Names that aren't for tests are refused, including ones that only end with the zone's name
+	for _, name := range []string{"example.com.", "notbettertls.test.", "extra.example.com."} {
+		response = unpackDnsResponse(t, responder.answer(packDnsQuery(t, 4, name, dnsmessage.TypeA)))
+		assert.Equal(t, dnsmessage.RCodeRefused, response.RCode, name)
+		assert.False(t, response.Authoritative, name)
+		assert.Empty(t, response.Answers, name)
+	}
+	response = unpackDnsResponse(t, responder.answer(packDnsQuery(t, 5, "example.com.", dnsmessage.TypeAAAA)))
+	assert.Equal(t, dnsmessage.RCodeRefused, response.RCode)
+	assert.Empty(t, response.Answers)
+}
+
+func TestDnsResponderMalformedQueries(t *testing.T) {
+	responder := &dnsResponder{zone: canonicalDnsName(DefaultDnsZone), ipv4: net.IPv4(127, 0, 0, 1)}
+
+	// Garbage and responses are dropped
+	assert.Nil(t, responder.answer([]byte{0x01}))
+	response := unpackDnsResponse(t, responder.answer(packDnsQuery(t, 1, "www.bettertls.test.", dnsmessage.TypeA)))
+	response.Response = true
+	packed, err := response.Pack()
+	require.NoError(t, err)
+	assert.Nil(t, responder.answer(packed))
+
+	// Queries with several questions get a format error
+	query := dnsmessage.Message{Questions: []dnsmessage.Question{
+		{Name: dnsmessage.MustNewName("a.bettertls.test."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+		{Name: dnsmessage.MustNewName("b.bettertls.test."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+	}}
+	packed, err = query.Pack()
+	require.NoError(t, err)
+	assert.Equal(t, dnsmessage.RCodeFormatError, unpackDnsResponse(t, responder.answer(packed)).RCode)
+}
+
+func TestDnsResponderIpv4Only(t *testing.T) {
+	responder, err := newDnsResponder("127.0.0.1", 0, DefaultDnsZone, nil)
+	require.NoError(t, err)
+	defer responder.Close()
+	assert.Nil(t, responder.ipv6)
+
+	// An AAAA query for a test name has no answer, since the server doesn't listen on IPv6
+	response := unpackDnsResponse(t, responder.answer(packDnsQuery(t, 1, "www.bettertls.test.", dnsmessage.TypeAAAA)))
+	assert.Equal(t, dnsmessage.RCodeSuccess, response.RCode)
+	assert.Empty(t, response.Answers)
+
+	_, err = newDnsResponder("192.0.2.1", 0, DefaultDnsZone, nil)
+	assert.Error(t, err)
+}
+
+func TestDnsResponderServesUdpAndTcp(t *testing.T) {
+	responder, err := newDnsResponder("127.0.0.1", 0, DefaultDnsZone, nil)
+	require.NoError(t, err)
+	defer responder.Close()
+	go responder.serveUdp()
+	go responder.serveTcp()
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(responder.Port()))
+
+	udpConn, err := net.Dial("udp", address)
+	require.NoError(t, err)
+	defer udpConn.Close()
+	_, err = udpConn.Write(packDnsQuery(t, 7, "www.bettertls.test.", dnsmessage.TypeA))
+	require.NoError(t, err)
+	buffer := make([]byte, 512)
+	n, err := udpConn.Read(buffer)
+	require.NoError(t, err)
+	response := unpackDnsResponse(t, buffer[:n])
+	assert.Equal(t, uint16(7), response.ID)
+	assert.Len(t, response.Answers, 1)
+
+	// Over TCP, messages are prefixed with their length, and a connection can be used for several queries
+	tcpConn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer tcpConn.Close()
+	for _, id := range []uint16{8, 9} {
+		query := packDnsQuery(t, id, "example.com.", dnsmessage.TypeA)
+		_, err = tcpConn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(query))), query...))
+		require.NoError(t, err)
+		var length [2]byte
+		_, err = io.ReadFull(tcpConn, length[:])
+		require.NoError(t, err)
+		packed := make([]byte, binary.BigEndian.Uint16(length[:]))
+		_, err = io.ReadFull(tcpConn, packed)
+		require.NoError(t, err)
+		response = unpackDnsResponse(t, packed)
+		assert.Equal(t, id, response.ID)
+		assert.Equal(t, dnsmessage.RCodeRefused, response.RCode)
+	}
+}
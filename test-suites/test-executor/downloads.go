@@ -0,0 +1,68 @@
+package test_executor
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"sort"
+
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+)
+
+// getTestDefinition describes a test case, like the get-test command.
+func getTestDefinition(provider test_case.TestCaseProvider, testIndex uint, testCase test_case.TestCase) ([]byte, error) {
+	var definition struct {
+		Suite            string                   `json:"suite"`
+		TestId           uint                     `json:"testId"`
+		Hostname         string                   `json:"hostname"`
+		UriIdentity      string                   `json:"uriIdentity,omitempty"`
+		ExpectedResult   test_case.ExpectedResult `json:"expectedResult"`
+		RequiredFeatures []string                 `json:"requiredFeatures"`
+		Definition       test_case.TestCase       `json:"definition"`
+	}
+	definition.Suite = provider.Name()
+	definition.TestId = testIndex
+	definition.Hostname = testCase.GetHostname()
+	definition.UriIdentity = test_case.GetUriIdentity(testCase)
+	definition.ExpectedResult = testCase.ExpectedResult()
+	definition.RequiredFeatures = make([]string, 0)
+	for _, feature := range testCase.RequiredFeatures() {
+		definition.RequiredFeatures = append(definition.RequiredFeatures, provider.DescribeFeature(feature))
+	}
+	definition.Definition = testCase
+	return json.MarshalIndent(&definition, "", "  ")
+}
+
+// writeTestBundle writes a zip file with everything needed to reproduce a test case outside of the server.
+func writeTestBundle(w io.Writer, definition []byte, artifacts *test_case.Artifacts) error {
+	files := map[string][]byte{
+		"definition.json":   definition,
+		"chain.pem":         artifacts.ChainPem(),
+		"leaf.pem":          artifacts.LeafPem(),
+		"trust_anchors.pem": artifacts.TrustAnchorsPem(),
+	}
+	if len(artifacts.Intermediates) > 0 {
+		files["intermediates.pem"] = artifacts.IntermediatesPem()
+	}
+	for path, resource := range artifacts.AiaResources {
+		files["aia/"+path] = resource.Body
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	zipWriter := zip.NewWriter(w)
+	for _, name := range names {
+		f, err := zipWriter.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err = f.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	return zipWriter.Close()
+}
@@ -0,0 +1,102 @@
+package test_executor
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"testing"
+
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetTestDefinition(t *testing.T) {
+	suites, err := BuildTestSuites()
+	require.NoError(t, err)
+
+	provider := suites.GetProvider("spiffe")
+	require.NotNil(t, provider)
+	testCase, err := provider.GetTestCase(0)
+	require.NoError(t, err)
+	data, err := getTestDefinition(provider, 0, testCase)
+	require.NoError(t, err)
+
+	var definition map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &definition))
+	assert.Equal(t, "spiffe", definition["suite"])
+	assert.Equal(t, float64(0), definition["testId"])
+	assert.Equal(t, testCase.GetHostname(), definition["hostname"])
+	assert.Equal(t, test_case.GetUriIdentity(testCase), definition["uriIdentity"])
+	assert.Contains(t, definition, "expectedResult")
+	assert.NotNil(t, definition["requiredFeatures"])
+	assert.NotNil(t, definition["definition"])
+
+	// Suites verified by hostname leave out uriIdentity
+	provider = suites.GetProvider("pathbuilding")
+	testCase, err = provider.GetTestCase(0)
+	require.NoError(t, err)
+	data, err = getTestDefinition(provider, 0, testCase)
+	require.NoError(t, err)
+	definition = nil
+	require.NoError(t, json.Unmarshal(data, &definition))
+	assert.NotContains(t, definition, "uriIdentity")
+	assert.Equal(t, []interface{}{}, definition["requiredFeatures"])
+}
+
+// readTestBundle reads every file in a bundle, in the order they were written.
+func readTestBundle(t *testing.T, bundle []byte) ([]string, map[string][]byte) {
+	reader, err := zip.NewReader(bytes.NewReader(bundle), int64(len(bundle)))
+	require.NoError(t, err)
+	var names []string
+	files := make(map[string][]byte)
+	for _, f := range reader.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		contents, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		names = append(names, f.Name)
+		files[f.Name] = contents
+	}
+	return names, files
+}
+
+func TestWriteTestBundle(t *testing.T) {
+	suites, err := BuildTestSuites()
+	require.NoError(t, err)
+	provider := suites.GetProvider("pathbuilding")
+	testCase, err := provider.GetTestCase(0)
+	require.NoError(t, err)
+	artifacts, err := suites.GetTestCaseArtifacts(testCase, test_case.DEFAULT_AIA_BASE_URL)
+	require.NoError(t, err)
+
+	var bundle bytes.Buffer
+	require.NoError(t, writeTestBundle(&bundle, []byte("{}"), artifacts))
+	names, files := readTestBundle(t, bundle.Bytes())
+	assert.Equal(t, []string{"chain.pem", "definition.json", "leaf.pem", "trust_anchors.pem"}, names)
+	assert.Equal(t, "{}", string(files["definition.json"]))
+	assert.Equal(t, artifacts.ChainPem(), files["chain.pem"])
+	assert.Equal(t, artifacts.LeafPem(), files["leaf.pem"])
+	assert.Equal(t, artifacts.TrustAnchorsPem(), files["trust_anchors.pem"])
+
+	// Out-of-band intermediates and AIA resources are included when the test case has them
+	artifacts = &test_case.Artifacts{
+		Certificate:   artifacts.Certificate,
+		TrustAnchors:  artifacts.TrustAnchors,
+		Intermediates: []*x509.Certificate{suites.GetRootCert()},
+		AiaResources: map[string]*test_case.AiaResource{
+			"b/ica.der": {ContentType: "application/pkix-cert", Body: []byte{1}},
+			"a/ica.p7c": {ContentType: "application/pkcs7-mime", Body: []byte{2}},
+		},
+	}
+	bundle.Reset()
+	require.NoError(t, writeTestBundle(&bundle, []byte("{}"), artifacts))
+	names, files = readTestBundle(t, bundle.Bytes())
+	assert.Equal(t, []string{"aia/a/ica.p7c", "aia/b/ica.der", "chain.pem", "definition.json", "intermediates.pem", "leaf.pem", "trust_anchors.pem"}, names)
+	assert.Equal(t, artifacts.IntermediatesPem(), files["intermediates.pem"])
+	assert.Equal(t, []byte{1}, files["aia/b/ica.der"])
+	assert.Equal(t, []byte{2}, files["aia/a/ica.p7c"])
+}
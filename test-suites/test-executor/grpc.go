@@ -0,0 +1,24 @@
+package test_executor
+
+import (
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// newGrpcHandler serves the gRPC health service (grpc.health.v1.Health), which always reports SERVING, and passes
+// every other request to next. gRPC needs HTTP/2, so this only does anything for clients that negotiated "h2".
+func newGrpcHandler(next http.Handler) http.Handler {
+	grpcServer := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, health.NewServer())
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.ProtoMajor == 2 && strings.HasPrefix(request.Header.Get("Content-Type"), "application/grpc") {
+			grpcServer.ServeHTTP(writer, request)
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
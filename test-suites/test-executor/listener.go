@@ -0,0 +1,107 @@
+package test_executor
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// listenTcp listens on the given address and port. Test cases with IPv6 hostnames connect to the IPv6 loopback
+// address, so when the address is an IPv4 address the listener also accepts connections on [::1], on the same port. If
+// the host has no IPv6 loopback, only the IPv4 address is listened on.
+func listenTcp(bindAddress string, port uint16) (net.Listener, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(bindAddress, strconv.Itoa(int(port))))
+	if err != nil {
+		return nil, err
+	}
+	bindIp := net.ParseIP(bindAddress)
+	if bindIp == nil || bindIp.To4() == nil {
+		return listener, nil
+	}
+	ipv6Listener, err := net.Listen("tcp", net.JoinHostPort(net.IPv6loopback.String(), strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)))
+	if err != nil {
+		return listener, nil
+	}
+	return newPairedListener(listener, ipv6Listener), nil
+}
+
+// listenUdp is like listenTcp, for UDP. It returns both sockets when it also listens on [::1].
+func listenUdp(bindAddress string, port uint16) ([]net.PacketConn, error) {
+	conn, err := net.ListenPacket("udp", net.JoinHostPort(bindAddress, strconv.Itoa(int(port))))
+	if err != nil {
+		return nil, err
+	}
+	bindIp := net.ParseIP(bindAddress)
+	if bindIp == nil || bindIp.To4() == nil {
+		return []net.PacketConn{conn}, nil
+	}
+	ipv6Conn, err := net.ListenPacket("udp", net.JoinHostPort(net.IPv6loopback.String(), strconv.Itoa(conn.LocalAddr().(*net.UDPAddr).Port)))
+	if err != nil {
+		return []net.PacketConn{conn}, nil
+	}
+	return []net.PacketConn{conn, ipv6Conn}, nil
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// A pairedListener accepts connections from two listeners. Its address is the first listener's.
+type pairedListener struct {
+	net.Listener
+	other     net.Listener
+	accepted  chan acceptResult
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newPairedListener(first net.Listener, second net.Listener) *pairedListener {
+	l := &pairedListener{
+		Listener: first,
+		other:    second,
+		accepted: make(chan acceptResult),
+		closed:   make(chan struct{}),
+	}
+	go l.acceptFrom(first)
+	go l.acceptFrom(second)
+	return l
+}
+
+func (l *pairedListener) acceptFrom(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		select {
+		case l.accepted <- acceptResult{conn, err}:
+		case <-l.closed:
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+	}
+}
+
+func (l *pairedListener) Accept() (net.Conn, error) {
+	select {
+	case result := <-l.accepted:
+		return result.conn, result.err
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pairedListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	err := l.Listener.Close()
+	if otherErr := l.other.Close(); err == nil {
+		err = otherErr
+	}
+	return err
+}
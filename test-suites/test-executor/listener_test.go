@@ -0,0 +1,34 @@
+package test_executor
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenTcpAlsoListensOnIpv6Loopback(t *testing.T) {
+	listener, err := listenTcp("127.0.0.1", 0)
+	require.NoError(t, err)
+	defer listener.Close()
+	if _, ok := listener.(*pairedListener); !ok {
+		t.Skip("no IPv6 loopback")
+	}
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+
+	for _, host := range []string{"127.0.0.1", "::1"} {
+		client, err := net.Dial("tcp", net.JoinHostPort(host, port))
+		require.NoError(t, err)
+		conn, err := listener.Accept()
+		require.NoError(t, err)
+		assert.Equal(t, client.LocalAddr().String(), conn.RemoteAddr().String())
+		conn.Close()
+		client.Close()
+	}
+
+	require.NoError(t, listener.Close())
+	_, err = listener.Accept()
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
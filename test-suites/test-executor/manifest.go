@@ -0,0 +1,53 @@
+package test_executor
+
+import (
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+)
+
+// A Manifest holds the expected result of every test case, which results files are interpreted against.
+type Manifest struct {
+	BetterTlsRevision string                    `json:"betterTlsRevision"`
+	SuiteManifests    map[string]*SuiteManifest `json:"suiteManifests"`
+}
+
+type SuiteManifest struct {
+	Features        map[test_case.Feature]string `json:"features"`
+	ExpectedResults []test_case.ExpectedResult   `json:"expectedResults"`
+}
+
+func getSuiteManifest(provider test_case.TestCaseProvider) (*SuiteManifest, error) {
+	manifest := &SuiteManifest{
+		Features: make(map[test_case.Feature]string),
+	}
+	for _, feature := range provider.GetFeatures() {
+		manifest.Features[feature] = provider.DescribeFeature(feature)
+	}
+	testCaseCount, err := provider.GetTestCaseCount()
+	if err != nil {
+		return nil, err
+	}
+	for idx := uint(0); idx < testCaseCount; idx++ {
+		testCase, err := provider.GetTestCase(idx)
+		if err != nil {
+			return nil, err
+		}
+		manifest.ExpectedResults = append(manifest.ExpectedResults, testCase.ExpectedResult())
+	}
+	return manifest, nil
+}
+
+func (ts *TestSuites) BuildManifest() (*Manifest, error) {
+	manifest := &Manifest{
+		BetterTlsRevision: GetBuildRevision(),
+		SuiteManifests:    make(map[string]*SuiteManifest),
+	}
+	for _, suiteName := range ts.GetProviderNames() {
+		provider := ts.GetProvider(suiteName)
+		suiteManifest, err := getSuiteManifest(provider)
+		if err != nil {
+			return nil, err
+		}
+		manifest.SuiteManifests[suiteName] = suiteManifest
+	}
+	return manifest, nil
+}
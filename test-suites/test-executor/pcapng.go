@@ -0,0 +1,241 @@
+package test_executor
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+)
+
+// Captures only have the bytes each TCP connection carried, so writePcapng makes up IP and TCP headers for them from
+// the connections' addresses. Only TCP is captured; there is nothing to write for QUIC. Wireshark dissects the result like a capture from the wire, and decrypts it with the
+// secrets embedded in the file.
+
+const (
+	pcapngSectionHeaderBlock     = 0x0A0D0D0A
+	pcapngInterfaceBlock         = 0x00000001
+	pcapngEnhancedPacketBlock    = 0x00000006
+	pcapngDecryptionSecretsBlock = 0x0000000A
+	pcapngByteOrderMagic         = 0x1A2B3C4D
+	// Packets start with an IPv4 or IPv6 header
+	pcapngLinkTypeRaw = 101
+	// The secrets are in the NSS key log format
+	pcapngTlsKeyLog = 0x544c534b
+
+	tcpFin = 0x01
+	tcpSyn = 0x02
+	tcpPsh = 0x08
+	tcpAck = 0x10
+	// Data is split into segments of at most this many bytes
+	tcpMaxSegment = 16384
+)
+
+var pcapngByteOrder = binary.LittleEndian
+
+// writePcapngBlock writes a block with the given body, padded to a multiple of four bytes.
+func writePcapngBlock(w io.Writer, blockType uint32, body []byte) error {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	length := uint32(12 + len(body))
+	block := pcapngByteOrder.AppendUint32(nil, blockType)
+	block = pcapngByteOrder.AppendUint32(block, length)
+	block = append(block, body...)
+	block = pcapngByteOrder.AppendUint32(block, length)
+	_, err := w.Write(block)
+	return err
+}
+
+// writePcapng writes the traffic of the given TCP connections, and the TLS secrets for it, as a pcapng file.
+// Connections that don't have TCP addresses are left out.
+func writePcapng(w io.Writer, conns []*recordedConn, keyLog []byte) error {
+	sectionHeader := pcapngByteOrder.AppendUint32(nil, pcapngByteOrderMagic)
+	sectionHeader = pcapngByteOrder.AppendUint16(sectionHeader, 1)
+	sectionHeader = pcapngByteOrder.AppendUint16(sectionHeader, 0)
+	// The section length isn't specified
+	sectionHeader = pcapngByteOrder.AppendUint64(sectionHeader, 0xFFFFFFFFFFFFFFFF)
+	if err := writePcapngBlock(w, pcapngSectionHeaderBlock, sectionHeader); err != nil {
+		return err
+	}
+
+	// Microsecond timestamps and no snapshot length limit are the defaults
+	interfaceBody := pcapngByteOrder.AppendUint16(nil, pcapngLinkTypeRaw)
+	interfaceBody = pcapngByteOrder.AppendUint16(interfaceBody, 0)
+	interfaceBody = pcapngByteOrder.AppendUint32(interfaceBody, 0)
+	if err := writePcapngBlock(w, pcapngInterfaceBlock, interfaceBody); err != nil {
+		return err
+	}
+
+	if len(keyLog) > 0 {
+		secretsBody := pcapngByteOrder.AppendUint32(nil, pcapngTlsKeyLog)
+		secretsBody = pcapngByteOrder.AppendUint32(secretsBody, uint32(len(keyLog)))
+		secretsBody = append(secretsBody, keyLog...)
+		if err := writePcapngBlock(w, pcapngDecryptionSecretsBlock, secretsBody); err != nil {
+			return err
+		}
+	}
+
+	for _, conn := range conns {
+		stream := newTcpStream(conn)
+		if stream == nil {
+			continue
+		}
+		for _, packet := range stream.packets(conn) {
+			if err := writePcapngPacket(w, packet.time, packet.data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writePcapngPacket(w io.Writer, timestamp time.Time, packet []byte) error {
+	micros := uint64(timestamp.UnixMicro())
+	body := pcapngByteOrder.AppendUint32(nil, 0)
+	body = pcapngByteOrder.AppendUint32(body, uint32(micros>>32))
+	body = pcapngByteOrder.AppendUint32(body, uint32(micros))
+	body = pcapngByteOrder.AppendUint32(body, uint32(len(packet)))
+	body = pcapngByteOrder.AppendUint32(body, uint32(len(packet)))
+	body = append(body, packet...)
+	return writePcapngBlock(w, pcapngEnhancedPacketBlock, body)
+}
+
+type capturedPacket struct {
+	time time.Time
+	data []byte
+}
+
+// A tcpStream tracks the sequence numbers of both directions of a made-up TCP connection.
+type tcpStream struct {
+	clientIp, serverIp     net.IP
+	clientPort, serverPort uint16
+	clientSeq, serverSeq   uint32
+}
+
+// newTcpStream returns nil if the connection's addresses aren't TCP addresses.
+func newTcpStream(conn *recordedConn) *tcpStream {
+	client, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return nil
+	}
+	server, ok := conn.LocalAddr().(*net.TCPAddr)
+	if !ok {
+		return nil
+	}
+	stream := &tcpStream{
+		clientIp:   client.IP.To16(),
+		serverIp:   server.IP.To16(),
+		clientPort: uint16(client.Port),
+		serverPort: uint16(server.Port),
+	}
+	if client.IP.To4() != nil && server.IP.To4() != nil {
+		stream.clientIp, stream.serverIp = client.IP.To4(), server.IP.To4()
+	}
+	return stream
+}
+
+// packets builds the handshake of the TCP connection followed by a packet for each segment of the recorded traffic.
+func (s *tcpStream) packets(conn *recordedConn) []capturedPacket {
+	packets := []capturedPacket{
+		{conn.start, s.packet(true, tcpSyn, nil)},
+	}
+	s.clientSeq++
+	packets = append(packets, capturedPacket{conn.start, s.packet(false, tcpSyn|tcpAck, nil)})
+	s.serverSeq++
+	packets = append(packets, capturedPacket{conn.start, s.packet(true, tcpAck, nil)})
+
+	for _, segment := range conn.segments {
+		if segment.fin {
+			packets = append(packets, capturedPacket{segment.time, s.packet(segment.fromClient, tcpFin|tcpAck, nil)})
+			s.advance(segment.fromClient, 1)
+			continue
+		}
+		for data := segment.data; len(data) > 0; {
+			n := min(len(data), tcpMaxSegment)
+			packets = append(packets, capturedPacket{segment.time, s.packet(segment.fromClient, tcpPsh|tcpAck, data[:n])})
+			s.advance(segment.fromClient, n)
+			data = data[n:]
+		}
+	}
+	return packets
+}
+
+func (s *tcpStream) advance(fromClient bool, n int) {
+	if fromClient {
+		s.clientSeq += uint32(n)
+	} else {
+		s.serverSeq += uint32(n)
+	}
+}
+
+// packet builds an IP packet holding a TCP segment in one direction of the stream.
+func (s *tcpStream) packet(fromClient bool, flags byte, payload []byte) []byte {
+	srcIp, dstIp := s.serverIp, s.clientIp
+	srcPort, dstPort := s.serverPort, s.clientPort
+	seq, ack := s.serverSeq, s.clientSeq
+	if fromClient {
+		srcIp, dstIp = s.clientIp, s.serverIp
+		srcPort, dstPort = s.clientPort, s.serverPort
+		seq, ack = s.clientSeq, s.serverSeq
+	}
+	if flags&tcpAck == 0 {
+		ack = 0
+	}
+
+	segment := binary.BigEndian.AppendUint16(nil, srcPort)
+	segment = binary.BigEndian.AppendUint16(segment, dstPort)
+	segment = binary.BigEndian.AppendUint32(segment, seq)
+	segment = binary.BigEndian.AppendUint32(segment, ack)
+	// A 20 byte header, without options
+	segment = append(segment, 5<<4, flags)
+	segment = binary.BigEndian.AppendUint16(segment, 0xFFFF)
+	// The checksum, filled in below, and the urgent pointer
+	segment = append(segment, 0, 0, 0, 0)
+	segment = append(segment, payload...)
+
+	var pseudoHeader []byte
+	pseudoHeader = append(pseudoHeader, srcIp...)
+	pseudoHeader = append(pseudoHeader, dstIp...)
+	if len(srcIp) == net.IPv4len {
+		pseudoHeader = append(pseudoHeader, 0, 6)
+		pseudoHeader = binary.BigEndian.AppendUint16(pseudoHeader, uint16(len(segment)))
+	} else {
+		pseudoHeader = binary.BigEndian.AppendUint32(pseudoHeader, uint32(len(segment)))
+		pseudoHeader = append(pseudoHeader, 0, 0, 0, 6)
+	}
+	binary.BigEndian.PutUint16(segment[16:], internetChecksum(append(pseudoHeader, segment...)))
+
+	var header []byte
+	if len(srcIp) == net.IPv4len {
+		header = append(header, 0x45, 0)
+		header = binary.BigEndian.AppendUint16(header, uint16(20+len(segment)))
+		// No identification, and don't fragment
+		header = append(header, 0, 0, 0x40, 0)
+		header = append(header, 64, 6, 0, 0)
+		header = append(header, srcIp...)
+		header = append(header, dstIp...)
+		binary.BigEndian.PutUint16(header[10:], internetChecksum(header))
+	} else {
+		header = append(header, 0x60, 0, 0, 0)
+		header = binary.BigEndian.AppendUint16(header, uint16(len(segment)))
+		header = append(header, 6, 64)
+		header = append(header, srcIp...)
+		header = append(header, dstIp...)
+	}
+	return append(header, segment...)
+}
+
+// internetChecksum computes the checksum used by IP and TCP headers (RFC 1071).
+func internetChecksum(data []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum > 0xFFFF {
+		sum = (sum >> 16) + (sum & 0xFFFF)
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,218 @@
+package test_executor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addrConn is a connection with the given addresses, for building recordedConns.
+type addrConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c *addrConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *addrConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+type pcapngBlock struct {
+	blockType uint32
+	body      []byte
+}
+
+// parsePcapngBlocks splits a capture into its blocks, checking that each block's lengths agree and that it's padded to
+// a multiple of four bytes.
+func parsePcapngBlocks(t *testing.T, data []byte) []pcapngBlock {
+	var blocks []pcapngBlock
+	for len(data) > 0 {
+		require.GreaterOrEqual(t, len(data), 12)
+		blockType := pcapngByteOrder.Uint32(data)
+		length := int(pcapngByteOrder.Uint32(data[4:]))
+		require.Zero(t, length%4, "block length %d isn't padded", length)
+		require.GreaterOrEqual(t, length, 12)
+		require.LessOrEqual(t, length, len(data))
+		assert.Equal(t, uint32(length), pcapngByteOrder.Uint32(data[length-4:]), "trailing block length")
+		blocks = append(blocks, pcapngBlock{blockType, data[8 : length-4]})
+		data = data[length:]
+	}
+	return blocks
+}
+
+// checkPadding checks that a block's body is body followed by zeros up to a multiple of four bytes.
+func checkPadding(t *testing.T, block []byte, body []byte) {
+	require.Len(t, block, (len(body)+3)/4*4)
+	assert.Equal(t, body, block[:len(body)])
+	assert.Equal(t, make([]byte, len(block)-len(body)), block[len(body):])
+}
+
+type parsedTcpPacket struct {
+	srcPort, dstPort uint16
+	seq, ack         uint32
+	flags            byte
+	payload          []byte
+}
+
+// parseTcpPacket parses an IPv4 or IPv6 packet holding a TCP segment, checking its checksums.
+func parseTcpPacket(t *testing.T, packet []byte) parsedTcpPacket {
+	var srcIp, dstIp, segment []byte
+	switch packet[0] >> 4 {
+	case 4:
+		require.GreaterOrEqual(t, len(packet), 20)
+		assert.Equal(t, uint16(len(packet)), binary.BigEndian.Uint16(packet[2:]))
+		assert.Equal(t, byte(6), packet[9])
+		assert.Zero(t, internetChecksum(packet[:20]), "IPv4 header checksum")
+		srcIp, dstIp, segment = packet[12:16], packet[16:20], packet[20:]
+	case 6:
+		require.GreaterOrEqual(t, len(packet), 40)
+		assert.Equal(t, uint16(len(packet)-40), binary.BigEndian.Uint16(packet[4:]))
+		assert.Equal(t, byte(6), packet[6])
+		srcIp, dstIp, segment = packet[8:24], packet[24:40], packet[40:]
+	default:
+		require.Fail(t, "not an IP packet")
+	}
+	require.GreaterOrEqual(t, len(segment), 20)
+
+	var pseudoHeader []byte
+	pseudoHeader = append(pseudoHeader, srcIp...)
+	pseudoHeader = append(pseudoHeader, dstIp...)
+	if len(srcIp) == net.IPv4len {
+		pseudoHeader = append(pseudoHeader, 0, 6)
+		pseudoHeader = binary.BigEndian.AppendUint16(pseudoHeader, uint16(len(segment)))
+	} else {
+		pseudoHeader = binary.BigEndian.AppendUint32(pseudoHeader, uint32(len(segment)))
+		pseudoHeader = append(pseudoHeader, 0, 0, 0, 6)
+	}
+	assert.Zero(t, internetChecksum(append(pseudoHeader, segment...)), "TCP checksum")
+
+	return parsedTcpPacket{
+		srcPort: binary.BigEndian.Uint16(segment),
+		dstPort: binary.BigEndian.Uint16(segment[2:]),
+		seq:     binary.BigEndian.Uint32(segment[4:]),
+		ack:     binary.BigEndian.Uint32(segment[8:]),
+		flags:   segment[13],
+		payload: segment[20:],
+	}
+}
+
+func TestWritePcapng(t *testing.T) {
+	start := time.Unix(1700000000, 123456000)
+	clientHello := bytes.Repeat([]byte{0x16}, 300)
+	// Larger than a single TCP segment
+	serverFlight := bytes.Repeat([]byte{0x17}, tcpMaxSegment+10)
+	ipv4Conn := &recordedConn{
+		Conn: &addrConn{
+			local:  &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8443},
+			remote: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50000},
+		},
+		start: start,
+		segments: []recordedSegment{
+			{fromClient: true, time: start.Add(time.Millisecond), data: clientHello},
+			{fromClient: false, time: start.Add(2 * time.Millisecond), data: serverFlight},
+			{fromClient: true, time: start.Add(3 * time.Millisecond), fin: true},
+			{fromClient: false, time: start.Add(3 * time.Millisecond), fin: true},
+		},
+	}
+	ipv6Conn := &recordedConn{
+		Conn: &addrConn{
+			local:  &net.TCPAddr{IP: net.IPv6loopback, Port: 8443},
+			remote: &net.TCPAddr{IP: net.IPv6loopback, Port: 50001},
+		},
+		start:    start,
+		segments: []recordedSegment{{fromClient: true, time: start, data: []byte("abc")}},
+	}
+	otherConn := &recordedConn{Conn: &addrConn{local: &net.UDPAddr{}, remote: &net.UDPAddr{}}, start: start}
+	// An odd length, so the secrets need padding
+	keyLog := []byte("CLIENT_RANDOM 00 11\n")
+
+	var capture bytes.Buffer
+	require.NoError(t, writePcapng(&capture, []*recordedConn{ipv4Conn, otherConn, ipv6Conn}, keyLog))
+	blocks := parsePcapngBlocks(t, capture.Bytes())
+	require.GreaterOrEqual(t, len(blocks), 3)
+
+	sectionHeader := blocks[0]
+	assert.Equal(t, uint32(pcapngSectionHeaderBlock), sectionHeader.blockType)
+	require.Len(t, sectionHeader.body, 16)
+	assert.Equal(t, uint32(pcapngByteOrderMagic), pcapngByteOrder.Uint32(sectionHeader.body))
+	assert.Equal(t, uint16(1), pcapngByteOrder.Uint16(sectionHeader.body[4:]))
+	assert.Equal(t, uint16(0), pcapngByteOrder.Uint16(sectionHeader.body[6:]))
+	assert.Equal(t, uint64(0xFFFFFFFFFFFFFFFF), pcapngByteOrder.Uint64(sectionHeader.body[8:]))
+
+	interfaceBlock := blocks[1]
+	assert.Equal(t, uint32(pcapngInterfaceBlock), interfaceBlock.blockType)
+	require.Len(t, interfaceBlock.body, 8)
+	assert.Equal(t, uint16(pcapngLinkTypeRaw), pcapngByteOrder.Uint16(interfaceBlock.body))
+	assert.Equal(t, uint32(0), pcapngByteOrder.Uint32(interfaceBlock.body[4:]))
+
+	secrets := blocks[2]
+	assert.Equal(t, uint32(pcapngDecryptionSecretsBlock), secrets.blockType)
+	require.GreaterOrEqual(t, len(secrets.body), 8)
+	assert.Equal(t, uint32(pcapngTlsKeyLog), pcapngByteOrder.Uint32(secrets.body))
+	assert.Equal(t, uint32(len(keyLog)), pcapngByteOrder.Uint32(secrets.body[4:]))
+	checkPadding(t, secrets.body[8:], keyLog)
+
+	var packets []parsedTcpPacket
+	for _, block := range blocks[3:] {
+		require.Equal(t, uint32(pcapngEnhancedPacketBlock), block.blockType)
+		require.GreaterOrEqual(t, len(block.body), 20)
+		assert.Equal(t, uint32(0), pcapngByteOrder.Uint32(block.body), "interface ID")
+		micros := uint64(pcapngByteOrder.Uint32(block.body[4:]))<<32 | uint64(pcapngByteOrder.Uint32(block.body[8:]))
+		assert.GreaterOrEqual(t, micros, uint64(start.UnixMicro()))
+		capturedLength := int(pcapngByteOrder.Uint32(block.body[12:]))
+		assert.Equal(t, uint32(capturedLength), pcapngByteOrder.Uint32(block.body[16:]), "original length")
+		require.GreaterOrEqual(t, len(block.body)-20, capturedLength)
+		packet := block.body[20 : 20+capturedLength]
+		checkPadding(t, block.body[20:], packet)
+		packets = append(packets, parseTcpPacket(t, packet))
+	}
+
+	// The IPv4 connection: a handshake, the client's data, the server's data in two segments and both FINs. Then the
+	// IPv6 connection's handshake and data. The UDP connection is left out.
+	require.Len(t, packets, 12)
+	assert.Equal(t, byte(tcpSyn), packets[0].flags)
+	assert.Equal(t, uint16(50000), packets[0].srcPort)
+	assert.Equal(t, uint16(8443), packets[0].dstPort)
+	assert.Equal(t, byte(tcpSyn|tcpAck), packets[1].flags)
+	assert.Equal(t, packets[0].seq+1, packets[1].ack)
+	assert.Equal(t, byte(tcpAck), packets[2].flags)
+	assert.Equal(t, clientHello, packets[3].payload)
+	assert.Equal(t, packets[1].seq+1, packets[3].ack)
+	assert.Equal(t, uint16(8443), packets[4].srcPort)
+	assert.Equal(t, serverFlight, append(append([]byte(nil), packets[4].payload...), packets[5].payload...))
+	assert.Len(t, packets[4].payload, tcpMaxSegment)
+	assert.Equal(t, packets[4].seq+tcpMaxSegment, packets[5].seq)
+	assert.Equal(t, packets[3].seq+uint32(len(clientHello)), packets[4].ack)
+	assert.Equal(t, byte(tcpFin|tcpAck), packets[6].flags)
+	assert.Equal(t, uint16(50000), packets[6].srcPort)
+	assert.Equal(t, byte(tcpFin|tcpAck), packets[7].flags)
+	assert.Equal(t, packets[5].seq+10, packets[7].seq)
+	assert.Equal(t, packets[6].seq+1, packets[7].ack)
+
+	assert.Equal(t, uint16(50001), packets[8].srcPort)
+	assert.Equal(t, []byte("abc"), packets[11].payload)
+}
+
+func TestWritePcapngWithoutSecrets(t *testing.T) {
+	var capture bytes.Buffer
+	require.NoError(t, writePcapng(&capture, nil, nil))
+	blocks := parsePcapngBlocks(t, capture.Bytes())
+	require.Len(t, blocks, 2)
+	assert.Equal(t, uint32(pcapngSectionHeaderBlock), blocks[0].blockType)
+	assert.Equal(t, uint32(pcapngInterfaceBlock), blocks[1].blockType)
+}
+
+func TestInternetChecksum(t *testing.T) {
+	// The example from RFC 1071 section 3
+	assert.Equal(t, ^uint16(0xddf2), internetChecksum([]byte{0x00, 0x01, 0xf2, 0x03, 0xf4, 0xf5, 0xf6, 0xf7}))
+	// An odd length is padded with a zero byte
+	assert.Equal(t, internetChecksum([]byte{0x01, 0x02, 0x03, 0x00}), internetChecksum([]byte{0x01, 0x02, 0x03}))
+}
@@ -0,0 +1,45 @@
+package test_executor
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// newConnectProxy makes the plaintext listener an HTTP CONNECT proxy, which tunnels every connection to the TLS
+// listener whatever host it asks for. The client then sees the current test's certificates under any hostname, without
+// the hostname having to resolve to the server. Other requests are passed to next. Tunneled traffic is recorded if
+// recorder is set.
+func newConnectProxy(next http.Handler, tlsListener *telemetryListener, recorder *trafficRecorder) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodConnect || request.TLS != nil {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		hijacker, ok := writer.(http.Hijacker)
+		if !ok {
+			http.Error(writer, "CONNECT is only supported over HTTP/1.1", http.StatusHTTPVersionNotSupported)
+			return
+		}
+		conn, buffered, err := hijacker.Hijack()
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// The HTTP server may have set a deadline for reading the request
+		conn.SetDeadline(time.Time{})
+		_, err = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		if err != nil {
+			conn.Close()
+			return
+		}
+		// The client may have sent the start of its handshake without waiting for the response
+		var tunnel net.Conn = &bufferedConn{Conn: conn, reader: buffered.Reader}
+		if recorder != nil {
+			tunnel = recorder.wrap(tunnel)
+		}
+		tlsListener.handshake(tunnel, func(telemetry *HandshakeTelemetry) {
+			telemetry.ProxyTarget = request.Host
+		})
+	})
+}
@@ -0,0 +1,114 @@
+package test_executor
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startProxyTestServer(t *testing.T) *Server {
+	suites, err := BuildTestSuites()
+	require.NoError(t, err)
+	server, err := StartServerWithOptions(context.Background(), suites, &ServerOptions{BindAddress: "127.0.0.1"})
+	require.NoError(t, err)
+	t.Cleanup(server.Stop)
+	server.SetTest("pathbuilding", 0)
+	return server
+}
+
+func TestConnectProxyTunnelsAnyHostname(t *testing.T) {
+	server := startProxyTestServer(t)
+	proxyUrl, err := url.Parse(server.ProxyUrl())
+	require.NoError(t, err)
+
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyUrl),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	defer client.CloseIdleConnections()
+	response, err := client.Get("https://bettertls.example/ok")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "OK", string(body))
+
+	// The client was given the current test's certificate
+	artifacts, err := server.getArtifacts()
+	require.NoError(t, err)
+	require.NotEmpty(t, response.TLS.PeerCertificates)
+	assert.Equal(t, artifacts.Certificate.Certificate[0], response.TLS.PeerCertificates[0].Raw)
+
+	telemetry := server.Telemetry()
+	require.Len(t, telemetry, 1)
+	assert.True(t, telemetry[0].HandshakeComplete)
+	assert.Equal(t, "bettertls.example:443", telemetry[0].ProxyTarget)
+	assert.Equal(t, "bettertls.example", telemetry[0].ServerName)
+}
+
+// connectResponseConn reads the proxy's response to CONNECT before anything else is read from the connection, so a
+// client can start its TLS handshake without waiting for it.
+type connectResponseConn struct {
+	net.Conn
+	reader   *bufio.Reader
+	response *http.Response
+	err      error
+}
+
+func (c *connectResponseConn) Read(b []byte) (int, error) {
+	if c.response == nil && c.err == nil {
+		c.response, c.err = http.ReadResponse(c.reader, nil)
+	}
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func TestConnectProxyKeepsDataSentBeforeResponse(t *testing.T) {
+	server := startProxyTestServer(t)
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", server.PlaintextPort()))
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("CONNECT test.example.co.uk:8443 HTTP/1.1\r\nHost: test.example.co.uk:8443\r\n\r\n"))
+	require.NoError(t, err)
+	tunnel := &connectResponseConn{Conn: conn, reader: bufio.NewReader(conn)}
+	tlsConn := tls.Client(tunnel, &tls.Config{ServerName: "test.example.co.uk", InsecureSkipVerify: true})
+	require.NoError(t, tlsConn.Handshake())
+	assert.Equal(t, http.StatusOK, tunnel.response.StatusCode)
+
+	request, err := http.NewRequest(http.MethodGet, "https://test.example.co.uk:8443/ok", nil)
+	require.NoError(t, err)
+	require.NoError(t, request.Write(tlsConn))
+	response, err := http.ReadResponse(bufio.NewReader(tlsConn), request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "OK", string(body))
+
+	telemetry := server.Telemetry()
+	require.Len(t, telemetry, 1)
+	assert.Equal(t, "test.example.co.uk:8443", telemetry[0].ProxyTarget)
+}
+
+func TestConnectProxyPassesOtherRequests(t *testing.T) {
+	server := startProxyTestServer(t)
+
+	response, err := http.Get(server.ProxyUrl() + "/root.pem")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Empty(t, server.Telemetry())
+}
@@ -0,0 +1,160 @@
+package test_executor
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// A quicServer serves HTTP/3 with the test's certificates, recording each QUIC handshake like the TLS listener does.
+type quicServer struct {
+	transports []*quic.Transport
+	listeners  []*quic.Listener
+	server     *http3.Server
+}
+
+type quicHandshakeKey struct{}
+
+// A quicHandshake is the telemetry of a QUIC connection's handshake, kept in the connection's context. It finishes
+// either when the connection is accepted or when it closes, whichever comes first.
+type quicHandshake struct {
+	handshaker *handshaker
+	telemetry  *HandshakeTelemetry
+	once       sync.Once
+}
+
+func getQuicHandshake(ctx context.Context) *quicHandshake {
+	if ctx == nil {
+		return nil
+	}
+	handshake, _ := ctx.Value(quicHandshakeKey{}).(*quicHandshake)
+	return handshake
+}
+
+func (h *quicHandshake) finish(err error) {
+	h.once.Do(func() {
+		if err != nil {
+			// Clients abort a handshake by closing the connection with a CRYPTO_ERROR, which is 0x100 plus the alert
+			var transportErr *quic.TransportError
+			if errors.As(err, &transportErr) && transportErr.Remote && transportErr.ErrorCode.IsCryptoError() {
+				alert := TlsAlert(transportErr.ErrorCode - 0x100)
+				h.telemetry.ClientAlert = &alert
+			}
+			h.telemetry.Error = err.Error()
+		} else {
+			h.telemetry.HandshakeComplete = true
+		}
+		h.handshaker.onHandshake(h.telemetry)
+	})
+}
+
+// newQuicServer starts serving HTTP/3 on UDP sockets, using the handshaker's TLS config and callbacks. Call serve to
+// start accepting connections.
+func newQuicServer(conns []net.PacketConn, handshaker *handshaker, handler http.Handler) (*quicServer, error) {
+	server := &quicServer{server: &http3.Server{Handler: handler}}
+	// Every test's config offers HTTP/3, which clients require
+	config := http3.ConfigureTLSConfig(quicTlsConfig(handshaker.config))
+	for _, conn := range conns {
+		transport := &quic.Transport{
+			Conn: conn,
+			ConnContext: func(ctx context.Context, info *quic.ClientInfo) (context.Context, error) {
+				handshake := &quicHandshake{handshaker: handshaker, telemetry: handshaker.onConnect(info.RemoteAddr)}
+				handshake.telemetry.Quic = true
+				// The context is canceled, with the reason as its cause, when the connection closes. If that happens
+				// before the connection is accepted, the handshake failed.
+				context.AfterFunc(ctx, func() {
+					handshake.finish(context.Cause(ctx))
+				})
+				return context.WithValue(ctx, quicHandshakeKey{}, handshake), nil
+			},
+		}
+		server.transports = append(server.transports, transport)
+		listener, err := transport.Listen(config, nil)
+		if err != nil {
+			server.Close()
+			return nil, err
+		}
+		server.listeners = append(server.listeners, listener)
+	}
+	return server, nil
+}
+
+// quicTlsConfig adapts a config that disables session tickets for quic-go, which expects crypto/tls to always issue
+// one. Tickets are issued instead, but never accepted, so clients still do a full handshake.
+func quicTlsConfig(config *tls.Config) *tls.Config {
+	if !config.SessionTicketsDisabled {
+		return config
+	}
+	config = config.Clone()
+	config.SessionTicketsDisabled = false
+	config.UnwrapSession = func(identity []byte, state tls.ConnectionState) (*tls.SessionState, error) {
+		return nil, nil
+	}
+	if getConfigForClient := config.GetConfigForClient; getConfigForClient != nil {
+		config.GetConfigForClient = func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+			testConfig, err := getConfigForClient(info)
+			if testConfig != nil {
+				testConfig = quicTlsConfig(testConfig)
+			}
+			return testConfig, err
+		}
+	}
+	return config
+}
+
+// serve handles HTTP/3 requests until the server is closed.
+func (s *quicServer) serve() error {
+	errs := make(chan error, len(s.listeners))
+	for _, listener := range s.listeners {
+		go func(listener *quic.Listener) {
+			errs <- s.accept(listener)
+		}(listener)
+	}
+	var err error
+	for range s.listeners {
+		if listenerErr := <-errs; err == nil || err == http.ErrServerClosed {
+			err = listenerErr
+		}
+	}
+	return err
+}
+
+func (s *quicServer) accept(listener *quic.Listener) error {
+	for {
+		// Connections are accepted once their handshake is complete
+		conn, err := listener.Accept(context.Background())
+		if err != nil {
+			if errors.Is(err, quic.ErrServerClosed) {
+				return http.ErrServerClosed
+			}
+			return err
+		}
+		if handshake := getQuicHandshake(conn.Context()); handshake != nil {
+			handshake.finish(nil)
+		}
+		go s.server.ServeQUICConn(conn)
+	}
+}
+
+func (s *quicServer) Close() error {
+	err := s.server.Close()
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+	for _, transport := range s.transports {
+		transport.Close()
+		// The transport doesn't close a socket it was given
+		transport.Conn.Close()
+	}
+	return err
+}
+
+func (s *quicServer) Addr() net.Addr {
+	return s.listeners[0].Addr()
+}
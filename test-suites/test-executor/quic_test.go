@@ -0,0 +1,147 @@
+package test_executor
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startTestQuicServer(t *testing.T, handler http.Handler) (*quicServer, <-chan *HandshakeTelemetry) {
+	handshaker, handshakes := newTestHandshaker(t)
+	conns, err := listenUdp("127.0.0.1", 0)
+	require.NoError(t, err)
+	server, err := newQuicServer(conns, handshaker, handler)
+	require.NoError(t, err)
+	served := make(chan error, 1)
+	go func() {
+		served <- server.serve()
+	}()
+	t.Cleanup(func() {
+		server.Close()
+		assert.Equal(t, http.ErrServerClosed, <-served)
+	})
+	return server, handshakes
+}
+
+func receiveHandshake(t *testing.T, handshakes <-chan *HandshakeTelemetry) *HandshakeTelemetry {
+	select {
+	case telemetry := <-handshakes:
+		return telemetry
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for the handshake")
+		return nil
+	}
+}
+
+func TestQuicServerServesHttp3(t *testing.T) {
+	// Larger than a client's initial flow control window, so the response takes several round trips
+	body := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	server, handshakes := startTestQuicServer(t, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		assert.Equal(t, "starttls.localhost", request.Host)
+		assert.Equal(t, "/ok", request.URL.Path)
+		assert.Equal(t, "h3", request.TLS.NegotiatedProtocol)
+		writer.Header().Set("X-Test", "1")
+		writer.Write(body)
+	}))
+	transport := &http3.Transport{TLSClientConfig: &tls.Config{ServerName: "starttls.localhost", InsecureSkipVerify: true}}
+	defer transport.Close()
+
+	request, err := http.NewRequest(http.MethodGet, "https://starttls.localhost/ok", nil)
+	require.NoError(t, err)
+	request.URL.Host = server.Addr().String()
+	request.Host = "starttls.localhost"
+	response, err := transport.RoundTrip(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "1", response.Header.Get("X-Test"))
+	received, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, body, received)
+
+	telemetry := receiveHandshake(t, handshakes)
+	assert.True(t, telemetry.HandshakeComplete)
+	assert.True(t, telemetry.Quic)
+	assert.Empty(t, telemetry.Error)
+}
+
+// A notifyingSessionCache signals each ticket the client stores.
+type notifyingSessionCache struct {
+	tls.ClientSessionCache
+	stored chan struct{}
+}
+
+func (c *notifyingSessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	c.ClientSessionCache.Put(sessionKey, cs)
+	if cs != nil {
+		c.stored <- struct{}{}
+	}
+}
+
+func TestQuicServerNeverResumes(t *testing.T) {
+	server, handshakes := startTestQuicServer(t, http.NotFoundHandler())
+	cache := &notifyingSessionCache{ClientSessionCache: tls.NewLRUClientSessionCache(1), stored: make(chan struct{}, 2)}
+	config := &tls.Config{
+		ServerName:         "starttls.localhost",
+		InsecureSkipVerify: true,
+		NextProtos:         []string{http3.NextProtoH3},
+		ClientSessionCache: cache,
+	}
+	for i := 0; i < 2; i++ {
+		conn, err := quic.DialAddr(context.Background(), server.Addr().String(), config, nil)
+		require.NoError(t, err)
+		assert.True(t, receiveHandshake(t, handshakes).HandshakeComplete)
+		assert.False(t, conn.ConnectionState().TLS.DidResume)
+		// The client gets a ticket, but the server doesn't accept it on the next connection
+		select {
+		case <-cache.stored:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for a session ticket")
+		}
+		conn.CloseWithError(0, "")
+	}
+}
+
+func TestQuicServerRecordsClientAlert(t *testing.T) {
+	server, handshakes := startTestQuicServer(t, http.NotFoundHandler())
+	// The server's certificate isn't trusted
+	_, err := quic.DialAddr(context.Background(), server.Addr().String(), &tls.Config{
+		ServerName: "starttls.localhost",
+		RootCAs:    x509.NewCertPool(),
+		NextProtos: []string{http3.NextProtoH3},
+	}, nil)
+	require.Error(t, err)
+
+	telemetry := receiveHandshake(t, handshakes)
+	assert.False(t, telemetry.HandshakeComplete)
+	assert.True(t, telemetry.Quic)
+	require.NotNil(t, telemetry.ClientAlert)
+	assert.Equal(t, "bad_certificate", telemetry.ClientAlert.String())
+	assert.NotEmpty(t, telemetry.Error)
+}
+
+func TestQuicServerRejectsOtherProtocols(t *testing.T) {
+	server, handshakes := startTestQuicServer(t, http.NotFoundHandler())
+	// The server only offers h3
+	_, err := quic.DialAddr(context.Background(), server.Addr().String(), &tls.Config{
+		ServerName:         "starttls.localhost",
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h2"},
+	}, nil)
+	require.Error(t, err)
+
+	telemetry := receiveHandshake(t, handshakes)
+	assert.False(t, telemetry.HandshakeComplete)
+	assert.Nil(t, telemetry.ClientAlert)
+	assert.NotEmpty(t, telemetry.Error)
+}
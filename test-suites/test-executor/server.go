@@ -1,17 +1,21 @@
 package test_executor
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
-	"encoding/pem"
+	"errors"
 	"fmt"
 	test_case "github.com/Netflix/bettertls/test-suites/test-case"
 	"github.com/Netflix/bettertls/test-suites/test-executor/web"
 	"github.com/sirupsen/logrus"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -20,55 +24,435 @@ type Server struct {
 	server    *http.Server
 	wg        *sync.WaitGroup
 
+	suites        *TestSuites
+	options       ServerOptions
 	plaintextPort int
 	tlsPort       int
+	startTlsPorts map[StartTlsProtocol]int
+	quic          *quicServer
+	quicPort      int
+	dns           *dnsResponder
+	stopOnce      sync.Once
+	// Closed once the server is stopped
+	stopped chan struct{}
 
+	lock         sync.Mutex
 	providerName string
 	testIndex    uint
+	// Incremented whenever a test is set, even if it's the same test again, so that handshakes from an earlier run of
+	// a test aren't reported as part of a later one
+	testGeneration uint64
+	// Lazily generated artifacts for the current test, so that the chain and any AIA resources agree with each other
+	artifacts *test_case.Artifacts
+	// Artifacts generated for some other test (for /tests/ downloads), kept so that the server presents the same chain
+	// if that test is set next
+	otherArtifacts *testArtifacts
+	// The handshakes with the TLS listener since the current test was set, and the number still in progress (for any
+	// test). handshakeDone is signaled whenever one finishes.
+	telemetry         []*HandshakeTelemetry
+	pendingHandshakes int
+	handshakeDone     *sync.Cond
+	// The traffic since the current test was set, if ServerOptions.CaptureTraffic is set
+	recorder *trafficRecorder
+	// The most recently uploaded results
+	results *ImplementationTestResults
+	// The open connections to the TLS listener, if ServerOptions.Http2 is set and so they can be kept alive
+	tlsConns map[net.Conn]struct{}
 }
 
 func (s *Server) SetTest(provider string, testIndex uint) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	s.providerName = provider
 	s.testIndex = testIndex
+	s.testGeneration += 1
+	s.artifacts = nil
+	if s.otherArtifacts != nil && s.otherArtifacts.providerName == provider && s.otherArtifacts.testIndex == testIndex {
+		s.artifacts = s.otherArtifacts.artifacts
+	}
+	s.telemetry = nil
+	if s.recorder != nil {
+		s.recorder.reset()
+	}
+	for conn := range s.tlsConns {
+		conn.Close()
+		delete(s.tlsConns, conn)
+	}
+}
+
+// trackTlsConn keeps track of the open connections to the TLS listener (rather than the plaintext listener), as an
+// http.Server ConnState hook.
+func (s *Server) trackTlsConn(conn net.Conn, state http.ConnState) {
+	if _, ok := conn.(*tls.Conn); !ok {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch state {
+	case http.StateNew:
+		s.tlsConns[conn] = struct{}{}
+	case http.StateHijacked, http.StateClosed:
+		delete(s.tlsConns, conn)
+	}
+}
+
+func (s *Server) startHandshake(remoteAddr net.Addr) *HandshakeTelemetry {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.pendingHandshakes += 1
+	return &HandshakeTelemetry{
+		Suite:      s.providerName,
+		TestCase:   s.testIndex,
+		RemoteAddr: remoteAddr.String(),
+		generation: s.testGeneration,
+	}
+}
+
+func (s *Server) finishHandshake(telemetry *HandshakeTelemetry) {
+	if s.options.OnHandshake != nil {
+		s.options.OnHandshake(telemetry)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.pendingHandshakes -= 1
+	// Drop handshakes that started before the test was set
+	if telemetry.generation == s.testGeneration {
+		s.telemetry = append(s.telemetry, telemetry)
+	}
+	s.handshakeDone.Broadcast()
+}
+
+// Telemetry returns what the server saw of each TLS connection made since the current test was set. It waits for any
+// handshakes in progress to finish first, so a client that has just given up on a handshake will be included.
+func (s *Server) Telemetry() []*HandshakeTelemetry {
+	_, _, telemetry := s.currentTelemetry()
+	return telemetry
+}
+
+// currentTelemetry is like Telemetry, and also returns the test the telemetry is for.
+func (s *Server) currentTelemetry() (string, uint, []*HandshakeTelemetry) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for s.pendingHandshakes > 0 {
+		s.handshakeDone.Wait()
+	}
+	return s.providerName, s.testIndex, append([]*HandshakeTelemetry(nil), s.telemetry...)
+}
+
+// WriteCapture writes the TCP traffic on the TLS and STARTTLS listeners (and through the CONNECT proxy) since the
+// current test was set as a pcapng file, with the TLS secrets needed to decrypt it. The server must have been started
+// with ServerOptions.CaptureTraffic. Like Telemetry, it waits for handshakes in progress to finish first.
+func (s *Server) WriteCapture(w io.Writer) error {
+	if s.recorder == nil {
+		return errors.New("the server isn't capturing traffic")
+	}
+	s.Telemetry()
+	return s.recorder.writeCapture(w)
+}
+
+// plaintextUrl is the URL of the plaintext listener: on the bind address if it's a specific IP, otherwise on localhost.
+func (s *Server) plaintextUrl() string {
+	host := "127.0.0.1"
+	if bindIp := net.ParseIP(s.options.BindAddress); bindIp != nil && !bindIp.IsUnspecified() {
+		host = s.options.BindAddress
+	}
+	return fmt.Sprintf("http://%s", net.JoinHostPort(host, strconv.Itoa(s.plaintextPort)))
+}
+
+func (s *Server) aiaBaseUrl() string {
+	return s.plaintextUrl() + "/aia/"
+}
+
+// ProxyUrl is the URL of the CONNECT proxy (the plaintext listener), which tunnels connections for any host to the TLS
+// listener. Clients can use it to connect to test cases whose hostnames don't resolve to the server.
+func (s *Server) ProxyUrl() string {
+	return s.plaintextUrl()
+}
+
+type testArtifacts struct {
+	providerName string
+	testIndex    uint
+	artifacts    *test_case.Artifacts
+}
+
+func (s *Server) getArtifacts() (*test_case.Artifacts, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.getArtifactsLocked()
+}
+
+func (s *Server) getArtifactsLocked() (*test_case.Artifacts, error) {
+	if s.artifacts != nil {
+		return s.artifacts, nil
+	}
+	artifacts, err := s.generateArtifacts(s.providerName, s.testIndex)
+	if err != nil {
+		return nil, err
+	}
+	s.artifacts = artifacts
+	return artifacts, nil
+}
+
+// getTestArtifacts gets the artifacts for any test, which are the same ones the server presents when that test is set.
+func (s *Server) getTestArtifacts(providerName string, testIndex uint) (*test_case.Artifacts, error) {
+	s.lock.Lock()
+	artifacts := s.generatedArtifactsLocked(providerName, testIndex)
+	s.lock.Unlock()
+	if artifacts != nil {
+		return artifacts, nil
+	}
+
+	// Generating the certificates can take a while, so do it without holding up handshakes
+	artifacts, err := s.generateArtifacts(providerName, testIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// If they were generated in the meantime, those are the ones the server presents
+	if generated := s.generatedArtifactsLocked(providerName, testIndex); generated != nil {
+		return generated, nil
+	}
+	if providerName == s.providerName && testIndex == s.testIndex {
+		s.artifacts = artifacts
+	} else {
+		s.otherArtifacts = &testArtifacts{
+			providerName: providerName,
+			testIndex:    testIndex,
+			artifacts:    artifacts,
+		}
+	}
+	return artifacts, nil
+}
+
+// generatedArtifactsLocked returns the artifacts already generated for a test, or nil if there are none.
+func (s *Server) generatedArtifactsLocked(providerName string, testIndex uint) *test_case.Artifacts {
+	if providerName == s.providerName && testIndex == s.testIndex {
+		return s.artifacts
+	}
+	if s.otherArtifacts != nil && s.otherArtifacts.providerName == providerName && s.otherArtifacts.testIndex == testIndex {
+		return s.otherArtifacts.artifacts
+	}
+	return nil
+}
+
+func (s *Server) generateArtifacts(providerName string, testIndex uint) (*test_case.Artifacts, error) {
+	provider := s.suites.GetProvider(providerName)
+	if provider == nil {
+		return nil, fmt.Errorf("invalid provider: %s", providerName)
+	}
+	testCase, err := provider.GetTestCase(testIndex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid test case %d: %v", testIndex, err)
+	}
+	return s.suites.GetTestCaseArtifacts(testCase, s.aiaBaseUrl())
+}
+
+// Implementation names are used in results file names
+var validImplementationName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// ServerOptions configures a server started with StartServerWithOptions. The zero value is a server on all interfaces
+// with randomly assigned ports.
+type ServerOptions struct {
+	// The address to listen on, e.g. "127.0.0.1". Defaults to all interfaces. The TCP listeners of a server bound to
+	// an IPv4 address also listen on the IPv6 loopback address, for test cases with IPv6 hostnames.
+	BindAddress string
+	// The ports for the plaintext and TLS listeners. If 0, a free port is chosen.
+	PlaintextPort uint16
+	TlsPort       uint16
+	// The STARTTLS listeners to start, and their ports (0 for a free port). They present the same certificates as the
+	// TLS listener once the client asks to start TLS.
+	StartTlsPorts map[StartTlsProtocol]uint16
+	// Whether the TLS listener offers HTTP/2 (ALPN "h2") as well as HTTP/1.1, and serves the gRPC health service
+	// (grpc.health.v1.Health) to HTTP/2 clients. Ignored for ALPN if TlsConfig sets NextProtos.
+	Http2 bool
+	// Whether to also serve HTTP/3 over QUIC, and the UDP port to serve it on (0 for a free port). QUIC always uses
+	// TLS 1.3, so handshakes for test cases that require TLS 1.2 fail.
+	Quic     bool
+	QuicPort uint16
+	// Whether to run a DNS responder (over UDP and TCP, on the same port), and the port to run it on (0 for a free
+	// port). It answers queries for every name under DnsZone (DefaultDnsZone if empty), and for each of DnsNames, with
+	// the server's loopback address, and refuses all others. It only listens on loopback.
+	Dns      bool
+	DnsPort  uint16
+	DnsZone  string
+	DnsNames []string
+	// Where errors from the HTTP server are logged. Defaults to discarding them.
+	ErrorLog *log.Logger
+	// Where results uploaded to /results are saved. If empty, /results isn't served.
+	ResultsDir string
+	// The base configuration for the TLS listener, e.g. to restrict versions, cipher suites or ALPN protocols
+	// (NextProtos). The server presents each test's certificates and disables session tickets on a copy of it.
+	TlsConfig *tls.Config
+	// Whether to record the TCP traffic on the TLS and STARTTLS listeners, and the TLS secrets for it, so that each
+	// test's traffic can be saved with WriteCapture. Only TCP is captured: HTTP/3 over QUIC isn't recorded. The secrets
+	// are also written to TlsConfig.KeyLogWriter, if set.
+	CaptureTraffic bool
+
+	// Called after each TLS handshake, whether or not it succeeded
+	OnHandshake func(telemetry *HandshakeTelemetry)
+	// Called with each HTTP request (on either listener) before it is handled
+	OnRequest func(request *http.Request)
+	// Called with the certificate chosen for each handshake
+	OnCertificateSelected func(info *tls.ClientHelloInfo, certificate *tls.Certificate)
 }
 
 func StartServer(suites *TestSuites, serverLogger *log.Logger, plaintextPort uint16, tlsPort uint16) (*Server, error) {
+	return StartServerWithOptions(context.Background(), suites, &ServerOptions{
+		PlaintextPort: plaintextPort,
+		TlsPort:       tlsPort,
+		ErrorLog:      serverLogger,
+	})
+}
 
-	ptListener, err := net.Listen("tcp", fmt.Sprintf(":%d", plaintextPort))
+// StartServerWithOptions starts a test server, which runs until Stop or Shutdown is called or the context is done.
+func StartServerWithOptions(ctx context.Context, suites *TestSuites, options *ServerOptions) (*Server, error) {
+	if options == nil {
+		options = &ServerOptions{}
+	}
+	errorLog := options.ErrorLog
+	if errorLog == nil {
+		errorLog = noplog
+	}
+
+	ptListener, err := listenTcp(options.BindAddress, options.PlaintextPort)
 	if err != nil {
 		return nil, err
 	}
 
-	var server *Server
-	tlsConfig := &tls.Config{
-		// To make sure clients always do a full TLS handshake in order to check the cert verification, do not allow session tickets
-		SessionTicketsDisabled: true,
-		GetCertificate: func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
-			provider := suites.GetProvider(server.providerName)
-			if provider == nil {
-				return nil, fmt.Errorf("invalid provider: %s", server.providerName)
-			}
-			testCase, err := provider.GetTestCase(server.testIndex)
-			if err != nil {
-				return nil, fmt.Errorf("invalid test case %d: %v", server.testIndex, err)
-			}
-			return testCase.GetCertificates(suites.rootCert, suites.rootKey)
-		},
+	server := &Server{suites: suites, options: *options, stopped: make(chan struct{})}
+	server.handshakeDone = sync.NewCond(&server.lock)
+	var tlsConfig *tls.Config
+	if options.TlsConfig != nil {
+		tlsConfig = options.TlsConfig.Clone()
+	} else {
+		tlsConfig = &tls.Config{}
+	}
+	if options.Http2 && len(tlsConfig.NextProtos) == 0 {
+		tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	}
+	// To make sure clients always do a full TLS handshake in order to check the cert verification, do not allow session tickets
+	tlsConfig.SessionTicketsDisabled = true
+	if options.CaptureTraffic {
+		server.recorder = newTrafficRecorder(maxCapturedBytes)
+		if tlsConfig.KeyLogWriter != nil {
+			tlsConfig.KeyLogWriter = io.MultiWriter(tlsConfig.KeyLogWriter, server.recorder)
+		} else {
+			tlsConfig.KeyLogWriter = server.recorder
+		}
+	}
+	tlsConfig.GetCertificate = func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		artifacts, err := server.getArtifacts()
+		if err != nil {
+			return nil, err
+		}
+		if options.OnCertificateSelected != nil {
+			options.OnCertificateSelected(info, artifacts.Certificate)
+		}
+		return artifacts.Certificate, nil
 	}
-	tlsListener, err := tls.Listen("tcp", fmt.Sprintf(":%d", tlsPort), tlsConfig)
+	tlsConfig.GetConfigForClient = func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+		recordClientHello(info)
+		artifacts, err := server.getArtifacts()
+		if err != nil {
+			return nil, err
+		}
+		if artifacts.TlsVersion == 0 {
+			return nil, nil
+		}
+		config := tlsConfig.Clone()
+		config.GetConfigForClient = nil
+		config.MinVersion = artifacts.TlsVersion
+		config.MaxVersion = artifacts.TlsVersion
+		return config, nil
+	}
+	rawTlsListener, err := listenTcp(options.BindAddress, options.TlsPort)
 	if err != nil {
 		ptListener.Close()
 		return nil, err
 	}
+	handshaker := &handshaker{
+		config:      tlsConfig,
+		onConnect:   server.startHandshake,
+		onHandshake: server.finishHandshake,
+	}
+	if server.recorder != nil {
+		rawTlsListener = &recordingListener{Listener: rawTlsListener, recorder: server.recorder}
+	}
+	tlsListener := newTelemetryListener(rawTlsListener, handshaker)
+	startTlsListeners := make(map[StartTlsProtocol]net.Listener)
+	var quicConns []net.PacketConn
+	closeListeners := func() {
+		ptListener.Close()
+		tlsListener.Close()
+		for _, listener := range startTlsListeners {
+			listener.Close()
+		}
+		for _, conn := range quicConns {
+			conn.Close()
+		}
+		if server.dns != nil {
+			server.dns.Close()
+		}
+	}
+	for protocol, port := range options.StartTlsPorts {
+		listener, err := listenTcp(options.BindAddress, port)
+		if err != nil {
+			closeListeners()
+			return nil, err
+		}
+		if server.recorder != nil {
+			listener = &recordingListener{Listener: listener, recorder: server.recorder}
+		}
+		startTlsListeners[protocol] = listener
+	}
+	if options.Dns {
+		zone := options.DnsZone
+		if zone == "" {
+			zone = DefaultDnsZone
+		}
+		server.dns, err = newDnsResponder(options.BindAddress, options.DnsPort, zone, options.DnsNames)
+		if err != nil {
+			closeListeners()
+			return nil, err
+		}
+	}
+	if options.Quic {
+		quicConns, err = listenUdp(options.BindAddress, options.QuicPort)
+		if err != nil {
+			closeListeners()
+			return nil, err
+		}
+	}
 
 	router := http.NewServeMux()
 	router.HandleFunc("/root.crt", func(writer http.ResponseWriter, request *http.Request) {
+		// Only the suite root, for installing in a trust store. Test cases with other trust anchors (e.g. distractor
+		// roots) need /root.pem instead.
 		writer.Header().Set("Content-Type", "application/x-x509-ca-cert")
 		writer.Write(suites.rootCert.Raw)
 	})
 	router.HandleFunc("/root.pem", func(writer http.ResponseWriter, request *http.Request) {
+		// Serve the trust anchors of the current test, which may be more than just the suite root
+		artifacts, err := server.getArtifacts()
+		if err != nil {
+			http.Error(writer, fmt.Sprintf("Failed to generate test artifacts: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/x-pem-file")
+		writer.Write(artifacts.TrustAnchorsPem())
+	})
+	router.HandleFunc("/intermediates.pem", func(writer http.ResponseWriter, request *http.Request) {
+		// Serve the untrusted intermediates that the client should already have for the current test
+		artifacts, err := server.getArtifacts()
+		if err != nil {
+			http.Error(writer, fmt.Sprintf("Failed to generate test artifacts: %v", err), http.StatusInternalServerError)
+			return
+		}
 		writer.Header().Set("Content-Type", "application/x-pem-file")
-		pem.Encode(writer, &pem.Block{Type: "CERTIFICATE", Bytes: suites.rootCert.Raw})
+		writer.Write(artifacts.IntermediatesPem())
 	})
 	router.HandleFunc("/suites", func(writer http.ResponseWriter, request *http.Request) {
 		var resp struct {
@@ -84,6 +468,8 @@ func StartServer(suites *TestSuites, serverLogger *log.Logger, plaintextPort uin
 				TestCount           uint                         `json:"testCount"`
 				SanityCheckTestCase uint                         `json:"sanityCheckTestCase"`
 				FeatureTestCases    map[test_case.Feature][]uint `json:"featureTestCases"`
+				// Set for suites whose test cases must be verified by URI identity, which browsers can't do
+				UriIdentity bool `json:"uriIdentity,omitempty"`
 			}
 			suite.FeatureTestCases = make(map[test_case.Feature][]uint)
 
@@ -98,6 +484,11 @@ func StartServer(suites *TestSuites, serverLogger *log.Logger, plaintextPort uin
 				http.Error(writer, fmt.Sprintf("failed to get sanity check test case: %v", err), http.StatusInternalServerError)
 				return
 			}
+			suite.UriIdentity, err = isUriIdentitySuite(provider)
+			if err != nil {
+				http.Error(writer, fmt.Sprintf("failed to determine whether the suite checks URI identities: %v", err), http.StatusInternalServerError)
+				return
+			}
 			for _, feature := range provider.GetFeatures() {
 				testCases, err := provider.GetTestCasesForFeature(feature)
 				if err != nil {
@@ -164,17 +555,182 @@ func StartServer(suites *TestSuites, serverLogger *log.Logger, plaintextPort uin
 			Suite            string                   `json:"suite"`
 			TestId           uint                     `json:"testId"`
 			Hostname         string                   `json:"hostname"`
+			UriIdentity      string                   `json:"uriIdentity,omitempty"`
 			ExpectedResult   test_case.ExpectedResult `json:"expectedResult"`
 			RequiredFeatures []test_case.Feature      `json:"requiredFeatures"`
 		}
 		respBody.Suite = provider.Name()
 		respBody.TestId = uint(testId)
 		respBody.Hostname = testCase.GetHostname()
+		respBody.UriIdentity = test_case.GetUriIdentity(testCase)
 		respBody.ExpectedResult = testCase.ExpectedResult()
 		respBody.RequiredFeatures = testCase.RequiredFeatures()
 
 		json.NewEncoder(writer).Encode(&respBody)
 	})
+	router.HandleFunc("/manifest", func(writer http.ResponseWriter, request *http.Request) {
+		manifest, err := suites.BuildManifest()
+		if err != nil {
+			http.Error(writer, fmt.Sprintf("Failed to build manifest: %v", err), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(writer).Encode(manifest)
+	})
+	router.HandleFunc("/tests/{suite}/{testCase}/{file}", func(writer http.ResponseWriter, request *http.Request) {
+		// Serves the artifacts for any test case, exactly as the server will present them when it's set
+		providerName := request.PathValue("suite")
+		provider := suites.GetProvider(providerName)
+		if provider == nil {
+			http.Error(writer, fmt.Sprintf("Invalid suite: %s", providerName), http.StatusNotFound)
+			return
+		}
+		testCount, err := provider.GetTestCaseCount()
+		if err != nil {
+			http.Error(writer, fmt.Sprintf("failed to get test count: %v", err), http.StatusInternalServerError)
+			return
+		}
+		testId, err := strconv.ParseUint(request.PathValue("testCase"), 10, 0)
+		if err != nil || uint(testId) >= testCount {
+			http.Error(writer, fmt.Sprintf("Invalid test case: %s", request.PathValue("testCase")), http.StatusNotFound)
+			return
+		}
+		testCase, err := provider.GetTestCase(uint(testId))
+		if err != nil {
+			http.Error(writer, fmt.Sprintf("Invalid test case: %d", testId), http.StatusNotFound)
+			return
+		}
+		artifacts, err := server.getTestArtifacts(providerName, uint(testId))
+		if err != nil {
+			http.Error(writer, fmt.Sprintf("Failed to generate test artifacts: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		switch request.PathValue("file") {
+		case "chain.pem":
+			writer.Header().Set("Content-Type", "application/x-pem-file")
+			writer.Write(artifacts.ChainPem())
+		case "leaf.pem":
+			writer.Header().Set("Content-Type", "application/x-pem-file")
+			writer.Write(artifacts.LeafPem())
+		case "definition.json", "bundle.zip":
+			definition, err := getTestDefinition(provider, uint(testId), testCase)
+			if err != nil {
+				http.Error(writer, fmt.Sprintf("Failed to describe test case: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if request.PathValue("file") == "definition.json" {
+				writer.Header().Set("Content-Type", "application/json")
+				writer.Write(definition)
+				return
+			}
+			writer.Header().Set("Content-Type", "application/zip")
+			writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-%d.zip\"", providerName, testId))
+			err = writeTestBundle(writer, definition, artifacts)
+			if err != nil {
+				logrus.Errorf("Error writing response: %v", err)
+			}
+		default:
+			http.NotFound(writer, request)
+		}
+	})
+	router.HandleFunc("/telemetry", func(writer http.ResponseWriter, request *http.Request) {
+		var respBody struct {
+			Suite      string                `json:"suite"`
+			TestCase   uint                  `json:"testCase"`
+			Handshakes []*HandshakeTelemetry `json:"handshakes"`
+		}
+		respBody.Suite, respBody.TestCase, respBody.Handshakes = server.currentTelemetry()
+		if respBody.Handshakes == nil {
+			respBody.Handshakes = []*HandshakeTelemetry{}
+		}
+
+		json.NewEncoder(writer).Encode(&respBody)
+	})
+	router.HandleFunc("/results", func(writer http.ResponseWriter, request *http.Request) {
+		if options.ResultsDir == "" {
+			http.NotFound(writer, request)
+			return
+		}
+		switch request.Method {
+		case http.MethodGet:
+			server.lock.Lock()
+			results := server.results
+			server.lock.Unlock()
+			if results == nil {
+				http.Error(writer, "No results have been uploaded", http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(writer).Encode(results)
+		case http.MethodPost:
+			var reqBody struct {
+				Implementation string `json:"implementation"`
+				// Defaults to the client's user agent
+				Version string `json:"version"`
+				// For each suite, the result (ACCEPTED or REJECTED) of every test case the client ran
+				Suites map[string]map[uint]string `json:"suites"`
+			}
+			err := json.NewDecoder(request.Body).Decode(&reqBody)
+			if err != nil {
+				http.Error(writer, fmt.Sprintf("Failed to parse request body: %v", err), http.StatusBadRequest)
+				return
+			}
+			if reqBody.Implementation == "" {
+				reqBody.Implementation = "browser"
+			}
+			if !validImplementationName.MatchString(reqBody.Implementation) {
+				http.Error(writer, fmt.Sprintf("Invalid implementation: %s", reqBody.Implementation), http.StatusBadRequest)
+				return
+			}
+			if reqBody.Version == "" {
+				reqBody.Version = request.UserAgent()
+			}
+
+			suiteResults := make(map[string]*SuiteTestResults)
+			for suiteName, verdicts := range reqBody.Suites {
+				provider := suites.GetProvider(suiteName)
+				if provider == nil {
+					http.Error(writer, fmt.Sprintf("Invalid suite: %s", suiteName), http.StatusBadRequest)
+					return
+				}
+				testCaseResults := make(map[uint]TestCaseResult, len(verdicts))
+				for testCase, verdict := range verdicts {
+					result, ok := TestCaseResult_value[verdict]
+					if !ok || TestCaseResult(result) == TestCaseResult_SKIPPED {
+						http.Error(writer, fmt.Sprintf("Invalid result for %s test case %d: %s", suiteName, testCase, verdict), http.StatusBadRequest)
+						return
+					}
+					testCaseResults[testCase] = TestCaseResult(result)
+				}
+				suiteResults[suiteName], err = buildSuiteResults(provider, testCaseResults)
+				if err != nil {
+					http.Error(writer, fmt.Sprintf("Invalid results for suite %s: %v", suiteName, err), http.StatusBadRequest)
+					return
+				}
+			}
+
+			results, err := NewImplementationTestResults(reqBody.Implementation, reqBody.Version, suiteResults)
+			if err != nil {
+				http.Error(writer, fmt.Sprintf("Failed to encode results: %v", err), http.StatusInternalServerError)
+				return
+			}
+			var respBody struct {
+				ResultsFile string `json:"resultsFile"`
+			}
+			respBody.ResultsFile, err = results.Save(options.ResultsDir)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			logrus.Infof("Saved results for %s to %s", results.ImplementationInfo, respBody.ResultsFile)
+			server.lock.Lock()
+			server.results = results
+			server.lock.Unlock()
+
+			json.NewEncoder(writer).Encode(&respBody)
+		default:
+			http.Error(writer, fmt.Sprintf("Invalid request method for this endpoint: %s", request.Method), http.StatusBadRequest)
+		}
+	})
 	router.HandleFunc("/ok", func(writer http.ResponseWriter, request *http.Request) {
 		writer.Header().Set("Access-Control-Allow-Origin", "*")
 		_, err := writer.Write([]byte("OK"))
@@ -182,14 +738,74 @@ func StartServer(suites *TestSuites, serverLogger *log.Logger, plaintextPort uin
 			logrus.Errorf("Error writing response: %v", err)
 		}
 	})
+	router.HandleFunc("/aia/", func(writer http.ResponseWriter, request *http.Request) {
+		artifacts, err := server.getArtifacts()
+		if err != nil {
+			http.Error(writer, fmt.Sprintf("Failed to generate test artifacts: %v", err), http.StatusInternalServerError)
+			return
+		}
+		resource := artifacts.AiaResources[strings.TrimPrefix(request.URL.Path, "/aia/")]
+		if resource == nil {
+			http.NotFound(writer, request)
+			return
+		}
+		writer.Header().Set("Content-Type", resource.ContentType)
+		_, err = writer.Write(resource.Body)
+		if err != nil {
+			logrus.Errorf("Error writing response: %v", err)
+		}
+	})
 	router.Handle("/", http.FileServer(http.FS(web.Content)))
 
-	httpServer := &http.Server{Handler: router, ErrorLog: serverLogger}
-	// Do not allow keep-alives since we want client testing to always have a do a new TLS handshake.
-	httpServer.SetKeepAlivesEnabled(false)
+	var handler http.Handler = newConnectProxy(router, tlsListener, server.recorder)
+	if options.OnRequest != nil {
+		proxy := handler
+		handler = http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			options.OnRequest(request)
+			proxy.ServeHTTP(writer, request)
+		})
+	}
+	if options.Http2 {
+		handler = newGrpcHandler(handler)
+	}
+	if quicConns != nil {
+		server.quic, err = newQuicServer(quicConns, handshaker, handler)
+		if err != nil {
+			closeListeners()
+			return nil, err
+		}
+	}
+	httpServer := &http.Server{Handler: handler, ErrorLog: errorLog}
+	if options.Http2 {
+		// gRPC clients fail their RPC if the server closes an HTTP/2 connection right after its first request, so
+		// keep-alives stay enabled. HTTP/1.x connections are still closed after each response, and connections to the
+		// TLS listener are closed whenever the test is set, so every test still gets a new TLS handshake.
+		httpServer.Handler = http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if request.ProtoMajor == 1 {
+				writer.Header().Set("Connection", "close")
+			}
+			handler.ServeHTTP(writer, request)
+		})
+		server.tlsConns = make(map[net.Conn]struct{})
+		httpServer.ConnState = server.trackTlsConn
+	} else {
+		// Do not allow keep-alives since we want client testing to always have a do a new TLS handshake.
+		httpServer.SetKeepAlivesEnabled(false)
+	}
 
 	allListeners := []net.Listener{ptListener, tlsListener}
 	wg := &sync.WaitGroup{}
+	server.listeners = allListeners
+	server.server = httpServer
+	server.wg = wg
+	server.plaintextPort = ptListener.Addr().(*net.TCPAddr).Port
+	server.tlsPort = tlsListener.Addr().(*net.TCPAddr).Port
+	server.startTlsPorts = make(map[StartTlsProtocol]int)
+	for protocol, listener := range startTlsListeners {
+		server.listeners = append(server.listeners, listener)
+		server.startTlsPorts[protocol] = listener.Addr().(*net.TCPAddr).Port
+	}
+
 	wg.Add(len(allListeners))
 	for _, listener := range allListeners {
 		go func(listener net.Listener) {
@@ -200,14 +816,42 @@ func StartServer(suites *TestSuites, serverLogger *log.Logger, plaintextPort uin
 			wg.Done()
 		}(listener)
 	}
-
-	server = &Server{
-		listeners:     allListeners,
-		server:        httpServer,
-		wg:            wg,
-		plaintextPort: ptListener.Addr().(*net.TCPAddr).Port,
-		tlsPort:       tlsListener.Addr().(*net.TCPAddr).Port,
+	if server.quic != nil {
+		server.quicPort = server.quic.Addr().(*net.UDPAddr).Port
+		wg.Add(1)
+		go func() {
+			err := server.quic.serve()
+			if err != http.ErrServerClosed {
+				logrus.Errorf("Error: %v", err)
+			}
+			wg.Done()
+		}()
+	}
+	if server.dns != nil {
+		wg.Add(2)
+		go func() {
+			server.dns.serveUdp()
+			wg.Done()
+		}()
+		go func() {
+			server.dns.serveTcp()
+			wg.Done()
+		}()
+	}
+	wg.Add(len(startTlsListeners))
+	for protocol, listener := range startTlsListeners {
+		go func(protocol StartTlsProtocol, listener net.Listener) {
+			serveStartTls(listener, protocol, handshaker)
+			wg.Done()
+		}(protocol, listener)
 	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			server.Stop()
+		case <-server.stopped:
+		}
+	}()
 
 	return server, nil
 }
@@ -216,10 +860,49 @@ func (s *Server) PlaintextPort() int {
 	return s.plaintextPort
 }
 
-func (s *Server) Stop() {
-	s.server.Close()
-	for _, listener := range s.listeners {
-		listener.Close()
+func (s *Server) TlsPort() int {
+	return s.tlsPort
+}
+
+// QuicPort returns the UDP port serving HTTP/3, or 0 if QUIC isn't enabled.
+func (s *Server) QuicPort() int {
+	return s.quicPort
+}
+
+// DnsPort returns the port of the DNS responder, or 0 if it isn't running.
+func (s *Server) DnsPort() int {
+	if s.dns == nil {
+		return 0
 	}
+	return s.dns.Port()
+}
+
+// StartTlsPort returns the port of the listener for a STARTTLS protocol, or 0 if it wasn't started.
+func (s *Server) StartTlsPort(protocol StartTlsProtocol) int {
+	return s.startTlsPorts[protocol]
+}
+
+// Stop closes all connections immediately.
+func (s *Server) Stop() {
+	s.stopOnce.Do(func() {
+		s.server.Close()
+		if s.quic != nil {
+			s.quic.Close()
+		}
+		if s.dns != nil {
+			s.dns.Close()
+		}
+		for _, listener := range s.listeners {
+			listener.Close()
+		}
+		close(s.stopped)
+	})
 	s.wg.Wait()
 }
+
+// Shutdown stops accepting connections and waits for active ones to finish, or until the context is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.server.Shutdown(ctx)
+	s.Stop()
+	return err
+}
@@ -0,0 +1,194 @@
+package test_executor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetTestArtifactsMatchesPresentedArtifacts(t *testing.T) {
+	suites, err := BuildTestSuites()
+	require.NoError(t, err)
+	server := &Server{suites: suites}
+	server.handshakeDone = sync.NewCond(&server.lock)
+	server.SetTest("pathbuilding", 0)
+
+	// Concurrent downloads of another test all get the artifacts that test is presented with once it's set
+	var wg sync.WaitGroup
+	downloaded := make([]*test_case.Artifacts, 4)
+	for i := range downloaded {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			artifacts, err := server.getTestArtifacts("pathbuilding", 1)
+			assert.NoError(t, err)
+			downloaded[i] = artifacts
+		}(i)
+	}
+	wg.Wait()
+	server.SetTest("pathbuilding", 1)
+	presented, err := server.getArtifacts()
+	require.NoError(t, err)
+	for _, artifacts := range downloaded {
+		assert.Same(t, presented, artifacts)
+	}
+
+	// And downloads of the current test get the artifacts being presented
+	artifacts, err := server.getTestArtifacts("pathbuilding", 1)
+	require.NoError(t, err)
+	assert.Same(t, presented, artifacts)
+}
+
+func TestHttp2ConnectionsLastUntilTestIsSet(t *testing.T) {
+	suites, err := BuildTestSuites()
+	require.NoError(t, err)
+	server, err := StartServerWithOptions(context.Background(), suites, &ServerOptions{BindAddress: "127.0.0.1", Http2: true})
+	require.NoError(t, err)
+	defer server.Stop()
+	server.SetTest("pathbuilding", 0)
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	defer client.CloseIdleConnections()
+	// get makes a request and reports whether it reused a connection
+	get := func() (bool, error) {
+		reused := false
+		trace := &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) {
+			reused = info.Reused
+		}}
+		request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://127.0.0.1:%d/ok", server.TlsPort()), nil)
+		require.NoError(t, err)
+		response, err := client.Do(request.WithContext(httptrace.WithClientTrace(request.Context(), trace)))
+		if err != nil {
+			return false, err
+		}
+		response.Body.Close()
+		assert.Equal(t, 2, response.ProtoMajor)
+		return reused, nil
+	}
+
+	reused, err := get()
+	require.NoError(t, err)
+	assert.False(t, reused)
+	reused, err = get()
+	require.NoError(t, err)
+	assert.True(t, reused)
+	assert.Len(t, server.Telemetry(), 1)
+
+	// The client may not have noticed that its connection was closed yet, in which case its first request fails
+	server.SetTest("pathbuilding", 1)
+	reused, err = get()
+	if err != nil {
+		reused, err = get()
+	}
+	require.NoError(t, err)
+	assert.False(t, reused)
+	assert.Len(t, server.Telemetry(), 1)
+}
+
+func TestResultsUpload(t *testing.T) {
+	suites, err := BuildTestSuites()
+	require.NoError(t, err)
+	resultsDir := t.TempDir()
+	server, err := StartServerWithOptions(context.Background(), suites, &ServerOptions{BindAddress: "127.0.0.1", ResultsDir: resultsDir})
+	require.NoError(t, err)
+	defer server.Stop()
+	resultsUrl := server.plaintextUrl() + "/results"
+
+	// Results from an implementation that behaves as the manifest expects
+	provider := suites.GetProvider("spiffe")
+	count, err := provider.GetTestCaseCount()
+	require.NoError(t, err)
+	verdicts := make(map[uint]string)
+	expected := make([]TestCaseResult, count)
+	for i := uint(0); i < count; i++ {
+		testCase, err := provider.GetTestCase(i)
+		require.NoError(t, err)
+		expected[i] = TestCaseResult_REJECTED
+		if testCase.ExpectedResult() == test_case.EXPECTED_RESULT_PASS {
+			expected[i] = TestCaseResult_ACCEPTED
+		}
+		verdicts[i] = expected[i].String()
+	}
+	sanityCheck, err := provider.GetSanityCheckTestCase()
+	require.NoError(t, err)
+	failedSanityCheck := make(map[uint]string)
+	for i, verdict := range verdicts {
+		failedSanityCheck[i] = verdict
+	}
+	failedSanityCheck[sanityCheck] = "REJECTED"
+	upload := func(body interface{}) *http.Response {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		request, err := http.NewRequest(http.MethodPost, resultsUrl, bytes.NewReader(data))
+		require.NoError(t, err)
+		request.Header.Set("User-Agent", "test-browser/1.0")
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		return response
+	}
+
+	response, err := http.Get(resultsUrl)
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	response = upload(map[string]interface{}{"suites": map[string]interface{}{"spiffe": verdicts}})
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var respBody struct {
+		ResultsFile string `json:"resultsFile"`
+	}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&respBody))
+	assert.Equal(t, filepath.Join(resultsDir, "browser_results.json"), respBody.ResultsFile)
+	assert.FileExists(t, respBody.ResultsFile)
+
+	// The saved results default to the "browser" implementation and the client's user agent, and have a verdict for
+	// every test case
+	response, err = http.Get(resultsUrl)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	var results ImplementationTestResults
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&results))
+	assert.Equal(t, "browser", results.ImplementationInfo)
+	assert.Equal(t, "test-browser/1.0", results.VersionInfo)
+	require.Contains(t, results.Suites, "spiffe")
+	gz, err := gzip.NewReader(bytes.NewReader(results.Suites["spiffe"]))
+	require.NoError(t, err)
+	encoded, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	var suiteResults SuiteTestResults
+	require.NoError(t, proto.Unmarshal(encoded, &suiteResults))
+	assert.Equal(t, expected, suiteResults.TestCaseResults)
+	assert.Nil(t, suiteResults.TestCaseDurationsMs)
+
+	for name, body := range map[string]interface{}{
+		"invalid implementation": map[string]interface{}{"implementation": "../x", "suites": map[string]interface{}{}},
+		"unknown suite":          map[string]interface{}{"suites": map[string]interface{}{"nope": map[uint]string{}}},
+		"skipped result":         map[string]interface{}{"suites": map[string]interface{}{"spiffe": map[uint]string{0: "SKIPPED"}}},
+		"unknown result":         map[string]interface{}{"suites": map[string]interface{}{"spiffe": map[uint]string{0: "MAYBE"}}},
+		"missing results":        map[string]interface{}{"suites": map[string]interface{}{"spiffe": map[uint]string{0: "ACCEPTED"}}},
+		"failed sanity check":    map[string]interface{}{"suites": map[string]interface{}{"spiffe": failedSanityCheck}},
+		"not an object":          "results",
+	} {
+		response := upload(body)
+		response.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode, name)
+	}
+}
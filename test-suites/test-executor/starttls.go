@@ -0,0 +1,668 @@
+package test_executor
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// A StartTlsProtocol is a plaintext protocol the server can upgrade to TLS, so that clients other than HTTPS clients
+// can be tested. The server implements just enough of each protocol to get to the handshake, and then replies to the
+// client's requests over TLS with STARTTLS_SUCCESS_MARKER.
+type StartTlsProtocol int
+
+const (
+	STARTTLS_SMTP StartTlsProtocol = iota
+	STARTTLS_IMAP
+	STARTTLS_POP3
+	STARTTLS_LDAP
+	// PostgreSQL's SSLRequest
+	STARTTLS_POSTGRES
+)
+
+var ALL_STARTTLS_PROTOCOLS = []StartTlsProtocol{STARTTLS_SMTP, STARTTLS_IMAP, STARTTLS_POP3, STARTTLS_LDAP, STARTTLS_POSTGRES}
+
+// String returns the protocol's name, as used by "openssl s_client -starttls".
+func (p StartTlsProtocol) String() string {
+	switch p {
+	case STARTTLS_SMTP:
+		return "smtp"
+	case STARTTLS_IMAP:
+		return "imap"
+	case STARTTLS_POP3:
+		return "pop3"
+	case STARTTLS_LDAP:
+		return "ldap"
+	case STARTTLS_POSTGRES:
+		return "postgres"
+	}
+	panic(fmt.Errorf("unhandled StartTlsProtocol: %d", p))
+}
+func (p StartTlsProtocol) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// DefaultPort is the port the standalone server listens on for the protocol: the protocol's usual port plus 8000.
+func (p StartTlsProtocol) DefaultPort() uint16 {
+	switch p {
+	case STARTTLS_SMTP:
+		return 8025
+	case STARTTLS_IMAP:
+		return 8143
+	case STARTTLS_POP3:
+		return 8110
+	case STARTTLS_LDAP:
+		return 8389
+	case STARTTLS_POSTGRES:
+		return 8432
+	}
+	panic(fmt.Errorf("unhandled StartTlsProtocol: %d", p))
+}
+
+// Sent to the client in replies after a successful handshake
+const STARTTLS_SUCCESS_MARKER = "bettertls handshake OK"
+
+// How long a client can stay connected to a STARTTLS listener
+const startTlsSessionTimeout = 30 * time.Second
+
+// The longest line or message the server will read from a client
+const maxStartTlsMessageLength = 4096
+
+// Returned when the client ends the session before (or instead of) starting TLS
+var errClientQuit = errors.New("client quit")
+
+// serveStartTls accepts connections on a STARTTLS listener until it is closed.
+func serveStartTls(listener net.Listener, protocol StartTlsProtocol, handshaker *handshaker) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go handleStartTls(conn, protocol, handshaker)
+	}
+}
+
+func handleStartTls(conn net.Conn, protocol StartTlsProtocol, handshaker *handshaker) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(startTlsSessionTimeout))
+
+	reader := bufio.NewReaderSize(conn, maxStartTlsMessageLength)
+	err := protocol.negotiate(conn, reader)
+	if err != nil {
+		if err != errClientQuit {
+			logrus.Debugf("%s session from %s ended before TLS: %v", protocol, conn.RemoteAddr(), err)
+		}
+		return
+	}
+	// The client may have sent the start of its handshake along with its last plaintext command
+	tlsConn, err := handshaker.handshake(&bufferedConn{Conn: conn, reader: reader}, func(telemetry *HandshakeTelemetry) {
+		telemetry.StartTls = protocol.String()
+	})
+	if err != nil {
+		return
+	}
+	// Closing the tls.Conn sends the client a close_notify
+	defer tlsConn.Close()
+	err = protocol.serve(tlsConn, bufio.NewReaderSize(tlsConn, maxStartTlsMessageLength))
+	if err != nil && err != errClientQuit {
+		logrus.Debugf("%s session from %s ended: %v", protocol, conn.RemoteAddr(), err)
+	}
+}
+
+// A bufferedConn reads through a bufio.Reader that has already consumed some of the connection.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// negotiate runs the protocol up to the point where the client starts its TLS handshake.
+func (p StartTlsProtocol) negotiate(conn net.Conn, reader *bufio.Reader) error {
+	switch p {
+	case STARTTLS_SMTP:
+		return negotiateSmtp(conn, reader)
+	case STARTTLS_IMAP:
+		return negotiateImap(conn, reader)
+	case STARTTLS_POP3:
+		return negotiatePop3(conn, reader)
+	case STARTTLS_LDAP:
+		return negotiateLdap(conn, reader)
+	case STARTTLS_POSTGRES:
+		return negotiatePostgres(conn, reader)
+	}
+	panic(fmt.Errorf("unhandled StartTlsProtocol: %d", p))
+}
+
+// serve runs the protocol over TLS until the client quits.
+func (p StartTlsProtocol) serve(conn net.Conn, reader *bufio.Reader) error {
+	switch p {
+	case STARTTLS_SMTP:
+		return serveSmtp(conn, reader)
+	case STARTTLS_IMAP:
+		return serveImap(conn, reader)
+	case STARTTLS_POP3:
+		return servePop3(conn, reader)
+	case STARTTLS_LDAP:
+		return serveLdap(conn, reader)
+	case STARTTLS_POSTGRES:
+		return servePostgres(conn, reader)
+	}
+	panic(fmt.Errorf("unhandled StartTlsProtocol: %d", p))
+}
+
+// readCommand reads a line from a text protocol and splits it into words.
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(line)), nil
+}
+
+// commandVerb returns the (uppercased) word of a command at the given index, or "".
+func commandVerb(command []string, index int) string {
+	if index >= len(command) {
+		return ""
+	}
+	return strings.ToUpper(command[index])
+}
+
+func writeLines(w io.Writer, lines ...string) error {
+	_, err := io.WriteString(w, strings.Join(lines, "\r\n")+"\r\n")
+	return err
+}
+
+func negotiateSmtp(conn net.Conn, reader *bufio.Reader) error {
+	if err := writeLines(conn, "220 bettertls ESMTP"); err != nil {
+		return err
+	}
+	for {
+		command, err := readCommand(reader)
+		if err != nil {
+			return err
+		}
+		switch commandVerb(command, 0) {
+		case "EHLO":
+			err = writeLines(conn, "250-bettertls", "250 STARTTLS")
+		case "HELO", "NOOP", "RSET":
+			err = writeLines(conn, "250 OK")
+		case "STARTTLS":
+			return writeLines(conn, "220 Ready to start TLS")
+		case "QUIT":
+			writeLines(conn, "221 Bye")
+			return errClientQuit
+		default:
+			err = writeLines(conn, "530 Must issue a STARTTLS command first")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func serveSmtp(conn net.Conn, reader *bufio.Reader) error {
+	for {
+		command, err := readCommand(reader)
+		if err != nil {
+			return err
+		}
+		switch commandVerb(command, 0) {
+		case "EHLO":
+			err = writeLines(conn, "250-bettertls", "250 "+STARTTLS_SUCCESS_MARKER)
+		case "HELO", "NOOP", "RSET":
+			err = writeLines(conn, "250 "+STARTTLS_SUCCESS_MARKER)
+		case "QUIT":
+			writeLines(conn, "221 "+STARTTLS_SUCCESS_MARKER)
+			return errClientQuit
+		default:
+			err = writeLines(conn, "502 Command not implemented")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func negotiateImap(conn net.Conn, reader *bufio.Reader) error {
+	if err := writeLines(conn, "* OK [CAPABILITY IMAP4rev1 STARTTLS LOGINDISABLED] bettertls ready"); err != nil {
+		return err
+	}
+	for {
+		command, err := readCommand(reader)
+		if err != nil {
+			return err
+		}
+		if len(command) < 2 {
+			err = writeLines(conn, "* BAD Invalid command")
+		} else {
+			tag := command[0]
+			switch commandVerb(command, 1) {
+			case "CAPABILITY":
+				err = writeLines(conn, "* CAPABILITY IMAP4rev1 STARTTLS LOGINDISABLED", tag+" OK CAPABILITY completed")
+			case "NOOP":
+				err = writeLines(conn, tag+" OK NOOP completed")
+			case "STARTTLS":
+				return writeLines(conn, tag+" OK Begin TLS negotiation now")
+			case "LOGOUT":
+				writeLines(conn, "* BYE Logging out", tag+" OK LOGOUT completed")
+				return errClientQuit
+			default:
+				err = writeLines(conn, tag+" BAD Must issue a STARTTLS command first")
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func serveImap(conn net.Conn, reader *bufio.Reader) error {
+	for {
+		command, err := readCommand(reader)
+		if err != nil {
+			return err
+		}
+		if len(command) < 2 {
+			err = writeLines(conn, "* BAD Invalid command")
+		} else {
+			tag := command[0]
+			switch commandVerb(command, 1) {
+			case "CAPABILITY":
+				err = writeLines(conn, "* CAPABILITY IMAP4rev1", tag+" OK "+STARTTLS_SUCCESS_MARKER)
+			case "NOOP":
+				err = writeLines(conn, tag+" OK "+STARTTLS_SUCCESS_MARKER)
+			case "LOGOUT":
+				writeLines(conn, "* BYE Logging out", tag+" OK "+STARTTLS_SUCCESS_MARKER)
+				return errClientQuit
+			default:
+				err = writeLines(conn, tag+" BAD Command not implemented")
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func negotiatePop3(conn net.Conn, reader *bufio.Reader) error {
+	if err := writeLines(conn, "+OK bettertls ready"); err != nil {
+		return err
+	}
+	for {
+		command, err := readCommand(reader)
+		if err != nil {
+			return err
+		}
+		switch commandVerb(command, 0) {
+		case "CAPA":
+			err = writeLines(conn, "+OK Capability list follows", "STLS", ".")
+		case "NOOP":
+			err = writeLines(conn, "+OK")
+		case "STLS":
+			return writeLines(conn, "+OK Begin TLS negotiation")
+		case "QUIT":
+			writeLines(conn, "+OK Bye")
+			return errClientQuit
+		default:
+			err = writeLines(conn, "-ERR Must issue an STLS command first")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func servePop3(conn net.Conn, reader *bufio.Reader) error {
+	for {
+		command, err := readCommand(reader)
+		if err != nil {
+			return err
+		}
+		switch commandVerb(command, 0) {
+		case "CAPA":
+			err = writeLines(conn, "+OK "+STARTTLS_SUCCESS_MARKER, ".")
+		case "NOOP":
+			err = writeLines(conn, "+OK "+STARTTLS_SUCCESS_MARKER)
+		case "QUIT":
+			writeLines(conn, "+OK "+STARTTLS_SUCCESS_MARKER)
+			return errClientQuit
+		default:
+			err = writeLines(conn, "-ERR Command not implemented")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// LDAP protocolOp tags (RFC 4511 section 4.2), as [APPLICATION n] tags
+const (
+	ldapBindRequest      = 0x60
+	ldapBindResponse     = 0x61
+	ldapUnbindRequest    = 0x42
+	ldapSearchRequest    = 0x63
+	ldapSearchResultDone = 0x65
+	ldapExtendedRequest  = 0x77
+	ldapExtendedResponse = 0x78
+	// requestName and responseName in ExtendedRequest and ExtendedResponse
+	ldapRequestName  = 0x80
+	ldapResponseName = 0x8a
+)
+
+// LDAP result codes
+const (
+	ldapSuccess                 = 0
+	ldapProtocolError           = 2
+	ldapConfidentialityRequired = 13
+)
+
+const ldapStartTlsOid = "1.3.6.1.4.1.1466.20037"
+
+// parseBerLength parses a BER length, which (unlike in DER) needn't use the fewest bytes. LDAP clients such as
+// OpenLDAP always use the long form.
+func parseBerLength(readByte func() (byte, error)) (int, error) {
+	b, err := readByte()
+	if err != nil {
+		return 0, err
+	}
+	if b&0x80 == 0 {
+		return int(b), nil
+	}
+	lengthBytes := int(b & 0x7f)
+	if lengthBytes == 0 || lengthBytes > 4 {
+		return 0, fmt.Errorf("unsupported BER length encoding: %#x", b)
+	}
+	length := 0
+	for i := 0; i < lengthBytes; i++ {
+		b, err = readByte()
+		if err != nil {
+			return 0, err
+		}
+		length = length<<8 | int(b)
+	}
+	if length > maxStartTlsMessageLength {
+		return 0, fmt.Errorf("BER element too long: %d", length)
+	}
+	return length, nil
+}
+
+// parseBerElement splits the first BER element (with a single-byte tag) off of data.
+func parseBerElement(data []byte) (tag byte, contents []byte, rest []byte, err error) {
+	if len(data) < 1 {
+		return 0, nil, nil, io.ErrUnexpectedEOF
+	}
+	tag, data = data[0], data[1:]
+	length, err := parseBerLength(func() (byte, error) {
+		if len(data) < 1 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		b := data[0]
+		data = data[1:]
+		return b, nil
+	})
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if len(data) < length {
+		return 0, nil, nil, io.ErrUnexpectedEOF
+	}
+	return tag, data[:length], data[length:], nil
+}
+
+// readLdapMessage reads an LDAPMessage, returning its messageID (still encoded) and the protocolOp.
+func readLdapMessage(reader *bufio.Reader) (messageId []byte, opTag byte, op []byte, err error) {
+	tag, err := reader.ReadByte()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if tag != 0x30 {
+		return nil, 0, nil, fmt.Errorf("LDAPMessage is not a SEQUENCE: %#x", tag)
+	}
+	length, err := parseBerLength(reader.ReadByte)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	message := make([]byte, length)
+	if _, err = io.ReadFull(reader, message); err != nil {
+		return nil, 0, nil, err
+	}
+	tag, messageId, message, err = parseBerElement(message)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if tag != 0x02 {
+		return nil, 0, nil, fmt.Errorf("LDAPMessage has no messageID")
+	}
+	opTag, op, _, err = parseBerElement(message)
+	return messageId, opTag, op, err
+}
+
+// writeLdapResult writes an LDAPResult (as the given protocolOp) in reply to a message.
+func writeLdapResult(w io.Writer, messageId []byte, opTag byte, resultCode int, diagnosticMessage string, responseName string) error {
+	var b cryptobyte.Builder
+	b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1(cryptobyte_asn1.INTEGER, func(b *cryptobyte.Builder) {
+			b.AddBytes(messageId)
+		})
+		b.AddASN1(cryptobyte_asn1.Tag(opTag), func(b *cryptobyte.Builder) {
+			b.AddASN1Enum(int64(resultCode))
+			// matchedDN
+			b.AddASN1OctetString(nil)
+			b.AddASN1OctetString([]byte(diagnosticMessage))
+			if responseName != "" {
+				b.AddASN1(cryptobyte_asn1.Tag(ldapResponseName), func(b *cryptobyte.Builder) {
+					b.AddBytes([]byte(responseName))
+				})
+			}
+		})
+	})
+	message, err := b.Bytes()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(message)
+	return err
+}
+
+func negotiateLdap(conn net.Conn, reader *bufio.Reader) error {
+	for {
+		messageId, opTag, op, err := readLdapMessage(reader)
+		if err != nil {
+			return err
+		}
+		switch opTag {
+		case ldapExtendedRequest:
+			tag, requestName, _, err := parseBerElement(op)
+			if err != nil {
+				return err
+			}
+			if tag == ldapRequestName && string(requestName) == ldapStartTlsOid {
+				return writeLdapResult(conn, messageId, ldapExtendedResponse, ldapSuccess, "", ldapStartTlsOid)
+			}
+			err = writeLdapResult(conn, messageId, ldapExtendedResponse, ldapProtocolError, "Unsupported extended operation", "")
+		case ldapBindRequest:
+			err = writeLdapResult(conn, messageId, ldapBindResponse, ldapConfidentialityRequired, "Must issue a StartTLS request first", "")
+		case ldapSearchRequest:
+			err = writeLdapResult(conn, messageId, ldapSearchResultDone, ldapConfidentialityRequired, "Must issue a StartTLS request first", "")
+		case ldapUnbindRequest:
+			return errClientQuit
+		default:
+			return fmt.Errorf("unsupported LDAP operation: %#x", opTag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func serveLdap(conn net.Conn, reader *bufio.Reader) error {
+	for {
+		messageId, opTag, _, err := readLdapMessage(reader)
+		if err != nil {
+			return err
+		}
+		switch opTag {
+		case ldapBindRequest:
+			err = writeLdapResult(conn, messageId, ldapBindResponse, ldapSuccess, STARTTLS_SUCCESS_MARKER, "")
+		case ldapSearchRequest:
+			err = writeLdapResult(conn, messageId, ldapSearchResultDone, ldapSuccess, STARTTLS_SUCCESS_MARKER, "")
+		case ldapExtendedRequest:
+			err = writeLdapResult(conn, messageId, ldapExtendedResponse, ldapProtocolError, "Unsupported extended operation", "")
+		case ldapUnbindRequest:
+			return errClientQuit
+		default:
+			return fmt.Errorf("unsupported LDAP operation: %#x", opTag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Request codes sent by PostgreSQL clients in place of a protocol version
+const (
+	postgresSslRequest    = 80877103
+	postgresGssEncRequest = 80877104
+)
+
+// writePostgresMessage writes a backend message: a type byte, then the length of the message including itself.
+func writePostgresMessage(w io.Writer, messageType byte, body []byte) error {
+	message := []byte{messageType}
+	message = binary.BigEndian.AppendUint32(message, uint32(4+len(body)))
+	_, err := w.Write(append(message, body...))
+	return err
+}
+
+// postgresNotice builds the body of an ErrorResponse or NoticeResponse.
+func postgresNotice(severity string, code string, message string) []byte {
+	var body []byte
+	for _, field := range []struct {
+		fieldType byte
+		value     string
+	}{{'S', severity}, {'V', severity}, {'C', code}, {'M', message}} {
+		body = append(body, field.fieldType)
+		body = append(append(body, field.value...), 0)
+	}
+	return append(body, 0)
+}
+
+func negotiatePostgres(conn net.Conn, reader *bufio.Reader) error {
+	for {
+		// SSLRequest and GSSENCRequest are a length (8) and a request code
+		var request [8]byte
+		if _, err := io.ReadFull(reader, request[:]); err != nil {
+			return err
+		}
+		length := binary.BigEndian.Uint32(request[:4])
+		code := binary.BigEndian.Uint32(request[4:])
+		switch {
+		case length == 8 && code == postgresSslRequest:
+			_, err := conn.Write([]byte{'S'})
+			return err
+		case length == 8 && code == postgresGssEncRequest:
+			// Decline, so that the client falls back to an SSLRequest
+			if _, err := conn.Write([]byte{'N'}); err != nil {
+				return err
+			}
+		default:
+			writePostgresMessage(conn, 'E', postgresNotice("FATAL", "28000", "SSL is required"))
+			return errClientQuit
+		}
+	}
+}
+
+// readPostgresMessage reads a frontend message (a type byte followed by a length) and returns its type.
+func readPostgresMessage(reader *bufio.Reader) (byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return 0, err
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length < 4 || length > maxStartTlsMessageLength {
+		return 0, fmt.Errorf("invalid message length: %d", length)
+	}
+	if _, err := reader.Discard(int(length) - 4); err != nil {
+		return 0, err
+	}
+	return header[0], nil
+}
+
+func servePostgres(conn net.Conn, reader *bufio.Reader) error {
+	// The StartupMessage has no type byte. Its contents (user, database, ...) don't matter.
+	var lengthBytes [4]byte
+	if _, err := io.ReadFull(reader, lengthBytes[:]); err != nil {
+		return err
+	}
+	length := binary.BigEndian.Uint32(lengthBytes[:])
+	if length < 8 || length > maxStartTlsMessageLength {
+		return fmt.Errorf("invalid StartupMessage length: %d", length)
+	}
+	if _, err := reader.Discard(int(length) - 4); err != nil {
+		return err
+	}
+
+	// AuthenticationOk
+	if err := writePostgresMessage(conn, 'R', []byte{0, 0, 0, 0}); err != nil {
+		return err
+	}
+	for _, parameter := range [][2]string{
+		{"server_version", "16.0"},
+		{"server_encoding", "UTF8"},
+		{"client_encoding", "UTF8"},
+		{"DateStyle", "ISO, MDY"},
+		{"integer_datetimes", "on"},
+		{"standard_conforming_strings", "on"},
+	} {
+		body := append(append([]byte(parameter[0]), 0), parameter[1]...)
+		if err := writePostgresMessage(conn, 'S', append(body, 0)); err != nil {
+			return err
+		}
+	}
+	if err := writePostgresMessage(conn, 'N', postgresNotice("NOTICE", "00000", STARTTLS_SUCCESS_MARKER)); err != nil {
+		return err
+	}
+	// BackendKeyData
+	if err := writePostgresMessage(conn, 'K', []byte{0, 0, 0, 1, 0, 0, 0, 1}); err != nil {
+		return err
+	}
+	readyForQuery := func() error {
+		return writePostgresMessage(conn, 'Z', []byte{'I'})
+	}
+	if err := readyForQuery(); err != nil {
+		return err
+	}
+
+	for {
+		messageType, err := readPostgresMessage(reader)
+		if err != nil {
+			return err
+		}
+		switch messageType {
+		case 'Q':
+			err = writePostgresMessage(conn, 'I', nil)
+		case 'X':
+			return errClientQuit
+		default:
+			err = writePostgresMessage(conn, 'E', postgresNotice("ERROR", "0A000", "Message type not supported"))
+		}
+		if err != nil {
+			return err
+		}
+		if err = readyForQuery(); err != nil {
+			return err
+		}
+	}
+}
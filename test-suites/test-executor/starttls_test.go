@@ -0,0 +1,360 @@
+package test_executor
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Netflix/bettertls/test-suites/certutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+func newTestHandshaker(t *testing.T) (*handshaker, <-chan *HandshakeTelemetry) {
+	cert, key, err := certutil.GenerateSelfSignedCert("starttls.localhost")
+	require.NoError(t, err)
+	handshakes := make(chan *HandshakeTelemetry, 1)
+	return &handshaker{
+		config: &tls.Config{
+			Certificates:           []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}},
+			SessionTicketsDisabled: true,
+		},
+		onConnect: func(remoteAddr net.Addr) *HandshakeTelemetry {
+			return &HandshakeTelemetry{RemoteAddr: remoteAddr.String()}
+		},
+		onHandshake: func(telemetry *HandshakeTelemetry) {
+			handshakes <- telemetry
+		},
+	}, handshakes
+}
+
+// A startTlsClient plays the client's side of a protocol: negotiate runs it until the server is ready for the TLS
+// handshake, and session runs it over TLS, returning the server's reply that should have STARTTLS_SUCCESS_MARKER.
+type startTlsClient struct {
+	negotiate func(t *testing.T, conn net.Conn, reader *bufio.Reader)
+	session   func(t *testing.T, conn net.Conn, reader *bufio.Reader) string
+}
+
+// A textCommand is a command of a line-based protocol, and the start of the last line of the server's reply.
+type textCommand struct {
+	command string
+	final   string
+}
+
+// sendCommand sends a command (unless it's empty) and returns the lines of the server's reply.
+func sendCommand(t *testing.T, conn net.Conn, reader *bufio.Reader, command textCommand) string {
+	if command.command != "" {
+		_, err := io.WriteString(conn, command.command+"\r\n")
+		require.NoError(t, err)
+	}
+	var reply strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		reply.WriteString(line)
+		if strings.HasPrefix(line, command.final) {
+			return reply.String()
+		}
+	}
+}
+
+// textClient is the client for a line-based protocol. The reply to the first session command should have the marker.
+func textClient(negotiate []textCommand, session []textCommand) startTlsClient {
+	return startTlsClient{
+		negotiate: func(t *testing.T, conn net.Conn, reader *bufio.Reader) {
+			for _, command := range negotiate {
+				sendCommand(t, conn, reader, command)
+			}
+		},
+		session: func(t *testing.T, conn net.Conn, reader *bufio.Reader) string {
+			reply := sendCommand(t, conn, reader, session[0])
+			for _, command := range session[1:] {
+				sendCommand(t, conn, reader, command)
+			}
+			return reply
+		},
+	}
+}
+
+// berElement encodes a BER element with a long-form length, as OpenLDAP does.
+func berElement(tag byte, contents ...[]byte) []byte {
+	body := concat(contents...)
+	element := append([]byte{tag, 0x84}, binary.BigEndian.AppendUint32(nil, uint32(len(body)))...)
+	return append(element, body...)
+}
+
+func ldapMessage(messageId byte, opTag byte, op ...[]byte) []byte {
+	return berElement(0x30, berElement(0x02, []byte{messageId}), berElement(opTag, op...))
+}
+
+var ldapStartTlsRequest = ldapMessage(1, ldapExtendedRequest, berElement(ldapRequestName, []byte(ldapStartTlsOid)))
+
+// An anonymous simple bind
+var ldapAnonymousBind = ldapMessage(2, ldapBindRequest, berElement(0x02, []byte{3}), berElement(0x04), berElement(0x80))
+
+// readLdapResult reads an LDAPResult, checking its messageID and protocolOp.
+func readLdapResult(t *testing.T, reader *bufio.Reader, messageId byte, opTag byte) (resultCode int, diagnosticMessage string, rest cryptobyte.String) {
+	id, tag, op, err := readLdapMessage(reader)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{messageId}, id)
+	assert.Equal(t, opTag, tag)
+	result := cryptobyte.String(op)
+	var matchedDn, message cryptobyte.String
+	require.True(t, result.ReadASN1Enum(&resultCode))
+	require.True(t, result.ReadASN1(&matchedDn, cryptobyte_asn1.OCTET_STRING))
+	require.True(t, result.ReadASN1(&message, cryptobyte_asn1.OCTET_STRING))
+	return resultCode, string(message), result
+}
+
+var ldapClient = startTlsClient{
+	negotiate: func(t *testing.T, conn net.Conn, reader *bufio.Reader) {
+		// A bind is refused until TLS has started
+		_, err := conn.Write(ldapAnonymousBind)
+		require.NoError(t, err)
+		resultCode, _, _ := readLdapResult(t, reader, 2, ldapBindResponse)
+		assert.Equal(t, ldapConfidentialityRequired, resultCode)
+
+		_, err = conn.Write(ldapStartTlsRequest)
+		require.NoError(t, err)
+		resultCode, _, rest := readLdapResult(t, reader, 1, ldapExtendedResponse)
+		assert.Equal(t, ldapSuccess, resultCode)
+		var responseName cryptobyte.String
+		require.True(t, rest.ReadASN1(&responseName, cryptobyte_asn1.Tag(ldapResponseName)))
+		assert.Equal(t, ldapStartTlsOid, string(responseName))
+	},
+	session: func(t *testing.T, conn net.Conn, reader *bufio.Reader) string {
+		_, err := conn.Write(ldapAnonymousBind)
+		require.NoError(t, err)
+		resultCode, diagnosticMessage, _ := readLdapResult(t, reader, 2, ldapBindResponse)
+		assert.Equal(t, ldapSuccess, resultCode)
+		_, err = conn.Write(ldapMessage(3, ldapUnbindRequest))
+		require.NoError(t, err)
+		return diagnosticMessage
+	},
+}
+
+func postgresRequest(code uint32) []byte {
+	return binary.BigEndian.AppendUint32([]byte{0, 0, 0, 8}, code)
+}
+
+var postgresClient = startTlsClient{
+	negotiate: func(t *testing.T, conn net.Conn, reader *bufio.Reader) {
+		for _, exchange := range []struct {
+			code  uint32
+			reply byte
+		}{{postgresGssEncRequest, 'N'}, {postgresSslRequest, 'S'}} {
+			_, err := conn.Write(postgresRequest(exchange.code))
+			require.NoError(t, err)
+			reply, err := reader.ReadByte()
+			require.NoError(t, err)
+			assert.Equal(t, exchange.reply, reply)
+		}
+	},
+	session: func(t *testing.T, conn net.Conn, reader *bufio.Reader) string {
+		parameters := []byte("user\x00bettertls\x00\x00")
+		startup := binary.BigEndian.AppendUint32(nil, uint32(8+len(parameters)))
+		startup = binary.BigEndian.AppendUint32(startup, 3<<16)
+		_, err := conn.Write(append(startup, parameters...))
+		require.NoError(t, err)
+
+		// The notices sent before ReadyForQuery
+		var notices strings.Builder
+		for {
+			var header [5]byte
+			_, err := io.ReadFull(reader, header[:])
+			require.NoError(t, err)
+			body := make([]byte, binary.BigEndian.Uint32(header[1:])-4)
+			_, err = io.ReadFull(reader, body)
+			require.NoError(t, err)
+			if header[0] == 'N' {
+				notices.Write(body)
+			}
+			if header[0] == 'Z' {
+				break
+			}
+		}
+		_, err = conn.Write([]byte{'X', 0, 0, 0, 4})
+		require.NoError(t, err)
+		return notices.String()
+	},
+}
+
+var startTlsClients = map[StartTlsProtocol]startTlsClient{
+	STARTTLS_SMTP: textClient(
+		[]textCommand{{"", "220 "}, {"EHLO test", "250 "}, {"MAIL FROM:<test@test.localhost>", "530 "}, {"STARTTLS", "220 "}},
+		[]textCommand{{"EHLO test", "250 "}, {"QUIT", "221 "}}),
+	STARTTLS_IMAP: textClient(
+		[]textCommand{{"", "* OK"}, {"a CAPABILITY", "a OK"}, {"b LOGIN test test", "b BAD"}, {"c", "* BAD"}, {"c STARTTLS", "c OK"}},
+		[]textCommand{{"d NOOP", "d OK"}, {"e LOGOUT", "e OK"}}),
+	STARTTLS_POP3: textClient(
+		[]textCommand{{"", "+OK"}, {"CAPA", "."}, {"USER test", "-ERR"}, {"STLS", "+OK"}},
+		[]textCommand{{"NOOP", "+OK"}, {"QUIT", "+OK"}}),
+	STARTTLS_LDAP:     ldapClient,
+	STARTTLS_POSTGRES: postgresClient,
+}
+
+func TestStartTls(t *testing.T) {
+	for _, protocol := range ALL_STARTTLS_PROTOCOLS {
+		t.Run(protocol.String(), func(t *testing.T) {
+			client, ok := startTlsClients[protocol]
+			require.True(t, ok)
+			handshaker, handshakes := newTestHandshaker(t)
+			clientConn, serverConn := net.Pipe()
+			defer clientConn.Close()
+			done := make(chan struct{})
+			go func() {
+				handleStartTls(serverConn, protocol, handshaker)
+				close(done)
+			}()
+			clientConn.SetDeadline(time.Now().Add(10 * time.Second))
+
+			client.negotiate(t, clientConn, bufio.NewReader(clientConn))
+			tlsConn := tls.Client(clientConn, &tls.Config{InsecureSkipVerify: true})
+			reply := client.session(t, tlsConn, bufio.NewReader(tlsConn))
+			assert.Contains(t, reply, STARTTLS_SUCCESS_MARKER)
+
+			// The server ends the session, with a close_notify
+			_, err := tlsConn.Read(make([]byte, 1))
+			assert.Equal(t, io.EOF, err)
+			<-done
+			telemetry := <-handshakes
+			assert.True(t, telemetry.HandshakeComplete)
+			assert.Equal(t, protocol.String(), telemetry.StartTls)
+		})
+	}
+}
+
+// A writeRecorder is a connection that only records what's written to it.
+type writeRecorder struct {
+	net.Conn
+	written bytes.Buffer
+}
+
+func (c *writeRecorder) Write(b []byte) (int, error) {
+	return c.written.Write(b)
+}
+
+func negotiateInput(protocol StartTlsProtocol, input []byte) (string, error) {
+	conn := &writeRecorder{}
+	err := protocol.negotiate(conn, bufio.NewReaderSize(bytes.NewReader(input), maxStartTlsMessageLength))
+	return conn.written.String(), err
+}
+
+func TestNegotiateStartTlsMalformed(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		protocol StartTlsProtocol
+		input    []byte
+	}{
+		{"SMTP empty", STARTTLS_SMTP, nil},
+		{"SMTP truncated", STARTTLS_SMTP, []byte("EHLO test\r\nSTART")},
+		{"SMTP line too long", STARTTLS_SMTP, bytes.Repeat([]byte("A"), maxStartTlsMessageLength+1)},
+		{"IMAP truncated", STARTTLS_IMAP, []byte("a STARTTLS")},
+		{"POP3 truncated", STARTTLS_POP3, []byte("STL")},
+		{"LDAP empty", STARTTLS_LDAP, nil},
+		{"LDAP not a SEQUENCE", STARTTLS_LDAP, []byte{0x31, 0x03, 0x02, 0x01, 0x01}},
+		{"LDAP indefinite length", STARTTLS_LDAP, []byte{0x30, 0x80, 0x02, 0x01, 0x01, 0x00, 0x00}},
+		{"LDAP length of length too long", STARTTLS_LDAP, []byte{0x30, 0x85, 0x00, 0x00, 0x00, 0x00, 0x03}},
+		{"LDAP too long", STARTTLS_LDAP, []byte{0x30, 0x84, 0x00, 0x01, 0x00, 0x00}},
+		{"LDAP truncated length", STARTTLS_LDAP, []byte{0x30, 0x82, 0x00}},
+		{"LDAP truncated message", STARTTLS_LDAP, []byte{0x30, 0x05, 0x02, 0x01, 0x01}},
+		{"LDAP truncated StartTLS request", STARTTLS_LDAP, ldapStartTlsRequest[:len(ldapStartTlsRequest)-1]},
+		{"LDAP no messageID", STARTTLS_LDAP, []byte{0x30, 0x03, 0x04, 0x01, 0x01}},
+		{"LDAP truncated messageID", STARTTLS_LDAP, []byte{0x30, 0x03, 0x02, 0x05, 0x01}},
+		{"LDAP truncated messageID length", STARTTLS_LDAP, []byte{0x30, 0x02, 0x02, 0x81}},
+		{"LDAP no protocolOp", STARTTLS_LDAP, []byte{0x30, 0x03, 0x02, 0x01, 0x01}},
+		{"LDAP truncated protocolOp", STARTTLS_LDAP, []byte{0x30, 0x05, 0x02, 0x01, 0x01, 0x77, 0x05}},
+		{"LDAP truncated requestName", STARTTLS_LDAP, []byte{0x30, 0x07, 0x02, 0x01, 0x01, 0x77, 0x02, 0x80, 0x05}},
+		{"LDAP unsupported operation", STARTTLS_LDAP, []byte{0x30, 0x05, 0x02, 0x01, 0x01, 0x66, 0x00}},
+		{"Postgres truncated", STARTTLS_POSTGRES, postgresRequest(postgresSslRequest)[:7]},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := negotiateInput(test.protocol, test.input)
+			assert.Error(t, err)
+			assert.NotEqual(t, errClientQuit, err)
+		})
+	}
+}
+
+func TestNegotiateStartTlsQuit(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		protocol StartTlsProtocol
+		input    string
+		reply    string
+	}{
+		{"SMTP", STARTTLS_SMTP, "QUIT\r\n", "221 Bye\r\n"},
+		{"IMAP", STARTTLS_IMAP, "a LOGOUT\r\n", "a OK LOGOUT completed\r\n"},
+		{"POP3", STARTTLS_POP3, "QUIT\r\n", "+OK Bye\r\n"},
+		{"LDAP", STARTTLS_LDAP, string(ldapMessage(1, ldapUnbindRequest)), ""},
+		// Anything other than an SSLRequest or a GSSENCRequest
+		{"Postgres", STARTTLS_POSTGRES, string(postgresRequest(196608)), "SSL is required"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			written, err := negotiateInput(test.protocol, []byte(test.input))
+			assert.Equal(t, errClientQuit, err)
+			assert.Contains(t, written, test.reply)
+		})
+	}
+}
+
+func TestNegotiateLdapUnsupportedExtendedOperation(t *testing.T) {
+	// The "Who am I?" operation is refused, and then the client disconnects
+	written, err := negotiateInput(STARTTLS_LDAP, ldapMessage(1, ldapExtendedRequest, berElement(ldapRequestName, []byte("1.3.6.1.4.1.4203.1.11.3"))))
+	assert.Equal(t, io.EOF, err)
+	resultCode, diagnosticMessage, _ := readLdapResult(t, bufio.NewReader(strings.NewReader(written)), 1, ldapExtendedResponse)
+	assert.Equal(t, ldapProtocolError, resultCode)
+	assert.Equal(t, "Unsupported extended operation", diagnosticMessage)
+}
+
+func TestParseBerLength(t *testing.T) {
+	for _, test := range []struct {
+		encoding []byte
+		length   int
+	}{
+		{[]byte{0x05}, 5},
+		{[]byte{0x7f}, 127},
+		// Long forms, which needn't be minimal
+		{[]byte{0x81, 0x05}, 5},
+		{[]byte{0x84, 0x00, 0x00, 0x00, 0x05}, 5},
+		{[]byte{0x82, 0x10, 0x00}, maxStartTlsMessageLength},
+	} {
+		length, err := parseBerLength(bytes.NewReader(test.encoding).ReadByte)
+		assert.NoError(t, err, "%x", test.encoding)
+		assert.Equal(t, test.length, length, "%x", test.encoding)
+	}
+
+	for _, encoding := range [][]byte{
+		nil,
+		// Indefinite
+		{0x80},
+		{0x85, 0x00, 0x00, 0x00, 0x00, 0x05},
+		{0x82, 0x10, 0x01},
+		{0x84, 0xff, 0xff, 0xff, 0xff},
+		{0x82, 0x01},
+	} {
+		_, err := parseBerLength(bytes.NewReader(encoding).ReadByte)
+		assert.Error(t, err, "%x", encoding)
+	}
+}
+
+func TestParseBerElement(t *testing.T) {
+	tag, contents, rest, err := parseBerElement([]byte{0x04, 0x82, 0x00, 0x02, 'o', 'k', 0x05, 0x00})
+	require.NoError(t, err)
+	assert.Equal(t, byte(0x04), tag)
+	assert.Equal(t, []byte("ok"), contents)
+	assert.Equal(t, []byte{0x05, 0x00}, rest)
+
+	for _, encoding := range [][]byte{nil, {0x04}, {0x04, 0x02, 'o'}, {0x04, 0x81}} {
+		_, _, _, err := parseBerElement(encoding)
+		assert.Error(t, err, "%x", encoding)
+	}
+}
@@ -4,10 +4,18 @@ import (
 	"crypto"
 	"crypto/tls"
 	"crypto/x509"
+	"github.com/Netflix/bettertls/test-suites/aia"
 	"github.com/Netflix/bettertls/test-suites/certutil"
+	"github.com/Netflix/bettertls/test-suites/idn"
+	"github.com/Netflix/bettertls/test-suites/injection"
+	"github.com/Netflix/bettertls/test-suites/namechaining"
 	"github.com/Netflix/bettertls/test-suites/nameconstraints"
 	"github.com/Netflix/bettertls/test-suites/pathbuilding"
+	"github.com/Netflix/bettertls/test-suites/pathcomplexity"
+	"github.com/Netflix/bettertls/test-suites/possession"
+	"github.com/Netflix/bettertls/test-suites/spiffe"
 	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+	"github.com/Netflix/bettertls/test-suites/trustanchor"
 )
 
 type TestSuites struct {
@@ -38,7 +46,19 @@ func (ts *TestSuites) GetProvider(name string) test_case.TestCaseProvider {
 }
 
 func (ts *TestSuites) GetTestCaseCertificates(testCase test_case.TestCase) (*tls.Certificate, error) {
-	return testCase.GetCertificates(ts.rootCert, ts.rootKey)
+	artifacts, err := ts.GetTestCaseArtifacts(testCase, test_case.DEFAULT_AIA_BASE_URL)
+	if err != nil {
+		return nil, err
+	}
+	return artifacts.Certificate, nil
+}
+
+func (ts *TestSuites) GetTestCaseArtifacts(testCase test_case.TestCase, aiaBaseUrl string) (*test_case.Artifacts, error) {
+	return test_case.GetArtifacts(testCase, &test_case.Environment{
+		RootCert:   ts.rootCert,
+		RootKey:    ts.rootKey,
+		AiaBaseUrl: aiaBaseUrl,
+	})
 }
 
 func BuildTestSuites() (*TestSuites, error) {
@@ -56,6 +76,14 @@ func BuildTestSuitesWithRootCa(rootCert *x509.Certificate, rootKey crypto.Signer
 		providers: []test_case.TestCaseProvider{
 			nameconstraints.NewTestCaseProvider(),
 			pathbuilding.NewTestCaseProvider(),
+			pathcomplexity.NewTestCaseProvider(),
+			aia.NewTestCaseProvider(),
+			trustanchor.NewTestCaseProvider(),
+			idn.NewTestCaseProvider(),
+			injection.NewTestCaseProvider(),
+			spiffe.NewTestCaseProvider(),
+			namechaining.NewTestCaseProvider(),
+			possession.NewTestCaseProvider(),
 		},
 	}, nil
 }
@@ -0,0 +1,343 @@
+package test_executor
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// How long a client has to complete a handshake before the server gives up on it
+const handshakeTimeout = 10 * time.Second
+
+// HandshakeTelemetry is what the test server saw of a single TLS connection.
+type HandshakeTelemetry struct {
+	// The test that was active when the client connected
+	Suite      string `json:"suite"`
+	TestCase   uint   `json:"testCase"`
+	RemoteAddr string `json:"remoteAddr"`
+	// The STARTTLS protocol (e.g. "smtp") the connection was upgraded from, if any
+	StartTls string `json:"startTls,omitempty"`
+	// Whether this was a QUIC connection rather than TLS over TCP
+	Quic bool `json:"quic,omitempty"`
+	// The host and port the client asked the CONNECT proxy for, if it connected through the proxy
+	ProxyTarget string `json:"proxyTarget,omitempty"`
+	// Details of the ClientHello, if the client got as far as sending one
+	ServerName        string   `json:"serverName,omitempty"`
+	SupportedVersions []string `json:"supportedVersions,omitempty"`
+	SignatureSchemes  []string `json:"signatureSchemes,omitempty"`
+	// The signature_algorithms_cert extension, which clients send when they accept different signature algorithms in
+	// certificates than in the handshake
+	SignatureSchemesCert []string `json:"signatureSchemesCert,omitempty"`
+	Alpn                 []string `json:"alpn,omitempty"`
+	HandshakeComplete    bool     `json:"handshakeComplete"`
+	// The alert the client sent to abort the handshake, such as bad_certificate or unknown_ca
+	ClientAlert *TlsAlert `json:"clientAlert,omitempty"`
+	// Why the handshake failed, if it did. Includes alerts sent by the client and by the server.
+	Error string `json:"error,omitempty"`
+
+	// The Server's testGeneration when the client connected
+	generation uint64
+}
+
+// A TlsAlert is the description of a TLS alert, as in RFC 8446 section 6.
+type TlsAlert uint8
+
+var tlsAlertNames = map[TlsAlert]string{
+	0:   "close_notify",
+	10:  "unexpected_message",
+	20:  "bad_record_mac",
+	21:  "decryption_failed",
+	22:  "record_overflow",
+	30:  "decompression_failure",
+	40:  "handshake_failure",
+	41:  "no_certificate",
+	42:  "bad_certificate",
+	43:  "unsupported_certificate",
+	44:  "certificate_revoked",
+	45:  "certificate_expired",
+	46:  "certificate_unknown",
+	47:  "illegal_parameter",
+	48:  "unknown_ca",
+	49:  "access_denied",
+	50:  "decode_error",
+	51:  "decrypt_error",
+	60:  "export_restriction",
+	70:  "protocol_version",
+	71:  "insufficient_security",
+	80:  "internal_error",
+	86:  "inappropriate_fallback",
+	90:  "user_canceled",
+	100: "no_renegotiation",
+	109: "missing_extension",
+	110: "unsupported_extension",
+	111: "certificate_unobtainable",
+	112: "unrecognized_name",
+	113: "bad_certificate_status_response",
+	114: "bad_certificate_hash_value",
+	115: "unknown_psk_identity",
+	116: "certificate_required",
+	120: "no_application_protocol",
+}
+
+func (a TlsAlert) String() string {
+	if name, ok := tlsAlertNames[a]; ok {
+		return name
+	}
+	// Alerts come from the client, so this can't panic like the other enums
+	return fmt.Sprintf("alert_%d", uint8(a))
+}
+func (a TlsAlert) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// getClientAlert returns the alert the client sent, if that's what ended a handshake. crypto/tls reports these as a
+// net.OpError wrapping its (unexported) alert type, which is a uint8.
+func getClientAlert(err error) *TlsAlert {
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || opErr.Op != "remote error" || opErr.Err == nil {
+		return nil
+	}
+	value := reflect.ValueOf(opErr.Err)
+	if value.Kind() != reflect.Uint8 {
+		return nil
+	}
+	alert := TlsAlert(value.Uint())
+	return &alert
+}
+
+// getPlaintextAlert returns the first unencrypted alert in the records a client sent. Some clients (like OpenSSL) abort
+// a TLS 1.3 handshake before switching to handshake keys, so their alert can't be decrypted and crypto/tls reports a
+// bad_record_mac instead.
+func getPlaintextAlert(records []byte) *TlsAlert {
+	input := cryptobyte.String(records)
+	for !input.Empty() {
+		var contentType uint8
+		var fragment cryptobyte.String
+		if !input.ReadUint8(&contentType) || !input.Skip(2) || !input.ReadUint16LengthPrefixed(&fragment) {
+			return nil
+		}
+		// Encrypted alerts are longer than the level and description
+		if contentType == recordTypeAlert && len(fragment) == 2 {
+			alert := TlsAlert(fragment[1])
+			return &alert
+		}
+	}
+	return nil
+}
+
+const (
+	recordTypeAlert                  = 21
+	recordTypeHandshake              = 22
+	handshakeTypeClientHello         = 1
+	extensionSignatureAlgorithmsCert = 50
+)
+
+// parseSignatureSchemesCert returns the signature_algorithms_cert extension of a ClientHello, given the records it was
+// sent in. crypto/tls doesn't expose this extension in tls.ClientHelloInfo.
+func parseSignatureSchemesCert(records []byte) []tls.SignatureScheme {
+	var handshake []byte
+	input := cryptobyte.String(records)
+	for {
+		if len(handshake) >= 4 {
+			length := int(handshake[1])<<16 | int(handshake[2])<<8 | int(handshake[3])
+			if len(handshake) >= 4+length {
+				break
+			}
+		}
+		var contentType uint8
+		var fragment cryptobyte.String
+		if !input.ReadUint8(&contentType) || contentType != recordTypeHandshake || !input.Skip(2) ||
+			!input.ReadUint16LengthPrefixed(&fragment) {
+			return nil
+		}
+		handshake = append(handshake, fragment...)
+	}
+
+	msg := cryptobyte.String(handshake)
+	var msgType uint8
+	var clientHello, sessionId, cipherSuites, compressionMethods, extensions cryptobyte.String
+	if !msg.ReadUint8(&msgType) || msgType != handshakeTypeClientHello || !msg.ReadUint24LengthPrefixed(&clientHello) ||
+		// Version and random
+		!clientHello.Skip(2+32) ||
+		!clientHello.ReadUint8LengthPrefixed(&sessionId) ||
+		!clientHello.ReadUint16LengthPrefixed(&cipherSuites) ||
+		!clientHello.ReadUint8LengthPrefixed(&compressionMethods) ||
+		!clientHello.ReadUint16LengthPrefixed(&extensions) {
+		return nil
+	}
+	for !extensions.Empty() {
+		var extensionType uint16
+		var data, schemeList cryptobyte.String
+		if !extensions.ReadUint16(&extensionType) || !extensions.ReadUint16LengthPrefixed(&data) {
+			return nil
+		}
+		if extensionType != extensionSignatureAlgorithmsCert {
+			continue
+		}
+		if !data.ReadUint16LengthPrefixed(&schemeList) {
+			return nil
+		}
+		var schemes []tls.SignatureScheme
+		for !schemeList.Empty() {
+			var scheme uint16
+			if !schemeList.ReadUint16(&scheme) {
+				return nil
+			}
+			schemes = append(schemes, tls.SignatureScheme(scheme))
+		}
+		return schemes
+	}
+	return nil
+}
+
+func signatureSchemeNames(schemes []tls.SignatureScheme) []string {
+	var names []string
+	for _, scheme := range schemes {
+		names = append(names, scheme.String())
+	}
+	return names
+}
+
+// A telemetryConn is the connection underneath a tls.Conn. It keeps what the client sends during the handshake.
+type telemetryConn struct {
+	net.Conn
+	telemetry *HandshakeTelemetry
+	recording bool
+	received  bytes.Buffer
+}
+
+func (c *telemetryConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if c.recording {
+		c.received.Write(b[:n])
+	}
+	return n, err
+}
+
+// recordClientHello is called (from the handshake's goroutine) once a ClientHello has been read, with the records it
+// was sent in if they're available.
+func (t *HandshakeTelemetry) recordClientHello(info *tls.ClientHelloInfo, records []byte) {
+	t.ServerName = info.ServerName
+	for _, version := range info.SupportedVersions {
+		t.SupportedVersions = append(t.SupportedVersions, tls.VersionName(version))
+	}
+	t.SignatureSchemes = signatureSchemeNames(info.SignatureSchemes)
+	t.SignatureSchemesCert = signatureSchemeNames(parseSignatureSchemesCert(records))
+	t.Alpn = info.SupportedProtos
+}
+
+// recordClientHello records a ClientHello in the telemetry of the connection it arrived on, whether that's a TCP
+// connection or a QUIC connection.
+func recordClientHello(info *tls.ClientHelloInfo) {
+	if conn, ok := info.Conn.(*telemetryConn); ok {
+		conn.telemetry.recordClientHello(info, conn.received.Bytes())
+	} else if handshake := getQuicHandshake(info.Context()); handshake != nil {
+		// QUIC carries the ClientHello in CRYPTO frames rather than records
+		handshake.telemetry.recordClientHello(info, nil)
+	}
+}
+
+// A handshaker completes TLS handshakes for the server, recording how each one went.
+type handshaker struct {
+	config *tls.Config
+	// Called when a handshake starts, and again once it has finished
+	onConnect   func(remoteAddr net.Addr) *HandshakeTelemetry
+	onHandshake func(telemetry *HandshakeTelemetry)
+}
+
+// handshake completes the TLS handshake on a connection, which is closed if it fails. annotate, if not nil, adds how
+// the connection got to the handshake (e.g. through STARTTLS) to its telemetry.
+func (h *handshaker) handshake(conn net.Conn, annotate func(telemetry *HandshakeTelemetry)) (*tls.Conn, error) {
+	telemetry := h.onConnect(conn.RemoteAddr())
+	if annotate != nil {
+		annotate(telemetry)
+	}
+	recordingConn := &telemetryConn{Conn: conn, telemetry: telemetry, recording: true}
+	tlsConn := tls.Server(recordingConn, h.config)
+
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	err := tlsConn.HandshakeContext(ctx)
+	cancel()
+	recordingConn.recording = false
+	if err != nil {
+		telemetry.ClientAlert = getClientAlert(err)
+		if telemetry.ClientAlert == nil {
+			telemetry.ClientAlert = getPlaintextAlert(recordingConn.received.Bytes())
+		}
+		telemetry.Error = err.Error()
+	} else {
+		telemetry.HandshakeComplete = true
+	}
+	recordingConn.received = bytes.Buffer{}
+	h.onHandshake(telemetry)
+	if err != nil {
+		tlsConn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// A telemetryListener completes the TLS handshake of each connection before the HTTP server sees it, so that the
+// server can record how every handshake went, including the ones that fail.
+type telemetryListener struct {
+	net.Listener
+	handshaker *handshaker
+
+	conns chan net.Conn
+	done  chan struct{}
+	err   error
+}
+
+func newTelemetryListener(inner net.Listener, handshaker *handshaker) *telemetryListener {
+	l := &telemetryListener{
+		Listener:   inner,
+		handshaker: handshaker,
+		conns:      make(chan net.Conn),
+		done:       make(chan struct{}),
+	}
+	go l.acceptLoop()
+	return l
+}
+
+func (l *telemetryListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.err = err
+			close(l.done)
+			return
+		}
+		go l.handshake(conn, nil)
+	}
+}
+
+// handshake completes the TLS handshake on a connection and passes it to the HTTP server. Besides connections to the
+// listener itself, it's used for connections tunneled through the CONNECT proxy.
+func (l *telemetryListener) handshake(conn net.Conn, annotate func(telemetry *HandshakeTelemetry)) {
+	tlsConn, err := l.handshaker.handshake(conn, annotate)
+	if err != nil {
+		return
+	}
+	select {
+	case l.conns <- tlsConn:
+	case <-l.done:
+		tlsConn.Close()
+	}
+}
+
+func (l *telemetryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
@@ -0,0 +1,154 @@
+package test_executor
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+func buildExtension(b *cryptobyte.Builder, extensionType uint16, schemes []tls.SignatureScheme) {
+	b.AddUint16(extensionType)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			for _, scheme := range schemes {
+				b.AddUint16(uint16(scheme))
+			}
+		})
+	})
+}
+
+// buildClientHello builds a ClientHello handshake message with a signature_algorithms extension, and a
+// signature_algorithms_cert extension if certSchemes isn't nil.
+func buildClientHello(t *testing.T, certSchemes []tls.SignatureScheme) []byte {
+	var b cryptobyte.Builder
+	b.AddUint8(handshakeTypeClientHello)
+	b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint16(tls.VersionTLS12)
+		b.AddBytes(make([]byte, 32))
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(make([]byte, 32))
+		})
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint16(tls.TLS_AES_128_GCM_SHA256)
+		})
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint8(0)
+		})
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			buildExtension(b, 13, []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256, tls.PSSWithSHA256})
+			if certSchemes != nil {
+				buildExtension(b, extensionSignatureAlgorithmsCert, certSchemes)
+			}
+		})
+	})
+	msg, err := b.Bytes()
+	require.NoError(t, err)
+	return msg
+}
+
+func buildRecord(contentType uint8, fragment []byte) []byte {
+	record := []byte{contentType, 0x03, 0x01, byte(len(fragment) >> 8), byte(len(fragment))}
+	return append(record, fragment...)
+}
+
+func concat(parts ...[]byte) []byte {
+	var result []byte
+	for _, part := range parts {
+		result = append(result, part...)
+	}
+	return result
+}
+
+func TestParseSignatureSchemesCert(t *testing.T) {
+	certSchemes := []tls.SignatureScheme{tls.PKCS1WithSHA256, tls.ECDSAWithP384AndSHA384}
+	clientHello := buildClientHello(t, certSchemes)
+
+	assert.Equal(t, certSchemes, parseSignatureSchemesCert(buildRecord(recordTypeHandshake, clientHello)))
+
+	// A ClientHello split across records
+	split := concat(buildRecord(recordTypeHandshake, clientHello[:10]), buildRecord(recordTypeHandshake, clientHello[10:]))
+	assert.Equal(t, certSchemes, parseSignatureSchemesCert(split))
+
+	// Records after the ClientHello are ignored
+	withAlert := concat(buildRecord(recordTypeHandshake, clientHello), buildRecord(recordTypeAlert, []byte{2, 48}))
+	assert.Equal(t, certSchemes, parseSignatureSchemesCert(withAlert))
+}
+
+func TestParseSignatureSchemesCertMissingOrMalformed(t *testing.T) {
+	clientHello := buildClientHello(t, []tls.SignatureScheme{tls.PKCS1WithSHA256})
+	record := buildRecord(recordTypeHandshake, clientHello)
+
+	for name, records := range map[string][]byte{
+		"no extension":       buildRecord(recordTypeHandshake, buildClientHello(t, nil)),
+		"empty":              nil,
+		"truncated header":   record[:3],
+		"truncated record":   record[:len(record)-1],
+		"truncated message":  buildRecord(recordTypeHandshake, clientHello[:len(clientHello)-1]),
+		"not handshake":      buildRecord(recordTypeAlert, clientHello),
+		"not a ClientHello":  buildRecord(recordTypeHandshake, concat([]byte{2}, clientHello[1:])),
+		"split then garbage": concat(buildRecord(recordTypeHandshake, clientHello[:10]), []byte{0xff}),
+	} {
+		assert.Nil(t, parseSignatureSchemesCert(records), name)
+	}
+}
+
+func TestGetPlaintextAlert(t *testing.T) {
+	clientHello := buildRecord(recordTypeHandshake, buildClientHello(t, nil))
+
+	alert := getPlaintextAlert(concat(clientHello, buildRecord(recordTypeAlert, []byte{2, 48})))
+	require.NotNil(t, alert)
+	assert.Equal(t, "unknown_ca", alert.String())
+
+	// The first alert is the one that counts
+	alert = getPlaintextAlert(concat(buildRecord(recordTypeAlert, []byte{2, 42}), buildRecord(recordTypeAlert, []byte{1, 0})))
+	require.NotNil(t, alert)
+	assert.Equal(t, "bad_certificate", alert.String())
+
+	alert = getPlaintextAlert(buildRecord(recordTypeAlert, []byte{2, 200}))
+	require.NotNil(t, alert)
+	assert.Equal(t, "alert_200", alert.String())
+}
+
+func TestGetPlaintextAlertWithoutAlert(t *testing.T) {
+	clientHello := buildRecord(recordTypeHandshake, buildClientHello(t, nil))
+	alertRecord := buildRecord(recordTypeAlert, []byte{2, 48})
+
+	for name, records := range map[string][]byte{
+		"empty":     nil,
+		"no alert":  clientHello,
+		"encrypted": concat(clientHello, buildRecord(recordTypeAlert, make([]byte, 19))),
+		"truncated": concat(clientHello, alertRecord[:len(alertRecord)-1]),
+		"misframed": concat(clientHello[:len(clientHello)-1], alertRecord),
+	} {
+		assert.Nil(t, getPlaintextAlert(records), name)
+	}
+}
+
+func TestTelemetryIsResetWhenTestIsSet(t *testing.T) {
+	server := &Server{}
+	server.handshakeDone = sync.NewCond(&server.lock)
+	remoteAddr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234}
+
+	server.SetTest("suite", 1)
+	server.finishHandshake(server.startHandshake(remoteAddr))
+	earlier := server.startHandshake(remoteAddr)
+	require.Len(t, server.telemetry, 1)
+
+	// Setting the same test again starts a new window, which doesn't include the handshake in progress
+	server.SetTest("suite", 1)
+	server.finishHandshake(earlier)
+	assert.Empty(t, server.Telemetry())
+
+	later := server.startHandshake(remoteAddr)
+	later.HandshakeComplete = true
+	server.finishHandshake(later)
+	suite, testCase, telemetry := server.currentTelemetry()
+	assert.Equal(t, "suite", suite)
+	assert.Equal(t, uint(1), testCase)
+	assert.Equal(t, []*HandshakeTelemetry{later}, telemetry)
+}
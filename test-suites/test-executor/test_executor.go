@@ -1,9 +1,15 @@
 package test_executor
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	int_set "github.com/Netflix/bettertls/test-suites/int-set"
 	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
 )
 
 type ExecutionContext struct {
@@ -13,38 +19,238 @@ type ExecutionContext struct {
 	OnFinishSuite func(suite string)
 	RunOnlySuite  string
 	RunOnlyTests  *int_set.IntSet
+	// For runners that connect to the test server: where the server logs TLS secrets (in the NSS key log format), and
+	// the directory to save a pcapng capture of each test whose result disagrees with the manifest to
+	KeyLogWriter io.Writer
+	CaptureDir   string
 }
 
 func ExecuteAllTestsLocal(ctx *ExecutionContext, suites *TestSuites, execTest func(hostname string, certificates [][]byte) (bool, error)) (map[string]*SuiteTestResults, error) {
-	return executeAllTests(ctx, suites, func(index uint, provider test_case.TestCaseProvider, testCase test_case.TestCase) (bool, error) {
-		certs, err := testCase.GetCertificates(suites.rootCert, suites.rootKey)
+	return ExecuteAllTestsLocalTargets(ctx, suites, func(target *LocalTestTarget) (bool, error) {
+		return execTest(target.Hostname, target.Artifacts.Certificate.Certificate)
+	})
+}
+
+// A LocalTestTarget is a test case for a client that verifies the certificates itself, without a TLS handshake.
+type LocalTestTarget struct {
+	Hostname string
+	// The artifacts for the test case. Clients should verify Artifacts.Certificate.Certificate (leaf first) against
+	// Artifacts.TrustAnchors, with Artifacts.Intermediates as untrusted intermediates. Artifacts.AiaResources are served
+	// at the caIssuers URLs in the chain while the test runs.
+	Artifacts *test_case.Artifacts
+}
+
+// ExecuteAllTestsLocalTargets runs every suite that can be run without a TLS handshake.
+func ExecuteAllTestsLocalTargets(ctx *ExecutionContext, suites *TestSuites, execTest func(target *LocalTestTarget) (bool, error)) (map[string]*SuiteTestResults, error) {
+	// Nothing connects to the server's TLS listener, but it serves each test case's AIA resources, and the caIssuers
+	// URLs in the certificates point at it
+	server, err := StartServerWithOptions(context.Background(), suites, &ServerOptions{BindAddress: "127.0.0.1"})
+	if err != nil {
+		return nil, err
+	}
+	defer server.Stop()
+
+	return executeAllTests(ctx, suites, clientCapabilities{}, func(index uint, provider test_case.TestCaseProvider, testCase test_case.TestCase) (bool, error) {
+		server.SetTest(provider.Name(), index)
+		artifacts, err := server.getArtifacts()
 		if err != nil {
 			return false, err
 		}
-		return execTest(testCase.GetHostname(), certs.Certificate)
+		return execTest(&LocalTestTarget{
+			Hostname:  testCase.GetHostname(),
+			Artifacts: artifacts,
+		})
 	})
 }
 
 func ExecuteAllTestsRemote(ctx *ExecutionContext, suites *TestSuites, execTest func(hostname string, port uint) (bool, error)) (map[string]*SuiteTestResults, error) {
-	server, err := StartServer(suites, noplog, 0, 0)
+	return ExecuteAllTestsRemoteTargets(ctx, suites, func(target *RemoteTestTarget) (bool, error) {
+		return execTest(target.Hostname, target.Port)
+	})
+}
+
+// A RemoteTestTarget is a test case being hosted by the test server.
+type RemoteTestTarget struct {
+	Hostname string
+	Port     uint
+	// If set, the client should verify that the server has this URI SAN (e.g. a SPIFFE ID) instead of verifying
+	// Hostname. Only set for runners using ExecuteAllTestsRemoteUriTargets.
+	UriIdentity string
+	// The artifacts being served for the test case. Clients should trust Artifacts.TrustAnchors.
+	Artifacts *test_case.Artifacts
+	// An HTTP CONNECT proxy (e.g. for curl -x or HTTPS_PROXY) that tunnels connections for any host to the server's TLS
+	// listener, for clients that need Hostname to resolve
+	ProxyUrl string
+	// Returns what the server saw of the client's connections for this test case, e.g. which alert it sent when it
+	// rejected the chain. Call it after the client is done.
+	Telemetry func() []*HandshakeTelemetry
+}
+
+// ExecuteAllTestsRemoteTargets runs every suite whose test cases are verified by hostname.
+func ExecuteAllTestsRemoteTargets(ctx *ExecutionContext, suites *TestSuites, execTest func(target *RemoteTestTarget) (bool, error)) (map[string]*SuiteTestResults, error) {
+	return executeAllTestsRemoteTargets(ctx, suites, clientCapabilities{performsHandshake: true}, &ServerOptions{}, (*Server).TlsPort, execTest)
+}
+
+// ExecuteAllTestsRemoteUriTargets is like ExecuteAllTestsRemoteTargets, for clients that can also verify a server by
+// URI identity. It additionally runs the suites whose test cases set RemoteTestTarget.UriIdentity.
+func ExecuteAllTestsRemoteUriTargets(ctx *ExecutionContext, suites *TestSuites, execTest func(target *RemoteTestTarget) (bool, error)) (map[string]*SuiteTestResults, error) {
+	return executeAllTestsRemoteTargets(ctx, suites, clientCapabilities{performsHandshake: true, verifiesUriIdentity: true}, &ServerOptions{}, (*Server).TlsPort, execTest)
+}
+
+// ExecuteAllTestsRemoteStartTlsTargets is like ExecuteAllTestsRemoteTargets, for clients that connect with a STARTTLS
+// protocol. RemoteTestTarget.Port is the port of the server's listener for that protocol.
+func ExecuteAllTestsRemoteStartTlsTargets(ctx *ExecutionContext, suites *TestSuites, protocol StartTlsProtocol, execTest func(target *RemoteTestTarget) (bool, error)) (map[string]*SuiteTestResults, error) {
+	options := &ServerOptions{StartTlsPorts: map[StartTlsProtocol]uint16{protocol: 0}}
+	return executeAllTestsRemoteTargets(ctx, suites, clientCapabilities{performsHandshake: true}, options, func(server *Server) int {
+		return server.StartTlsPort(protocol)
+	}, execTest)
+}
+
+// ExecuteAllTestsRemoteGrpcTargets is like ExecuteAllTestsRemoteTargets, for gRPC clients. The server offers HTTP/2
+// and answers health checks (grpc.health.v1.Health/Check) with SERVING.
+func ExecuteAllTestsRemoteGrpcTargets(ctx *ExecutionContext, suites *TestSuites, execTest func(target *RemoteTestTarget) (bool, error)) (map[string]*SuiteTestResults, error) {
+	return executeAllTestsRemoteTargets(ctx, suites, clientCapabilities{performsHandshake: true}, &ServerOptions{Http2: true}, (*Server).TlsPort, execTest)
+}
+
+// ExecuteAllTestsRemoteQuicTargets is like ExecuteAllTestsRemoteTargets, for HTTP/3 clients. RemoteTestTarget.Port is
+// the UDP port serving HTTP/3.
+func ExecuteAllTestsRemoteQuicTargets(ctx *ExecutionContext, suites *TestSuites, execTest func(target *RemoteTestTarget) (bool, error)) (map[string]*SuiteTestResults, error) {
+	return executeAllTestsRemoteTargets(ctx, suites, clientCapabilities{performsHandshake: true}, &ServerOptions{Quic: true}, (*Server).QuicPort, execTest)
+}
+
+// executeAllTestsRemoteTargets starts a server with the given options and runs each test case against it, with the
+// port given by getPort.
+func executeAllTestsRemoteTargets(ctx *ExecutionContext, suites *TestSuites, capabilities clientCapabilities, options *ServerOptions, getPort func(server *Server) int, execTest func(target *RemoteTestTarget) (bool, error)) (map[string]*SuiteTestResults, error) {
+	if ctx != nil && ctx.KeyLogWriter != nil {
+		options.TlsConfig = &tls.Config{KeyLogWriter: ctx.KeyLogWriter}
+	}
+	// Only TCP traffic is recorded
+	capture := ctx != nil && ctx.CaptureDir != "" && !options.Quic
+	options.CaptureTraffic = capture
+	if capture {
+		if err := os.MkdirAll(ctx.CaptureDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	server, err := StartServerWithOptions(context.Background(), suites, options)
 	if err != nil {
 		return nil, err
 	}
 	defer server.Stop()
+	port := getPort(server)
 
-	return executeAllTests(ctx, suites, func(index uint, provider test_case.TestCaseProvider, testCase test_case.TestCase) (bool, error) {
+	return executeAllTests(ctx, suites, capabilities, func(index uint, provider test_case.TestCaseProvider, testCase test_case.TestCase) (bool, error) {
 		server.SetTest(provider.Name(), index)
-		return execTest(testCase.GetHostname(), uint(server.tlsPort))
+		artifacts, err := server.getArtifacts()
+		if err != nil {
+			return false, err
+		}
+		target := &RemoteTestTarget{
+			Hostname:  testCase.GetHostname(),
+			Port:      uint(port),
+			Artifacts: artifacts,
+			ProxyUrl:  server.ProxyUrl(),
+			Telemetry: server.Telemetry,
+		}
+		// Suites verified by hostname can still have some test cases verified by URI identity, which other runners
+		// verify by hostname instead
+		if capabilities.verifiesUriIdentity {
+			target.UriIdentity = test_case.GetUriIdentity(testCase)
+		}
+		accepted, err := execTest(target)
+		if err != nil || !capture {
+			return accepted, err
+		}
+		result := TestCaseResult_REJECTED
+		if accepted {
+			result = TestCaseResult_ACCEPTED
+		}
+		if !resultMatchesExpected(result, testCase.ExpectedResult()) {
+			if err := saveCapture(server, filepath.Join(ctx.CaptureDir, fmt.Sprintf("%s_%d.pcapng", provider.Name(), index))); err != nil {
+				return accepted, err
+			}
+		}
+		return accepted, nil
 	})
 }
 
-func executeAllTests(ctx *ExecutionContext, suites *TestSuites, execTest func(index uint, provider test_case.TestCaseProvider, testCase test_case.TestCase) (bool, error)) (map[string]*SuiteTestResults, error) {
+func saveCapture(server *Server, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := server.WriteCapture(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// clientCapabilities are what a runner can do besides verifying a certificate chain for a hostname. Suites that need
+// more than a runner can do are skipped.
+type clientCapabilities struct {
+	// The runner connects to the test server, rather than verifying the certificates it's given
+	performsHandshake   bool
+	verifiesUriIdentity bool
+}
+
+func getSanityCheckTestCase(provider test_case.TestCaseProvider) (test_case.TestCase, error) {
+	sanityCheckTestCaseId, err := provider.GetSanityCheckTestCase()
+	if err != nil {
+		return nil, err
+	}
+	return provider.GetTestCase(sanityCheckTestCaseId)
+}
+
+// isUriIdentitySuite reports whether a suite's test cases are verified by URI identity rather than by hostname.
+func isUriIdentitySuite(provider test_case.TestCaseProvider) (bool, error) {
+	sanityCheckTestCase, err := getSanityCheckTestCase(provider)
+	if err != nil {
+		return false, err
+	}
+	return test_case.GetUriIdentity(sanityCheckTestCase) != "", nil
+}
+
+// isHandshakeSuite reports whether a suite's test cases can only be run with a real TLS handshake.
+func isHandshakeSuite(provider test_case.TestCaseProvider) (bool, error) {
+	sanityCheckTestCase, err := getSanityCheckTestCase(provider)
+	if err != nil {
+		return false, err
+	}
+	return test_case.RequiresHandshake(sanityCheckTestCase), nil
+}
+
+func executeAllTests(ctx *ExecutionContext, suites *TestSuites, capabilities clientCapabilities, execTest func(index uint, provider test_case.TestCaseProvider, testCase test_case.TestCase) (bool, error)) (map[string]*SuiteTestResults, error) {
 	results := make(map[string]*SuiteTestResults)
 	for _, name := range suites.GetProviderNames() {
 		if ctx != nil && ctx.RunOnlySuite != "" && ctx.RunOnlySuite != name {
 			continue
 		}
 		provider := suites.GetProvider(name)
+		if !capabilities.verifiesUriIdentity {
+			uriIdentitySuite, err := isUriIdentitySuite(provider)
+			if err != nil {
+				return nil, err
+			}
+			if uriIdentitySuite {
+				if ctx != nil && ctx.RunOnlySuite == name {
+					return nil, fmt.Errorf("implementation can't verify URI identities, which suite %s requires", name)
+				}
+				continue
+			}
+		}
+		if !capabilities.performsHandshake {
+			handshakeSuite, err := isHandshakeSuite(provider)
+			if err != nil {
+				return nil, err
+			}
+			if handshakeSuite {
+				if ctx != nil && ctx.RunOnlySuite == name {
+					return nil, fmt.Errorf("implementation doesn't perform a TLS handshake, which suite %s requires", name)
+				}
+				continue
+			}
+		}
 		suiteResults, err := executeTestsForProvider(ctx, provider, func(index uint, testCase test_case.TestCase) (bool, error) {
 			return execTest(index, provider, testCase)
 		})
@@ -56,6 +262,35 @@ func executeAllTests(ctx *ExecutionContext, suites *TestSuites, execTest func(in
 	return results, nil
 }
 
+// buildSuiteResults builds a suite's results from test case results gathered elsewhere (e.g. by a browser), applying
+// the same sanity check and feature tests as a run by the executor. It needs a result for every test case the
+// executor would have run. The results have no durations, since the test cases weren't timed.
+func buildSuiteResults(provider test_case.TestCaseProvider, testCaseResults map[uint]TestCaseResult) (*SuiteTestResults, error) {
+	results, err := executeTestsForProvider(nil, provider, func(index uint, testCase test_case.TestCase) (bool, error) {
+		result, ok := testCaseResults[index]
+		if !ok {
+			return false, fmt.Errorf("missing result for test case %d", index)
+		}
+		return result == TestCaseResult_ACCEPTED, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	results.TestCaseDurationsMs = nil
+	return results, nil
+}
+
+// resultMatchesExpected reports whether a result agrees with the manifest. Soft expectations agree with either result.
+func resultMatchesExpected(r TestCaseResult, expected test_case.ExpectedResult) bool {
+	if expected == test_case.EXPECTED_RESULT_PASS && r != TestCaseResult_ACCEPTED {
+		return false
+	}
+	if expected == test_case.EXPECTED_RESULT_FAIL && r != TestCaseResult_REJECTED {
+		return false
+	}
+	return true
+}
+
 func executeTestsForProvider(ctx *ExecutionContext, provider test_case.TestCaseProvider, execTest func(index uint, testCase test_case.TestCase) (bool, error)) (*SuiteTestResults, error) {
 	execTestCase := func(idx uint, testCase test_case.TestCase) (TestCaseResult, error) {
 		result, err := execTest(idx, testCase)
@@ -68,16 +303,6 @@ func executeTestsForProvider(ctx *ExecutionContext, provider test_case.TestCaseP
 		return TestCaseResult_REJECTED, nil
 	}
 
-	matchesExpected := func(r TestCaseResult, expected test_case.ExpectedResult) bool {
-		if expected == test_case.EXPECTED_RESULT_PASS && r != TestCaseResult_ACCEPTED {
-			return false
-		}
-		if expected == test_case.EXPECTED_RESULT_FAIL && r != TestCaseResult_REJECTED {
-			return false
-		}
-		return true
-	}
-
 	testCaseCount, err := provider.GetTestCaseCount()
 	if err != nil {
 		return nil, err
@@ -99,7 +324,7 @@ func executeTestsForProvider(ctx *ExecutionContext, provider test_case.TestCaseP
 	if err != nil {
 		return nil, err
 	}
-	if !matchesExpected(sanityCheckResult, sanityCheckTestCase.ExpectedResult()) {
+	if !resultMatchesExpected(sanityCheckResult, sanityCheckTestCase.ExpectedResult()) {
 		return nil, fmt.Errorf("sanity check failed")
 	}
 
@@ -120,7 +345,7 @@ func executeTestsForProvider(ctx *ExecutionContext, provider test_case.TestCaseP
 			if err != nil {
 				return nil, err
 			}
-			if !matchesExpected(res, tc.ExpectedResult()) {
+			if !resultMatchesExpected(res, tc.ExpectedResult()) {
 				hasFailure = true
 				break
 			}
@@ -129,6 +354,7 @@ func executeTestsForProvider(ctx *ExecutionContext, provider test_case.TestCaseP
 	}
 
 	results := make([]TestCaseResult, testCaseCount)
+	durations := make([]uint32, testCaseCount)
 	for idx := uint(0); idx < testCaseCount; idx += 1 {
 		if ctx != nil && ctx.RunOnlyTests != nil && !ctx.RunOnlyTests.Empty() && !ctx.RunOnlyTests.Contains(int(idx)) {
 			results[idx] = TestCaseResult_SKIPPED
@@ -154,11 +380,13 @@ func executeTestsForProvider(ctx *ExecutionContext, provider test_case.TestCaseP
 			continue
 		}
 
+		startTime := time.Now()
 		testResult, err := execTestCase(idx, testCase)
 		if err != nil {
 			return nil, err
 		}
 		results[idx] = testResult
+		durations[idx] = uint32(time.Since(startTime).Milliseconds())
 
 		if ctx != nil && ctx.OnFinishTest != nil {
 			ctx.OnFinishTest(idx)
@@ -170,7 +398,8 @@ func executeTestsForProvider(ctx *ExecutionContext, provider test_case.TestCaseP
 	}
 
 	output := &SuiteTestResults{
-		TestCaseResults: results,
+		TestCaseResults:     results,
+		TestCaseDurationsMs: durations,
 	}
 	for _, feature := range provider.GetFeatures() {
 		if supportedFeatures[feature] {
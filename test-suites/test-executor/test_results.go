@@ -1,5 +1,73 @@
 package test_executor
 
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
 //go:generate go build -o protoc-gen-go github.com/golang/protobuf/protoc-gen-go
 //go:generate protoc --plugin=./protoc-gen-go --go_out=. --go_opt=paths=source_relative test_results.proto
 //go:generate rm -f protoc-gen-go
+
+// ImplementationTestResults is the format results files are saved in.
+type ImplementationTestResults struct {
+	ImplementationInfo string    `json:"implementation"`
+	VersionInfo        string    `json:"version"`
+	Date               time.Time `json:"date"`
+	BetterTlsRevision  string    `json:"betterTlsRevision"`
+	// Each suite's SuiteTestResults, as a gzipped protobuf
+	Suites map[string][]byte `json:"suites"`
+}
+
+func NewImplementationTestResults(implementation string, version string, suiteResults map[string]*SuiteTestResults) (*ImplementationTestResults, error) {
+	suiteResultsEncoded := make(map[string][]byte, len(suiteResults))
+	for suiteName, result := range suiteResults {
+		resultBytes, err := proto.Marshal(result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to proto-marshal results: %v", err)
+		}
+		buffer := bytes.NewBuffer(nil)
+		gz := gzip.NewWriter(buffer)
+		_, err = gz.Write(resultBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to gzip results: %v", err)
+		}
+		if err = gz.Flush(); err != nil {
+			return nil, fmt.Errorf("failed to gzip results: %v", err)
+		}
+		if err = gz.Close(); err != nil {
+			return nil, fmt.Errorf("failed to gzip results: %v", err)
+		}
+		suiteResultsEncoded[suiteName] = buffer.Bytes()
+	}
+
+	return &ImplementationTestResults{
+		ImplementationInfo: implementation,
+		VersionInfo:        version,
+		Date:               time.Now(),
+		BetterTlsRevision:  GetBuildRevision(),
+		Suites:             suiteResultsEncoded,
+	}, nil
+}
+
+// Save writes the results to "<implementation>_results.json" in the given directory and returns the file's path.
+func (r *ImplementationTestResults) Save(outputDir string) (string, error) {
+	path := filepath.Join(outputDir, fmt.Sprintf("%s_results.json", r.ImplementationInfo))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file for saving results: %v", err)
+	}
+	err = json.NewEncoder(f).Encode(r)
+	f.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to save results: %v", err)
+	}
+	return path, nil
+}
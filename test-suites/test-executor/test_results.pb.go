@@ -1,7 +1,7 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.26.0
-// 	protoc        v3.6.1
+// 	protoc-gen-go v1.33.0
+// 	protoc        v3.5.1-go
 // source: test_results.proto
 
 package test_executor
@@ -77,6 +77,7 @@ type SuiteTestResults struct {
 	SupportedFeatures   []int32          `protobuf:"varint,1,rep,packed,name=supported_features,json=supportedFeatures,proto3" json:"supported_features,omitempty"`
 	UnsupportedFeatures []int32          `protobuf:"varint,2,rep,packed,name=unsupported_features,json=unsupportedFeatures,proto3" json:"unsupported_features,omitempty"`
 	TestCaseResults     []TestCaseResult `protobuf:"varint,3,rep,packed,name=test_case_results,json=testCaseResults,proto3,enum=test_executor.TestCaseResult" json:"test_case_results,omitempty"`
+	TestCaseDurationsMs []uint32         `protobuf:"varint,4,rep,packed,name=test_case_durations_ms,json=testCaseDurationsMs,proto3" json:"test_case_durations_ms,omitempty"`
 }
 
 func (x *SuiteTestResults) Reset() {
@@ -132,12 +133,19 @@ func (x *SuiteTestResults) GetTestCaseResults() []TestCaseResult {
 	return nil
 }
 
+func (x *SuiteTestResults) GetTestCaseDurationsMs() []uint32 {
+	if x != nil {
+		return x.TestCaseDurationsMs
+	}
+	return nil
+}
+
 var File_test_results_proto protoreflect.FileDescriptor
 
 var file_test_results_proto_rawDesc = []byte{
 	0x0a, 0x12, 0x74, 0x65, 0x73, 0x74, 0x5f, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x73, 0x2e, 0x70,
 	0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0d, 0x74, 0x65, 0x73, 0x74, 0x5f, 0x65, 0x78, 0x65, 0x63, 0x75,
-	0x74, 0x6f, 0x72, 0x22, 0xbf, 0x01, 0x0a, 0x10, 0x53, 0x75, 0x69, 0x74, 0x65, 0x54, 0x65, 0x73,
+	0x74, 0x6f, 0x72, 0x22, 0xf4, 0x01, 0x0a, 0x10, 0x53, 0x75, 0x69, 0x74, 0x65, 0x54, 0x65, 0x73,
 	0x74, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x73, 0x12, 0x2d, 0x0a, 0x12, 0x73, 0x75, 0x70, 0x70,
 	0x6f, 0x72, 0x74, 0x65, 0x64, 0x5f, 0x66, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65, 0x73, 0x18, 0x01,
 	0x20, 0x03, 0x28, 0x05, 0x52, 0x11, 0x73, 0x75, 0x70, 0x70, 0x6f, 0x72, 0x74, 0x65, 0x64, 0x46,
@@ -149,12 +157,15 @@ var file_test_results_proto_rawDesc = []byte{
 	0x03, 0x20, 0x03, 0x28, 0x0e, 0x32, 0x1d, 0x2e, 0x74, 0x65, 0x73, 0x74, 0x5f, 0x65, 0x78, 0x65,
 	0x63, 0x75, 0x74, 0x6f, 0x72, 0x2e, 0x54, 0x65, 0x73, 0x74, 0x43, 0x61, 0x73, 0x65, 0x52, 0x65,
 	0x73, 0x75, 0x6c, 0x74, 0x52, 0x0f, 0x74, 0x65, 0x73, 0x74, 0x43, 0x61, 0x73, 0x65, 0x52, 0x65,
-	0x73, 0x75, 0x6c, 0x74, 0x73, 0x2a, 0x39, 0x0a, 0x0e, 0x54, 0x65, 0x73, 0x74, 0x43, 0x61, 0x73,
-	0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x0c, 0x0a, 0x08, 0x41, 0x43, 0x43, 0x45, 0x50,
-	0x54, 0x45, 0x44, 0x10, 0x00, 0x12, 0x0c, 0x0a, 0x08, 0x52, 0x45, 0x4a, 0x45, 0x43, 0x54, 0x45,
-	0x44, 0x10, 0x01, 0x12, 0x0b, 0x0a, 0x07, 0x53, 0x4b, 0x49, 0x50, 0x50, 0x45, 0x44, 0x10, 0x02,
-	0x42, 0x10, 0x5a, 0x0e, 0x2f, 0x74, 0x65, 0x73, 0x74, 0x5f, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74,
-	0x6f, 0x72, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x73, 0x75, 0x6c, 0x74, 0x73, 0x12, 0x33, 0x0a, 0x16, 0x74, 0x65, 0x73, 0x74, 0x5f, 0x63, 0x61,
+	0x73, 0x65, 0x5f, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x5f, 0x6d, 0x73, 0x18,
+	0x04, 0x20, 0x03, 0x28, 0x0d, 0x52, 0x13, 0x74, 0x65, 0x73, 0x74, 0x43, 0x61, 0x73, 0x65, 0x44,
+	0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x4d, 0x73, 0x2a, 0x39, 0x0a, 0x0e, 0x54, 0x65,
+	0x73, 0x74, 0x43, 0x61, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x0c, 0x0a, 0x08,
+	0x41, 0x43, 0x43, 0x45, 0x50, 0x54, 0x45, 0x44, 0x10, 0x00, 0x12, 0x0c, 0x0a, 0x08, 0x52, 0x45,
+	0x4a, 0x45, 0x43, 0x54, 0x45, 0x44, 0x10, 0x01, 0x12, 0x0b, 0x0a, 0x07, 0x53, 0x4b, 0x49, 0x50,
+	0x50, 0x45, 0x44, 0x10, 0x02, 0x42, 0x10, 0x5a, 0x0e, 0x2f, 0x74, 0x65, 0x73, 0x74, 0x5f, 0x65,
+	0x78, 0x65, 0x63, 0x75, 0x74, 0x6f, 0x72, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -42,6 +42,7 @@
              * @property {Array.<number>|null} [supportedFeatures] SuiteTestResults supportedFeatures
              * @property {Array.<number>|null} [unsupportedFeatures] SuiteTestResults unsupportedFeatures
              * @property {Array.<test_executor.TestCaseResult>|null} [testCaseResults] SuiteTestResults testCaseResults
+             * @property {Array.<number>|null} [testCaseDurationsMs] SuiteTestResults testCaseDurationsMs
              */
     
             /**
@@ -56,6 +57,7 @@
                 this.supportedFeatures = [];
                 this.unsupportedFeatures = [];
                 this.testCaseResults = [];
+                this.testCaseDurationsMs = [];
                 if (properties)
                     for (var keys = Object.keys(properties), i = 0; i < keys.length; ++i)
                         if (properties[keys[i]] != null)
@@ -86,6 +88,14 @@
              */
             SuiteTestResults.prototype.testCaseResults = $util.emptyArray;
     
+            /**
+             * SuiteTestResults testCaseDurationsMs.
+             * @member {Array.<number>} testCaseDurationsMs
+             * @memberof test_executor.SuiteTestResults
+             * @instance
+             */
+            SuiteTestResults.prototype.testCaseDurationsMs = $util.emptyArray;
+    
             /**
              * Creates a new SuiteTestResults instance using the specified properties.
              * @function create
@@ -128,6 +138,12 @@
                         writer.int32(message.testCaseResults[i]);
                     writer.ldelim();
                 }
+                if (message.testCaseDurationsMs != null && message.testCaseDurationsMs.length) {
+                    writer.uint32(/* id 4, wireType 2 =*/34).fork();
+                    for (var i = 0; i < message.testCaseDurationsMs.length; ++i)
+                        writer.uint32(message.testCaseDurationsMs[i]);
+                    writer.ldelim();
+                }
                 return writer;
             };
     
@@ -192,6 +208,16 @@
                         } else
                             message.testCaseResults.push(reader.int32());
                         break;
+                    case 4:
+                        if (!(message.testCaseDurationsMs && message.testCaseDurationsMs.length))
+                            message.testCaseDurationsMs = [];
+                        if ((tag & 7) === 2) {
+                            var end2 = reader.uint32() + reader.pos;
+                            while (reader.pos < end2)
+                                message.testCaseDurationsMs.push(reader.uint32());
+                        } else
+                            message.testCaseDurationsMs.push(reader.uint32());
+                        break;
                     default:
                         reader.skipType(tag & 7);
                         break;
@@ -254,6 +280,13 @@
                             break;
                         }
                 }
+                if (message.testCaseDurationsMs != null && message.hasOwnProperty("testCaseDurationsMs")) {
+                    if (!Array.isArray(message.testCaseDurationsMs))
+                        return "testCaseDurationsMs: array expected";
+                    for (var i = 0; i < message.testCaseDurationsMs.length; ++i)
+                        if (!$util.isInteger(message.testCaseDurationsMs[i]))
+                            return "testCaseDurationsMs: integer[] expected";
+                }
                 return null;
             };
     
@@ -304,6 +337,13 @@
                             break;
                         }
                 }
+                if (object.testCaseDurationsMs) {
+                    if (!Array.isArray(object.testCaseDurationsMs))
+                        throw TypeError(".test_executor.SuiteTestResults.testCaseDurationsMs: array expected");
+                    message.testCaseDurationsMs = [];
+                    for (var i = 0; i < object.testCaseDurationsMs.length; ++i)
+                        message.testCaseDurationsMs[i] = object.testCaseDurationsMs[i] >>> 0;
+                }
                 return message;
             };
     
@@ -324,6 +364,7 @@
                     object.supportedFeatures = [];
                     object.unsupportedFeatures = [];
                     object.testCaseResults = [];
+                    object.testCaseDurationsMs = [];
                 }
                 if (message.supportedFeatures && message.supportedFeatures.length) {
                     object.supportedFeatures = [];
@@ -340,6 +381,11 @@
                     for (var j = 0; j < message.testCaseResults.length; ++j)
                         object.testCaseResults[j] = options.enums === String ? $root.test_executor.TestCaseResult[message.testCaseResults[j]] : message.testCaseResults[j];
                 }
+                if (message.testCaseDurationsMs && message.testCaseDurationsMs.length) {
+                    object.testCaseDurationsMs = [];
+                    for (var j = 0; j < message.testCaseDurationsMs.length; ++j)
+                        object.testCaseDurationsMs[j] = message.testCaseDurationsMs[j];
+                }
                 return object;
             };
     
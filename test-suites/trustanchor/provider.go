@@ -0,0 +1,170 @@
+package trustanchor
+
+import (
+	"fmt"
+
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+)
+
+const (
+	SANITY_CHECK_TEST_CASE uint = iota
+	CUSTOM_ANCHOR_FEATURE_TEST_CASE
+	NON_SELF_SIGNED_ANCHOR_FEATURE_TEST_CASE
+	FIRST_CONSTRAINT_FEATURE_TEST_CASE
+)
+
+const (
+	FEATURE_CUSTOM_ANCHOR test_case.Feature = iota
+	FEATURE_NON_SELF_SIGNED_ANCHOR
+	FEATURE_ENFORCES_ANCHOR_EXPIRY
+	FEATURE_ENFORCES_ANCHOR_NAME_CONSTRAINTS
+	FEATURE_ENFORCES_ANCHOR_EKU
+	FEATURE_ENFORCES_ANCHOR_PATH_LEN
+)
+
+func constraintToFeature(constraint Constraint) test_case.Feature {
+	switch constraint {
+	case CONSTRAINT_EXPIRY:
+		return FEATURE_ENFORCES_ANCHOR_EXPIRY
+	case CONSTRAINT_NAME_CONSTRAINTS:
+		return FEATURE_ENFORCES_ANCHOR_NAME_CONSTRAINTS
+	case CONSTRAINT_EKU:
+		return FEATURE_ENFORCES_ANCHOR_EKU
+	case CONSTRAINT_PATH_LEN:
+		return FEATURE_ENFORCES_ANCHOR_PATH_LEN
+	}
+	panic(fmt.Errorf("no feature for constraint: %v", constraint))
+}
+
+type TestCaseProvider struct {
+	testCases []test_case.TestCase
+}
+
+func NewTestCaseProvider() *TestCaseProvider {
+	testCases := []test_case.TestCase{
+		SANITY_CHECK_TEST_CASE:                   &TrustAnchorTestCase{AnchorType: ANCHOR_TYPE_SUITE_ROOT},
+		CUSTOM_ANCHOR_FEATURE_TEST_CASE:          &TrustAnchorTestCase{AnchorType: ANCHOR_TYPE_SELF_SIGNED},
+		NON_SELF_SIGNED_ANCHOR_FEATURE_TEST_CASE: &TrustAnchorTestCase{AnchorType: ANCHOR_TYPE_ISSUED_BY_ROOT},
+	}
+	// One test per constraint (in the order of ALL_CONSTRAINTS) detects whether it is enforced on anchors at all
+	for _, constraint := range ALL_CONSTRAINTS {
+		testCases = append(testCases, &TrustAnchorTestCase{
+			AnchorType: ANCHOR_TYPE_SELF_SIGNED,
+			Constraint: constraint,
+			Violated:   true,
+		})
+	}
+
+	// The feature tests above already cover self-signed anchors with violated constraints
+	for _, constraint := range ALL_CONSTRAINTS {
+		testCases = append(testCases, &TrustAnchorTestCase{
+			AnchorType: ANCHOR_TYPE_ISSUED_BY_ROOT,
+			Constraint: constraint,
+			Violated:   true,
+		})
+	}
+
+	for _, anchorType := range []AnchorType{ANCHOR_TYPE_SELF_SIGNED, ANCHOR_TYPE_ISSUED_BY_ROOT} {
+		for _, constraint := range ALL_CONSTRAINTS {
+			if constraint == CONSTRAINT_EXPIRY {
+				// A satisfied validity period is no different from having no constraint
+				continue
+			}
+			testCases = append(testCases, &TrustAnchorTestCase{
+				AnchorType: anchorType,
+				Constraint: constraint,
+			})
+		}
+		testCases = append(testCases, &TrustAnchorTestCase{
+			AnchorType:      anchorType,
+			SubjectMismatch: true,
+		})
+	}
+	testCases = append(testCases, &TrustAnchorTestCase{
+		AnchorType:      ANCHOR_TYPE_SUITE_ROOT,
+		SubjectMismatch: true,
+	})
+
+	// The constraints carried by a copy of the bettertls root itself
+	for _, constraint := range ALL_CONSTRAINTS {
+		for _, violated := range []bool{true, false} {
+			if constraint == CONSTRAINT_EXPIRY && !violated {
+				continue
+			}
+			testCases = append(testCases, &TrustAnchorTestCase{
+				AnchorType: ANCHOR_TYPE_SUITE_ROOT,
+				Constraint: constraint,
+				Violated:   violated,
+			})
+		}
+	}
+	// Only the anchor the client was configured with carries the constraint: the copy in the chain doesn't
+	for _, anchorType := range []AnchorType{ANCHOR_TYPE_SUITE_ROOT, ANCHOR_TYPE_ISSUED_BY_ROOT} {
+		for _, constraint := range ALL_CONSTRAINTS {
+			testCases = append(testCases, &TrustAnchorTestCase{
+				AnchorType:               anchorType,
+				Constraint:               constraint,
+				Violated:                 true,
+				UnconstrainedCopyInChain: true,
+			})
+		}
+	}
+
+	return &TestCaseProvider{
+		testCases: testCases,
+	}
+}
+
+func (p *TestCaseProvider) Name() string {
+	return "trustanchor"
+}
+
+func (p *TestCaseProvider) GetTestCaseCount() (uint, error) {
+	return uint(len(p.testCases)), nil
+}
+
+func (p *TestCaseProvider) GetTestCase(index uint) (test_case.TestCase, error) {
+	return p.testCases[index], nil
+}
+
+func (p *TestCaseProvider) GetSanityCheckTestCase() (uint, error) {
+	return SANITY_CHECK_TEST_CASE, nil
+}
+
+func (p *TestCaseProvider) GetFeatures() []test_case.Feature {
+	return []test_case.Feature{FEATURE_CUSTOM_ANCHOR, FEATURE_NON_SELF_SIGNED_ANCHOR, FEATURE_ENFORCES_ANCHOR_EXPIRY, FEATURE_ENFORCES_ANCHOR_NAME_CONSTRAINTS,
+		FEATURE_ENFORCES_ANCHOR_EKU, FEATURE_ENFORCES_ANCHOR_PATH_LEN}
+}
+
+func (p *TestCaseProvider) DescribeFeature(feature test_case.Feature) string {
+	switch feature {
+	case FEATURE_CUSTOM_ANCHOR:
+		return "CUSTOM_ANCHOR"
+	case FEATURE_NON_SELF_SIGNED_ANCHOR:
+		return "NON_SELF_SIGNED_ANCHOR"
+	case FEATURE_ENFORCES_ANCHOR_EXPIRY:
+		return "ENFORCES_ANCHOR_EXPIRY"
+	case FEATURE_ENFORCES_ANCHOR_NAME_CONSTRAINTS:
+		return "ENFORCES_ANCHOR_NAME_CONSTRAINTS"
+	case FEATURE_ENFORCES_ANCHOR_EKU:
+		return "ENFORCES_ANCHOR_EKU"
+	case FEATURE_ENFORCES_ANCHOR_PATH_LEN:
+		return "ENFORCES_ANCHOR_PATH_LEN"
+	}
+	panic(fmt.Errorf("unsupported feature: %d", feature))
+}
+
+func (p *TestCaseProvider) GetTestCasesForFeature(feature test_case.Feature) ([]uint, error) {
+	if feature == FEATURE_CUSTOM_ANCHOR {
+		return []uint{CUSTOM_ANCHOR_FEATURE_TEST_CASE}, nil
+	}
+	if feature == FEATURE_NON_SELF_SIGNED_ANCHOR {
+		return []uint{NON_SELF_SIGNED_ANCHOR_FEATURE_TEST_CASE}, nil
+	}
+	for idx, constraint := range ALL_CONSTRAINTS {
+		if feature == constraintToFeature(constraint) {
+			return []uint{FIRST_CONSTRAINT_FEATURE_TEST_CASE + uint(idx)}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid feature: %v", feature)
+}
@@ -0,0 +1,307 @@
+package trustanchor
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Netflix/bettertls/test-suites/certutil"
+	test_case "github.com/Netflix/bettertls/test-suites/test-case"
+)
+
+const HOSTNAME = "localhost"
+const VALID_DNS_TREE = "localhost"
+const INVALID_DNS_TREE = "example.com"
+
+// An AnchorType is the kind of certificate the client is asked to trust.
+type AnchorType int
+
+const (
+	// The bettertls trust root itself. With a constraint, the client trusts a copy of it (same subject and key)
+	// carrying that constraint instead.
+	ANCHOR_TYPE_SUITE_ROOT AnchorType = iota
+	// A self-signed root generated for the test case and trusted instead of the bettertls trust root
+	ANCHOR_TYPE_SELF_SIGNED
+	// A CA certificate issued by the bettertls trust root, which is trusted directly instead of the bettertls trust root
+	ANCHOR_TYPE_ISSUED_BY_ROOT
+)
+
+func (t AnchorType) String() string {
+	switch t {
+	case ANCHOR_TYPE_SUITE_ROOT:
+		return "SUITE_ROOT"
+	case ANCHOR_TYPE_SELF_SIGNED:
+		return "SELF_SIGNED"
+	case ANCHOR_TYPE_ISSUED_BY_ROOT:
+		return "ISSUED_BY_ROOT"
+	}
+	panic(fmt.Errorf("unhandled AnchorType: %d", t))
+}
+func (t AnchorType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// A Constraint is a restriction carried by the trust anchor certificate itself.
+type Constraint int
+
+const (
+	CONSTRAINT_NONE Constraint = iota
+	// The anchor's validity period
+	CONSTRAINT_EXPIRY
+	// A permitted DNS subtree
+	CONSTRAINT_NAME_CONSTRAINTS
+	// An extended key usage extension
+	CONSTRAINT_EKU
+	// A basic constraints path length, with one ICA below the anchor
+	CONSTRAINT_PATH_LEN
+)
+
+func (c Constraint) String() string {
+	switch c {
+	case CONSTRAINT_NONE:
+		return "NONE"
+	case CONSTRAINT_EXPIRY:
+		return "EXPIRY"
+	case CONSTRAINT_NAME_CONSTRAINTS:
+		return "NAME_CONSTRAINTS"
+	case CONSTRAINT_EKU:
+		return "EKU"
+	case CONSTRAINT_PATH_LEN:
+		return "PATH_LEN"
+	}
+	panic(fmt.Errorf("unhandled Constraint: %d", c))
+}
+func (c Constraint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+var ALL_CONSTRAINTS = []Constraint{CONSTRAINT_EXPIRY, CONSTRAINT_NAME_CONSTRAINTS, CONSTRAINT_EKU, CONSTRAINT_PATH_LEN}
+
+type TrustAnchorTestCase struct {
+	AnchorType AnchorType
+	Constraint Constraint
+	// Whether the chain violates the anchor's constraint. Otherwise, the constraint is present but satisfied.
+	Violated bool
+	// Whether the ICA's issuer name differs from the anchor's subject (while still being signed by the anchor's key)
+	SubjectMismatch bool
+	// Whether the server also presents a copy of the anchor without the constraint (same subject and key) in its
+	// chain, so that a client taking the anchor's constraints from the chain rather than from the anchor it was
+	// configured with misses them
+	UnconstrainedCopyInChain bool
+}
+
+func (t *TrustAnchorTestCase) GetHostname() string {
+	return HOSTNAME
+}
+
+func (t *TrustAnchorTestCase) ExpectedResult() test_case.ExpectedResult {
+	// RFC 5280 only requires that the anchor's name and key are used, but RFC 5937 (and most browser policies) allow
+	// enforcing constraints in the anchor certificate too. A violation is only expected to fail for clients that
+	// have been seen to enforce that kind of constraint (see RequiredFeatures).
+	if t.SubjectMismatch || (t.Constraint != CONSTRAINT_NONE && t.Violated) {
+		return test_case.EXPECTED_RESULT_FAIL
+	}
+	return test_case.EXPECTED_RESULT_PASS
+}
+
+func (t *TrustAnchorTestCase) RequiredFeatures() []test_case.Feature {
+	var requiredFeatures []test_case.Feature
+	if t.AnchorType != ANCHOR_TYPE_SUITE_ROOT || t.Constraint != CONSTRAINT_NONE {
+		requiredFeatures = append(requiredFeatures, FEATURE_CUSTOM_ANCHOR)
+	}
+	if t.AnchorType == ANCHOR_TYPE_ISSUED_BY_ROOT {
+		// RFC 5280 allows any certificate to be a trust anchor, but some clients (e.g. OpenSSL without
+		// X509_V_FLAG_PARTIAL_CHAIN) only accept self-signed ones
+		requiredFeatures = append(requiredFeatures, FEATURE_NON_SELF_SIGNED_ANCHOR)
+	}
+	if t.Constraint != CONSTRAINT_NONE && t.Violated {
+		requiredFeatures = append(requiredFeatures, constraintToFeature(t.Constraint))
+	}
+	return requiredFeatures
+}
+
+func (t *TrustAnchorTestCase) GetCertificates(rootCert *x509.Certificate, rootKey crypto.Signer) (*tls.Certificate, error) {
+	artifacts, err := t.GetArtifacts(&test_case.Environment{RootCert: rootCert, RootKey: rootKey})
+	if err != nil {
+		return nil, err
+	}
+	return artifacts.Certificate, nil
+}
+
+// anchorTemplate builds the template for the anchor certificate, with the test's constraint if constrained is set.
+func (t *TrustAnchorTestCase) anchorTemplate(env *test_case.Environment, constrained bool) (*x509.Certificate, error) {
+	template := &x509.Certificate{
+		SerialNumber: certutil.RandomSerial(),
+		Subject: pkix.Name{
+			CommonName:   "trust_anchor",
+			Organization: []string{certutil.SUBJECT_ORGANIZATION},
+			SerialNumber: certutil.RandomString(),
+		},
+		NotBefore:             certutil.GetNotBefore(),
+		NotAfter:              certutil.GetNotAfter(false),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if t.AnchorType == ANCHOR_TYPE_SUITE_ROOT {
+		// Keep the suite root's exact name and key identifier, so the copy is interchangeable with it
+		template.RawSubject = env.RootCert.RawSubject
+		template.SubjectKeyId = env.RootCert.SubjectKeyId
+	}
+	if !constrained {
+		return template, nil
+	}
+	switch t.Constraint {
+	case CONSTRAINT_NONE:
+	case CONSTRAINT_EXPIRY:
+		template.NotAfter = certutil.GetNotAfter(t.Violated)
+	case CONSTRAINT_NAME_CONSTRAINTS:
+		template.PermittedDNSDomainsCritical = true
+		if t.Violated {
+			template.PermittedDNSDomains = []string{INVALID_DNS_TREE}
+		} else {
+			template.PermittedDNSDomains = []string{VALID_DNS_TREE}
+		}
+	case CONSTRAINT_EKU:
+		if t.Violated {
+			template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}
+		} else {
+			template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		}
+	case CONSTRAINT_PATH_LEN:
+		if t.Violated {
+			template.MaxPathLenZero = true
+		} else {
+			template.MaxPathLen = 1
+		}
+	default:
+		return nil, fmt.Errorf("unhandled constraint: %v", t.Constraint)
+	}
+	return template, nil
+}
+
+// issueAnchor creates an anchor certificate for the given key from a template.
+func (t *TrustAnchorTestCase) issueAnchor(env *test_case.Environment, template *x509.Certificate, key crypto.Signer) (*x509.Certificate, error) {
+	parent, parentKey := template, key
+	if t.AnchorType == ANCHOR_TYPE_ISSUED_BY_ROOT {
+		parent, parentKey = env.RootCert, env.RootKey
+	}
+	anchorBytes, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(anchorBytes)
+}
+
+func (t *TrustAnchorTestCase) GetArtifacts(env *test_case.Environment) (*test_case.Artifacts, error) {
+	anchor, anchorKey := env.RootCert, env.RootKey
+	// The suite root already exists without any constraint
+	unconstrainedAnchor := env.RootCert
+	if t.AnchorType != ANCHOR_TYPE_SUITE_ROOT {
+		newAnchorKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		anchorKey = newAnchorKey
+	}
+	if t.AnchorType != ANCHOR_TYPE_SUITE_ROOT || t.Constraint != CONSTRAINT_NONE {
+		template, err := t.anchorTemplate(env, true)
+		if err != nil {
+			return nil, err
+		}
+		anchor, err = t.issueAnchor(env, template, anchorKey)
+		if err != nil {
+			return nil, err
+		}
+		if t.UnconstrainedCopyInChain && t.AnchorType != ANCHOR_TYPE_SUITE_ROOT {
+			template, err = t.anchorTemplate(env, false)
+			if err != nil {
+				return nil, err
+			}
+			template.RawSubject = anchor.RawSubject
+			template.SubjectKeyId = anchor.SubjectKeyId
+			unconstrainedAnchor, err = t.issueAnchor(env, template, anchorKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	icaIssuer := anchor
+	if t.SubjectMismatch {
+		// Only the issuer name changes: the ICA is still signed by, and identifies, the anchor's key
+		mismatched := *anchor
+		mismatched.RawSubject = nil
+		mismatched.Subject = pkix.Name{
+			CommonName:   "other_trust_anchor",
+			Organization: []string{certutil.SUBJECT_ORGANIZATION},
+			SerialNumber: certutil.RandomString(),
+		}
+		icaIssuer = &mismatched
+	}
+	icaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	icaBytes, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: certutil.RandomSerial(),
+		Subject: pkix.Name{
+			CommonName:   "ica",
+			Organization: []string{certutil.SUBJECT_ORGANIZATION},
+			SerialNumber: certutil.RandomString(),
+		},
+		NotBefore:             certutil.GetNotBefore(),
+		NotAfter:              certutil.GetNotAfter(false),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, icaIssuer, icaKey.Public(), anchorKey)
+	if err != nil {
+		return nil, err
+	}
+	ica, err := x509.ParseCertificate(icaBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	leafBytes, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: certutil.RandomSerial(),
+		Subject: pkix.Name{
+			CommonName:   HOSTNAME,
+			Organization: []string{certutil.SUBJECT_ORGANIZATION},
+			SerialNumber: certutil.RandomString(),
+		},
+		NotBefore:             certutil.GetNotBefore(),
+		NotAfter:              certutil.GetNotAfter(false),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:              []string{HOSTNAME},
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+	}, ica, leafKey.Public(), icaKey)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := [][]byte{leafBytes, ica.Raw}
+	if t.UnconstrainedCopyInChain {
+		chain = append(chain, unconstrainedAnchor.Raw)
+	}
+	return &test_case.Artifacts{
+		Certificate: &tls.Certificate{
+			Certificate: chain,
+			PrivateKey:  leafKey,
+		},
+		TrustAnchors: []*x509.Certificate{anchor},
+	}, nil
+}